@@ -1,21 +1,97 @@
 package internal
 
 import (
+	"context"
+	"fmt"
+	"golden-arm/schema"
+	"net/http"
 	"os"
+	"slices"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
-func CheckAuthorization(c *gin.Context) bool {
-	// check for and validate sessionToken cookie
-	// if not present or invalid, check the request Authorization header
-	// if API_KEY is not present in the request header or not equal to the value in .env, return 401
+// Key under which the authenticated operator is stored in the gin context
+const operatorKey = "operator"
 
+// Requests made with the API key act as this admin, e.g. scripts and curl
+var apiKeyOperator = schema.Operator{
+	ID:   uuid.Nil,
+	Name: "API key",
+	Role: schema.RoleAdmin,
+}
+
+// Returns the operator making the request, or nil if it isn't authenticated
+// Checks the sessionToken cookie first, then the API_KEY bearer token
+func GetOperator(c *gin.Context) *schema.Operator {
+	if value, exists := c.Get(operatorKey); exists {
+		return value.(*schema.Operator)
+	}
+
+	operator := authenticate(c)
+	if operator != nil {
+		c.Set(operatorKey, operator)
+	}
+	return operator
+}
+
+func authenticate(c *gin.Context) *schema.Operator {
 	sessionToken, err := c.Cookie("sessionToken")
 	if err == nil && ValidateSession(sessionToken) {
-		return true
+		operatorID, err := uuid.Parse(GetSessionUser(sessionToken))
+		if err == nil {
+			operator, err := getActiveOperator(operatorID)
+			if err == nil {
+				return operator
+			}
+			fmt.Printf("Error loading operator for session: %v", err)
+		}
 	}
 
-	authHeader := c.GetHeader("Authorization")
-	return authHeader == "Bearer "+os.Getenv("API_KEY")
+	apiKey := os.Getenv("API_KEY")
+	if apiKey != "" && c.GetHeader("Authorization") == "Bearer "+apiKey {
+		operator := apiKeyOperator
+		return &operator
+	}
+	return nil
+}
+
+// Loads an operator that hasn't been disabled
+func getActiveOperator(operatorID uuid.UUID) (*schema.Operator, error) {
+	operator := new(schema.Operator)
+	err := schema.GetDBConn().NewSelect().
+		Model(operator).
+		Where("id = ? AND disabled_at IS NULL", operatorID).
+		Scan(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return operator, nil
+}
+
+// Reports whether the request comes from an operator with one of the given roles
+// Admins have every role; with no roles given, any operator will do
+func HasRole(c *gin.Context, roles ...string) bool {
+	operator := GetOperator(c)
+	if operator == nil {
+		return false
+	}
+	return len(roles) == 0 || operator.Role == schema.RoleAdmin || slices.Contains(roles, operator.Role)
+}
+
+// Middleware that only lets through operators with one of the given roles
+// Responds 401 if the request isn't authenticated and 403 if the operator lacks the role
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if GetOperator(c) == nil {
+			c.AbortWithError(http.StatusUnauthorized, ErrUnauthorized)
+			return
+		}
+		if !HasRole(c, roles...) {
+			c.AbortWithError(http.StatusForbidden, ErrForbidden)
+			return
+		}
+		c.Next()
+	}
 }
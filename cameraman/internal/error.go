@@ -9,6 +9,7 @@ import (
 
 var (
 	ErrUnauthorized     = fmt.Errorf("Unauthorized")
+	ErrForbidden        = fmt.Errorf("Forbidden")
 	ErrBadRequest       = fmt.Errorf("Bad Request")
 	ErrNotFound         = fmt.Errorf("Not Found")
 	ErrMethodNotAllowed = fmt.Errorf("Method Not Allowed")
@@ -24,6 +25,10 @@ func Handle401(c *gin.Context) {
 	c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Unauthorized"})
 }
 
+func Handle403(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "Forbidden"})
+}
+
 func Handle404(c *gin.Context) {
 	c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Not found"})
 }
@@ -1,43 +1,133 @@
 package internal
 
 import (
-	"sync"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"golden-arm/schema"
 	"time"
 )
 
-var sessionStore = struct {
-	sync.RWMutex
-	data map[string]SessionData
-}{
-	data: make(map[string]SessionData),
-}
+// Sessions are renewed on every use but never outlive this, however active they are
+const MaxSessionAge = 24 * time.Hour
+
+// How often expired sessions are removed from the database
+const sessionSweepInterval = 10 * time.Minute
 
-type SessionData struct {
-	User      string
-	ExpiresAt time.Time
+// Hashes a secret token for storage, so a leaked table of hashes can't be used to log in
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
+// Stores a session that stays valid while it's used at least once before expiresAt
+// The time until expiresAt becomes the session's idle timeout
 func StoreSession(token string, user string, expiresAt time.Time) {
-	sessionStore.Lock()
-	defer sessionStore.Unlock()
-	sessionStore.data[token] = SessionData{
-		User:      user,
-		ExpiresAt: expiresAt,
+	now := time.Now()
+	session := schema.Session{
+		TokenHash:   HashToken(token),
+		User:        user,
+		CreatedAt:   now,
+		ExpiresAt:   expiresAt,
+		IdleTimeout: int64(expiresAt.Sub(now).Seconds()),
+	}
+
+	_, err := schema.GetDBConn().NewInsert().
+		Model(&session).
+		Exec(context.Background())
+	if err != nil {
+		fmt.Printf("Error storing session: %v", err)
 	}
 }
 
+// Reports whether the session exists and hasn't expired, pushing back its expiry if so
 func ValidateSession(token string) bool {
-	sessionStore.RLock()
-	defer sessionStore.RUnlock()
-	session, exists := sessionStore.data[token]
-	if !exists || time.Now().After(session.ExpiresAt) {
+	now := time.Now()
+	result, err := schema.GetDBConn().NewUpdate().
+		Model((*schema.Session)(nil)).
+		Set("expires_at = ? + make_interval(secs => idle_timeout)", now).
+		Where("token_hash = ?", HashToken(token)).
+		Where("expires_at > ?", now).
+		Where("created_at > ?", now.Add(-MaxSessionAge)).
+		Exec(context.Background())
+	if err != nil {
+		fmt.Printf("Error validating session: %v", err)
 		return false
 	}
-	return true
+
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected > 0
 }
 
 func DeleteSession(token string) {
-	sessionStore.Lock()
-	defer sessionStore.Unlock()
-	delete(sessionStore.data, token)
+	_, err := schema.GetDBConn().NewDelete().
+		Model((*schema.Session)(nil)).
+		Where("token_hash = ?", HashToken(token)).
+		Exec(context.Background())
+	if err != nil {
+		fmt.Printf("Error deleting session: %v", err)
+	}
+}
+
+// Returns the user a session belongs to, or "" if there's no such session
+func GetSessionUser(token string) string {
+	var user string
+	err := schema.GetDBConn().NewSelect().
+		Model((*schema.Session)(nil)).
+		Column("username").
+		Where("token_hash = ?", HashToken(token)).
+		Scan(context.Background(), &user)
+	if err != nil {
+		return ""
+	}
+	return user
+}
+
+// Logs a user out everywhere; returns how many sessions were deleted
+func DeleteUserSessions(user string) (int64, error) {
+	result, err := schema.GetDBConn().NewDelete().
+		Model((*schema.Session)(nil)).
+		Where("username = ?", user).
+		Exec(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Logs every user out everywhere; returns how many sessions were deleted
+func DeleteAllSessions() (int64, error) {
+	result, err := schema.GetDBConn().NewDelete().
+		Model((*schema.Session)(nil)).
+		Where("TRUE").
+		Exec(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Removes sessions that have expired or reached their maximum age
+func sweepExpiredSessions(ctx context.Context) error {
+	now := time.Now()
+	_, err := schema.GetDBConn().NewDelete().
+		Model((*schema.Session)(nil)).
+		Where("expires_at <= ? OR created_at <= ?", now, now.Add(-MaxSessionAge)).
+		Exec(ctx)
+	return err
+}
+
+// Periodically removes expired sessions in the background
+func StartSessionSweeper() {
+	go func() {
+		ticker := time.NewTicker(sessionSweepInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := sweepExpiredSessions(context.Background()); err != nil {
+				fmt.Printf("Error sweeping sessions: %v\n", err)
+			}
+		}
+	}()
 }
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Token purposes; a token signed for one purpose is never accepted for another
+const (
+	TokenCancelReservation = "cancel-reservation"
+	TokenStockHold         = "stock-hold"
+	TokenPatronLookup      = "patron-lookup" // Subject is the movie-goer's email address, in lower case
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token has expired")
+)
+
+// Signs subject (e.g. a reservation ID) into a URL-safe token that can be emailed to a movie-goer
+// The token is signed with TOKEN_SECRET; a zero expiresAt means it never expires
+func SignToken(purpose string, subject string, expiresAt time.Time) string {
+	var expiry int64
+	if !expiresAt.IsZero() {
+		expiry = expiresAt.Unix()
+	}
+
+	payload := fmt.Sprintf("%s|%s|%d", purpose, subject, expiry)
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(signature(encoded))
+}
+
+// Checks a token's signature, purpose and expiry and returns the subject it was signed for
+func VerifyToken(purpose string, token string) (string, error) {
+	encoded, sig, found := strings.Cut(token, ".")
+	if !found {
+		return "", ErrInvalidToken
+	}
+
+	decodedSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(decodedSig, signature(encoded)) {
+		return "", ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	parts := strings.Split(string(payload), "|")
+	if len(parts) != 3 || parts[0] != purpose {
+		return "", ErrInvalidToken
+	}
+
+	expiry, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	if expiry != 0 && time.Now().Unix() > expiry {
+		return "", ErrExpiredToken
+	}
+
+	return parts[1], nil
+}
+
+func signature(data string) []byte {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("TOKEN_SECRET")))
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,41 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Writes each email to an .eml file instead of sending it; for local development
+type FileMailer struct {
+	Dir string
+}
+
+func NewFileMailer(dir string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	return &FileMailer{Dir: dir}, nil
+}
+
+// Returns the path of the written file
+func (m *FileMailer) Send(ctx context.Context, msg Message) (string, error) {
+	data, err := msg.Bytes(newMessageID())
+	if err != nil {
+		return "", err
+	}
+
+	// Timestamped names keep the directory in the order emails were sent
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405"), uuid.New())
+	path := filepath.Join(m.Dir, name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", err
+	}
+
+	fmt.Printf("Email \"%s\" to %v written to %s\n", msg.Subject, msg.To, path)
+	return path, nil
+}
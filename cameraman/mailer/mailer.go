@@ -0,0 +1,194 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// An HTML email ready to be sent by any backend
+type Message struct {
+	From    string
+	To      []string
+	Cc      []string
+	ReplyTo []string
+	Subject string
+	HTML    string
+
+	Attachments []Attachment
+}
+
+// A file attached to an email, e.g. a calendar event
+type Attachment struct {
+	Filename    string
+	ContentType string // e.g. "text/calendar; method=PUBLISH"
+	Data        []byte
+}
+
+// Sends email and returns an ID for the sent message
+type Mailer interface {
+	Send(ctx context.Context, msg Message) (string, error)
+}
+
+var (
+	mailer Mailer
+	once   sync.Once
+)
+
+// Returns the mailer chosen by MAIL_BACKEND: "ses" (default), "smtp", "file", or "memory"
+func GetMailer() Mailer {
+	once.Do(func() {
+		var err error
+		mailer, err = New(os.Getenv("MAIL_BACKEND"))
+		if err != nil {
+			log.Fatalf("Failed to set up mailer: %v", err)
+		}
+	})
+
+	return mailer
+}
+
+// Creates a mailer for the given backend, configured from the environment
+func New(backend string) (Mailer, error) {
+	switch backend {
+	case "", "ses":
+		return NewSESMailer(context.Background())
+	case "smtp":
+		return NewSMTPMailer(), nil
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		return NewFileMailer(dir)
+	case "memory":
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown mail backend %q", backend)
+	}
+}
+
+// Returns every address the message should be delivered to
+func (msg Message) Recipients() []string {
+	return append(append([]string{}, msg.To...), nonEmpty(msg.Cc)...)
+}
+
+// Encodes the message as a MIME email, e.g. for SMTP or an .eml file
+// A message with attachments is sent as multipart/mixed, with the HTML body as its first part
+func (msg Message) Bytes(messageID string) ([]byte, error) {
+	var buf bytes.Buffer
+
+	writeHeader := func(key string, value string) {
+		if value != "" {
+			fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+		}
+	}
+	writeHeader("From", msg.From)
+	writeHeader("To", strings.Join(msg.To, ", "))
+	writeHeader("Cc", strings.Join(nonEmpty(msg.Cc), ", "))
+	writeHeader("Reply-To", strings.Join(nonEmpty(msg.ReplyTo), ", "))
+	writeHeader("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	writeHeader("Date", time.Now().Format(time.RFC1123Z))
+	writeHeader("Message-ID", messageID)
+	writeHeader("MIME-Version", "1.0")
+
+	if len(msg.Attachments) == 0 {
+		writeHeader("Content-Type", "text/html; charset=UTF-8")
+		writeHeader("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+
+		if err := writeQuotedPrintable(&buf, msg.HTML); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	writeHeader("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	buf.WriteString("\r\n")
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=UTF-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeQuotedPrintable(part, msg.HTML); err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range msg.Attachments {
+		mediaType, params, err := mime.ParseMediaType(attachment.ContentType)
+		if err != nil {
+			return nil, fmt.Errorf("invalid content type for %s: %w", attachment.Filename, err)
+		}
+		params["name"] = attachment.Filename
+
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(mediaType, params)},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64Lines(part, attachment.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, text string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(text)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// Writes data as base64 in lines of 76 characters, as MIME requires
+func writeBase64Lines(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 0 {
+		n := min(len(encoded), 76)
+		if _, err := io.WriteString(w, encoded[:n]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[n:]
+	}
+	return nil
+}
+
+// Generates a Message-ID header value for backends that don't assign their own
+func newMessageID() string {
+	return fmt.Sprintf("<%s@goldenarmtheater.com>", uuid.New())
+}
+
+func nonEmpty(addrs []string) []string {
+	var result []string
+	for _, addr := range addrs {
+		if addr != "" {
+			result = append(result, addr)
+		}
+	}
+	return result
+}
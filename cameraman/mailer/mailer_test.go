@@ -0,0 +1,260 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+// A part of a parsed email, decoded from its transfer encoding
+type parsedPart struct {
+	ContentType string
+	Disposition string
+	Body        []byte
+}
+
+// Parses an email as a mail client would, returning its headers and each part
+// A single-part email comes back as one part
+func parseMessage(t *testing.T, data []byte) (mail.Header, []parsedPart) {
+	t.Helper()
+
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("ParseMediaType: %v", err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return msg.Header, []parsedPart{decodePart(t, msg.Header.Get("Content-Type"), "", msg.Header.Get("Content-Transfer-Encoding"), msg.Body)}
+	}
+
+	var parts []parsedPart
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextRawPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("NextRawPart: %v", err)
+		}
+		parts = append(parts, decodePart(t, part.Header.Get("Content-Type"), part.Header.Get("Content-Disposition"), part.Header.Get("Content-Transfer-Encoding"), part))
+	}
+	return msg.Header, parts
+}
+
+func decodePart(t *testing.T, contentType string, disposition string, encoding string, r io.Reader) parsedPart {
+	t.Helper()
+
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading part: %v", err)
+	}
+	for _, line := range strings.Split(string(raw), "\r\n") {
+		if len(line) > 76 {
+			t.Errorf("line is %d characters, longer than MIME allows: %q", len(line), line)
+		}
+	}
+
+	var body []byte
+	switch encoding {
+	case "quoted-printable":
+		body, err = io.ReadAll(quotedprintable.NewReader(bytes.NewReader(raw)))
+	case "base64":
+		body, err = base64.StdEncoding.DecodeString(strings.ReplaceAll(string(raw), "\r\n", ""))
+	default:
+		t.Fatalf("unexpected transfer encoding %q", encoding)
+	}
+	if err != nil {
+		t.Fatalf("decoding %s part: %v", encoding, err)
+	}
+	return parsedPart{ContentType: contentType, Disposition: disposition, Body: body}
+}
+
+func TestMessageBytes(t *testing.T) {
+	html := "<p>Your seats: " + strings.Repeat("A1, ", 40) + "B2 — enjoy the show!</p>"
+	calendar := []byte("BEGIN:VCALENDAR\r\n" + strings.Repeat("X-FILLER:some text to wrap\r\n", 10) + "END:VCALENDAR\r\n")
+	image := bytes.Repeat([]byte{0x00, 0xff, 0x10}, 100)
+
+	tests := []struct {
+		name        string
+		attachments []Attachment
+		wantType    string
+	}{
+		{
+			name:     "html only",
+			wantType: "text/html",
+		},
+		{
+			name: "one attachment",
+			attachments: []Attachment{
+				{Filename: "screening.ics", ContentType: "text/calendar; charset=UTF-8; method=PUBLISH", Data: calendar},
+			},
+			wantType: "multipart/mixed",
+		},
+		{
+			name: "two attachments",
+			attachments: []Attachment{
+				{Filename: "screening.ics", ContentType: "text/calendar; charset=UTF-8; method=PUBLISH", Data: calendar},
+				{Filename: "poster.png", ContentType: "image/png", Data: image},
+			},
+			wantType: "multipart/mixed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := Message{
+				From:    "reservations@example.com",
+				To:      []string{"jb@example.com"},
+				Cc:      []string{""},
+				ReplyTo: []string{"team@example.com"},
+				Subject: "You're set to watch \"Amélie\"",
+				HTML:    html,
+
+				Attachments: tt.attachments,
+			}
+			data, err := msg.Bytes("<test@example.com>")
+			if err != nil {
+				t.Fatalf("Bytes: %v", err)
+			}
+
+			header, parts := parseMessage(t, data)
+			if got := header.Get("To"); got != "jb@example.com" {
+				t.Errorf("To = %q", got)
+			}
+			if got, ok := header["Cc"]; ok {
+				t.Errorf("Cc = %q; want no Cc header for empty addresses", got)
+			}
+			if got := header.Get("Reply-To"); got != "team@example.com" {
+				t.Errorf("Reply-To = %q", got)
+			}
+			if got := header.Get("Message-ID"); got != "<test@example.com>" {
+				t.Errorf("Message-ID = %q", got)
+			}
+			if subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject")); err != nil || subject != msg.Subject {
+				t.Errorf("Subject = %q, %v; want %q", subject, err, msg.Subject)
+			}
+			if mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type")); mediaType != tt.wantType {
+				t.Errorf("Content-Type = %q; want %s", mediaType, tt.wantType)
+			}
+
+			// The HTML body comes first, followed by each attachment in order
+			if len(parts) != 1+len(tt.attachments) {
+				t.Fatalf("got %d parts; want %d", len(parts), 1+len(tt.attachments))
+			}
+			if mediaType, _, _ := mime.ParseMediaType(parts[0].ContentType); mediaType != "text/html" {
+				t.Errorf("body Content-Type = %q; want text/html", parts[0].ContentType)
+			}
+			if string(parts[0].Body) != html {
+				t.Errorf("body = %q; want %q", parts[0].Body, html)
+			}
+
+			for i, attachment := range tt.attachments {
+				part := parts[i+1]
+
+				wantType, wantParams, _ := mime.ParseMediaType(attachment.ContentType)
+				mediaType, params, err := mime.ParseMediaType(part.ContentType)
+				if err != nil || mediaType != wantType {
+					t.Errorf("%s Content-Type = %q; want %s", attachment.Filename, part.ContentType, wantType)
+				}
+				for key, value := range wantParams {
+					if params[key] != value {
+						t.Errorf("%s Content-Type %s = %q; want %q", attachment.Filename, key, params[key], value)
+					}
+				}
+				if params["name"] != attachment.Filename {
+					t.Errorf("%s Content-Type name = %q", attachment.Filename, params["name"])
+				}
+
+				disposition, params, err := mime.ParseMediaType(part.Disposition)
+				if err != nil || disposition != "attachment" || params["filename"] != attachment.Filename {
+					t.Errorf("%s Content-Disposition = %q", attachment.Filename, part.Disposition)
+				}
+				if !bytes.Equal(part.Body, attachment.Data) {
+					t.Errorf("%s data doesn't round-trip", attachment.Filename)
+				}
+			}
+		})
+	}
+}
+
+func TestMessageBytesInvalidAttachment(t *testing.T) {
+	msg := Message{
+		From:        "reservations@example.com",
+		To:          []string{"jb@example.com"},
+		HTML:        "<p>Hi</p>",
+		Attachments: []Attachment{{Filename: "broken", ContentType: "not a content type;", Data: []byte("x")}},
+	}
+	if _, err := msg.Bytes("<test@example.com>"); err == nil {
+		t.Fatal("Bytes succeeded with an invalid attachment content type")
+	}
+}
+
+func TestMemoryMailer(t *testing.T) {
+	m := NewMemoryMailer()
+	ctx := context.Background()
+
+	first := Message{To: []string{"a@example.com"}, Subject: "First"}
+	second := Message{To: []string{"b@example.com"}, Subject: "Second", Attachments: []Attachment{{Filename: "screening.ics"}}}
+
+	firstID, err := m.Send(ctx, first)
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	secondID, err := m.Send(ctx, second)
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if firstID == "" || firstID == secondID {
+		t.Errorf("message IDs %q and %q should be unique", firstID, secondID)
+	}
+
+	messages := m.Messages()
+	if len(messages) != 2 || messages[0].Subject != "First" || messages[1].Subject != "Second" {
+		t.Fatalf("Messages() = %+v; want both messages in the order sent", messages)
+	}
+	if len(messages[1].Attachments) != 1 {
+		t.Errorf("attachments weren't kept: %+v", messages[1])
+	}
+
+	// The returned slice is a copy
+	messages[0].Subject = "Changed"
+	if m.Messages()[0].Subject != "First" {
+		t.Error("changing the result of Messages() changed the mailer's messages")
+	}
+
+	m.Reset()
+	if got := m.Messages(); len(got) != 0 {
+		t.Errorf("Messages() after Reset = %+v; want none", got)
+	}
+}
+
+func TestRecipients(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  Message
+		want []string
+	}{
+		{name: "to only", msg: Message{To: []string{"a@example.com"}}, want: []string{"a@example.com"}},
+		{name: "with cc", msg: Message{To: []string{"a@example.com"}, Cc: []string{"b@example.com"}}, want: []string{"a@example.com", "b@example.com"}},
+		{name: "empty cc skipped", msg: Message{To: []string{"a@example.com"}, Cc: []string{""}}, want: []string{"a@example.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.msg.Recipients()
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Recipients() = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
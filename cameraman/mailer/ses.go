@@ -0,0 +1,67 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// Sends email through AWS SES using the default AWS config, e.g. AWS_REGION
+type SESMailer struct {
+	client *sesv2.Client
+}
+
+func NewSESMailer(ctx context.Context) (*SESMailer, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	return &SESMailer{client: sesv2.NewFromConfig(cfg)}, nil
+}
+
+// Returns the SES message ID
+// Messages with attachments are sent as raw MIME, since SES's simple format only has a body
+func (m *SESMailer) Send(ctx context.Context, msg Message) (string, error) {
+	input := &sesv2.SendEmailInput{
+		FromEmailAddress: aws.String(msg.From),
+		Destination: &types.Destination{
+			ToAddresses: msg.To,
+			CcAddresses: nonEmpty(msg.Cc),
+		},
+		ReplyToAddresses: nonEmpty(msg.ReplyTo),
+		Content: &types.EmailContent{
+			Simple: &types.Message{
+				Subject: &types.Content{
+					Data: aws.String(msg.Subject),
+				},
+				Body: &types.Body{
+					Html: &types.Content{
+						Data: aws.String(msg.HTML),
+					},
+				},
+			},
+		},
+	}
+
+	if len(msg.Attachments) > 0 {
+		data, err := msg.Bytes(newMessageID())
+		if err != nil {
+			return "", err
+		}
+		input.Content = &types.EmailContent{
+			Raw: &types.RawMessage{Data: data},
+		}
+	}
+
+	out, err := m.client.SendEmail(ctx, input)
+	if err != nil {
+		return "", err
+	}
+
+	return aws.ToString(out.MessageId), nil
+}
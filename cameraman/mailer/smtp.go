@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+	"os"
+)
+
+// Sends email through a plain SMTP server, upgrading to TLS when the server supports it
+type SMTPMailer struct {
+	Addr string // host:port
+	Auth smtp.Auth
+}
+
+// Configures an SMTP mailer from SMTP_HOST, SMTP_PORT (default 587), SMTP_USERNAME, and SMTP_PASSWORD
+func NewSMTPMailer() *SMTPMailer {
+	host := os.Getenv("SMTP_HOST")
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	m := &SMTPMailer{Addr: net.JoinHostPort(host, port)}
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		m.Auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	return m
+}
+
+// Returns the generated Message-ID header
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) (string, error) {
+	messageID := newMessageID()
+	data, err := msg.Bytes(messageID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := smtp.SendMail(m.Addr, m.Auth, msg.From, msg.Recipients(), data); err != nil {
+		return "", err
+	}
+	return messageID, nil
+}
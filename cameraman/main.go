@@ -1,9 +1,12 @@
 package main
 
 import (
+	"fmt"
 	"golden-arm/internal"
+	"golden-arm/payments"
 	"golden-arm/routes"
 	"golden-arm/schema"
+	"os"
 
 	// Add this line
 	"github.com/gin-gonic/gin"
@@ -16,6 +19,40 @@ func main() {
 		panic(err)
 	}
 
+	// Subcommands; e.g. `go run . migrate up`
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			runMigrate(os.Args[2:])
+			return
+		case "invite-admin":
+			runInviteAdmin(os.Args[2:])
+			return
+		default:
+			fmt.Fprintln(os.Stderr, "usage: go run . [migrate up|down|status | invite-admin EMAIL NAME]")
+			os.Exit(2)
+		}
+	}
+
+	// Refuse to serve until the database schema is up to date
+	schema.CheckMigrations()
+
+	// Links in emails are signed with TOKEN_SECRET, so refuse to hand out forgeable ones
+	if os.Getenv("TOKEN_SECRET") == "" {
+		panic("TOKEN_SECRET must be set")
+	}
+
+	// Fail now rather than on the first order if payments aren't configured
+	payments.GetProvider()
+
+	// Background jobs
+	internal.StartSessionSweeper()
+	routes.StartEmailWorker()
+	routes.StartWaitlistSweeper()
+	routes.StartStockHoldSweeper()
+	routes.StartPreorderSweeper()
+	routes.StartReminderScheduler()
+
 	router := gin.Default()
 
 	// Error-handling middleware
@@ -29,6 +66,8 @@ func main() {
 				internal.Handle400(c)
 			case internal.ErrUnauthorized:
 				internal.Handle401(c)
+			case internal.ErrForbidden:
+				internal.Handle403(c)
 			case internal.ErrNotFound:
 				internal.Handle404(c)
 			case internal.ErrMethodNotAllowed:
@@ -45,42 +84,94 @@ func main() {
 	router.NoRoute(internal.Handle404)
 	router.NoMethod(internal.Handle405)
 
-	schema.CreateTables()
+	// Role-aware middleware for operator-only routes; admins pass every check
+	anyOperator := internal.RequireRole()
+	admin := internal.RequireRole(schema.RoleAdmin)
+	programmer := internal.RequireRole(schema.RoleProgrammer)
+	shopManager := internal.RequireRole(schema.RoleShopManager)
 
 	// Routes
 	router.GET("/api/movie/:movie_id", routes.GetMovie)
 	router.GET("/api/movie/next", routes.GetNextMovie)
 	router.GET("/api/movie/all", routes.GetAllMovies)
 	router.GET("/api/movie/archive", routes.GetMovieArchive)
-	router.GET("/api/reserved/:movie_id", routes.GetReservedSeats)
-	router.GET("/api/reservations/:movie_id", routes.GetReservations)
-	router.GET("/api/comments", routes.GetComments)
-	router.GET("/api/emails", routes.GetEmails)
+	router.GET("/api/screening/:screening_id", routes.GetScreening)
+	router.GET("/api/screening/:screening_id/seats", routes.GetScreeningSeats)
+	router.GET("/api/screenings/:movie_id", routes.GetScreenings)
+	router.GET("/api/seatmap/:seat_map_id", routes.GetSeatMap)
+	router.GET("/api/seatmap/all", programmer, routes.GetAllSeatMaps)
+	router.GET("/api/reserved/:screening_id", routes.GetReservedSeats)
+	router.GET("/api/reservations/:screening_id", programmer, routes.GetReservations)
+	router.GET("/api/waitlist/:movie_id", programmer, routes.GetWaitlist)
+	router.GET("/api/comments", programmer, routes.GetComments)
+	router.GET("/api/emails", admin, routes.GetEmails)
+	router.GET("/api/outbox", admin, routes.GetOutbox)
 	router.GET("/api/calendar", routes.GetCalendar)
-	router.GET("/api/calendar/all", routes.GetAllCalendars)
+	router.GET("/api/calendar.ics", routes.GetCalendarFeed)
+	router.GET("/api/calendar/all", programmer, routes.GetAllCalendars)
+	router.GET("/api/lookup/:token", routes.GetLookup)
 	router.GET("/api/merch/all", routes.GetAllMerchandise)
-	router.GET("/api/order/all", routes.GetAllOrders)
+	router.GET("/api/order/all", shopManager, routes.GetAllOrders)
+	router.GET("/api/order/unfulfilled", shopManager, routes.GetUnfulfilledOrders)
+	router.GET("/api/order/pickup/:code", anyOperator, routes.GetPickupOrder)
+	router.GET("/api/poster/all", routes.GetAllPosters)
+	router.GET("/api/promo/all", shopManager, routes.GetAllPromoCodes)
+	router.GET("/api/inventory/movements", shopManager, routes.GetInventoryMovements)
+	router.GET("/api/payments/attention", shopManager, routes.GetPaymentsNeedingAttention)
+	router.GET("/api/inventory/reconcile", shopManager, routes.ReconcileInventory)
+	router.GET("/api/operator/all", admin, routes.GetAllOperators)
+	router.GET("/api/audit", admin, routes.GetAuditLog)
 
 	router.POST("/api/reserve", routes.Reserve)
-	router.POST("/api/movie", routes.AddMovie)
+	router.POST("/api/reservation/cancel/:token", routes.CancelReservation)
+	router.POST("/api/lookup", routes.RequestLookupLink)
+	router.POST("/api/lookup/:token/order/:order_id/cancel", routes.CancelLookupOrder)
+	router.POST("/api/waitlist", routes.JoinWaitlist)
+	router.POST("/api/waitlist/claim/:token", routes.ClaimWaitlistOffer)
+	router.POST("/api/movie", programmer, routes.AddMovie)
+	router.POST("/api/screening", programmer, routes.AddScreening)
+	router.POST("/api/seatmap", programmer, routes.AddSeatMap)
 	router.POST("/api/comment", routes.SubmitComment)
-	router.POST("/api/calendar", routes.AddCalendar)
+	router.POST("/api/outbox/:email_id/resend", admin, routes.ResendEmail)
+	router.POST("/api/calendar", programmer, routes.AddCalendar)
 	router.POST("/api/admin/login", routes.AdminLogin)
 	router.POST("/api/admin/logout", routes.AdminLogout)
+	router.POST("/api/admin/logout-all", anyOperator, routes.AdminLogoutAll)
 	router.POST("/api/admin/validate-session", routes.ValidateSession)
-	router.POST("/api/merch", routes.AddMerchandise)
+	router.POST("/api/operator/invite", admin, routes.InviteOperator)
+	router.POST("/api/operator/accept", routes.AcceptOperatorInvite)
+	router.POST("/api/merch", shopManager, routes.AddMerchandise)
+	router.POST("/api/hold", routes.CreateHold)
+	router.POST("/api/poster", shopManager, routes.AddPoster)
+	router.POST("/api/promo", shopManager, routes.AddPromoCode)
+	router.POST("/api/inventory/movement", shopManager, routes.AddInventoryMovement)
 	router.POST("/api/order", routes.AddOrder)
+	router.POST("/api/order/:order_id/checkout", routes.CreateCheckout)
+	router.POST("/api/order/:order_id/refund", shopManager, routes.RefundOrderItems)
+	router.POST("/api/order/pickup/:code", anyOperator, routes.FulfilOrder)
+	router.POST("/api/payments/webhook", routes.PaymentWebhook)
 
-	router.PUT("/api/merch/:merch_id", routes.UpdateMerchandise)
-	router.PUT("/api/order/status/:order_id", routes.UpdateOrderStatus)
-	router.PUT("/api/movie/:movie_id", routes.UpdateMovie)
+	router.PUT("/api/merch/:merch_id", shopManager, routes.UpdateMerchandise)
+	router.PUT("/api/hold/:hold_token", routes.UpdateHold)
+	router.PUT("/api/poster/:poster_id", shopManager, routes.UpdatePoster)
+	router.PUT("/api/order/status/:order_id", shopManager, routes.UpdateOrderStatus)
+	router.PUT("/api/promo/:promo_id", shopManager, routes.UpdatePromoCode)
+	router.PUT("/api/movie/:movie_id", programmer, routes.UpdateMovie)
+	router.PUT("/api/screening/:screening_id", programmer, routes.UpdateScreening)
+	router.PUT("/api/seatmap/:seat_map_id", programmer, routes.UpdateSeatMap)
+	router.PUT("/api/operator/:operator_id", admin, routes.UpdateOperator)
 
-	router.DELETE("/api/movie/:movie_id", routes.DeleteMovie)
-	router.DELETE("/api/reservation/:reservation_id", routes.DeleteReservation)
-	router.DELETE("/api/comment/:comment_id", routes.DeleteComment)
-	router.DELETE("/api/calendar/:calendar_id", routes.DeleteCalendar)
-	router.DELETE("/api/merch/:merch_id", routes.DeleteMerchandise)
-	router.DELETE("/api/order/:order_id", routes.DeleteOrder)
+	router.DELETE("/api/movie/:movie_id", programmer, routes.DeleteMovie)
+	router.DELETE("/api/screening/:screening_id", programmer, routes.DeleteScreening)
+	router.DELETE("/api/seatmap/:seat_map_id", programmer, routes.DeleteSeatMap)
+	router.DELETE("/api/reservation/:reservation_id", programmer, routes.DeleteReservation)
+	router.DELETE("/api/comment/:comment_id", programmer, routes.DeleteComment)
+	router.DELETE("/api/calendar/:calendar_id", programmer, routes.DeleteCalendar)
+	router.DELETE("/api/merch/:merch_id", shopManager, routes.DeleteMerchandise)
+	router.DELETE("/api/hold/:hold_token", routes.ReleaseHold)
+	router.DELETE("/api/poster/:poster_id", shopManager, routes.DeletePoster)
+	router.DELETE("/api/order/:order_id", shopManager, routes.DeleteOrder)
+	router.DELETE("/api/promo/:promo_id", shopManager, routes.DeletePromoCode)
 
 	router.Run(":8080")
 }
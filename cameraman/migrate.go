@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"golden-arm/schema"
+	"log"
+	"os"
+)
+
+// Handles the `migrate` subcommand
+//
+//	go run . migrate up      applies all pending migrations, each in its own group
+//	go run . migrate down    rolls back the most recently applied migration
+//	go run . migrate status  lists every migration and whether it has been applied
+func runMigrate(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: migrate up|down|status")
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		groups, err := schema.MigrateUp(ctx)
+		for _, group := range groups {
+			log.Printf("✅ Applied %s", group)
+		}
+		if err != nil {
+			log.Fatalf("Failed to apply migrations: %v", err)
+		}
+		if len(groups) == 0 {
+			log.Println("No pending migrations.")
+		}
+
+	case "down":
+		group, err := schema.MigrateDown(ctx)
+		if err != nil {
+			log.Fatalf("Failed to roll back migrations: %v", err)
+		}
+		if group.IsZero() {
+			log.Println("No migrations to roll back.")
+			return
+		}
+		log.Printf("✅ Rolled back %s", group)
+
+	case "status":
+		migrations, err := schema.MigrationStatus(ctx)
+		if err != nil {
+			log.Fatalf("Failed to get migration status: %v", err)
+		}
+		for _, m := range migrations {
+			if m.IsApplied() {
+				fmt.Printf("applied  %s (group %d, %s)\n", m, m.GroupID, m.MigratedAt.Format("2006-01-02 15:04:05"))
+			} else {
+				fmt.Printf("pending  %s\n", m)
+			}
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, "usage: migrate up|down|status")
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,126 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidAmount = errors.New("invalid amount of money")
+
+// An amount of money in cents, so sums never pick up floating-point error
+// Encoded in JSON as a decimal number of dollars, e.g. 12.50
+type Money int64
+
+// Currency the shop's prices are in, from SHOP_CURRENCY (default "USD")
+func Currency() string {
+	if currency := os.Getenv("SHOP_CURRENCY"); currency != "" {
+		return strings.ToUpper(currency)
+	}
+	return "USD"
+}
+
+// Makes an amount from whole dollars and cents, e.g. FromParts(12, 50) is 12.50
+func FromParts(dollars int64, cents int64) Money {
+	return Money(dollars*100 + cents)
+}
+
+// Parses a decimal amount such as "12", "12.5", or "12.50" exactly; more than two decimal places is an error
+func Parse(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, fraction, _ := strings.Cut(s, ".")
+	if whole == "" || len(fraction) > 2 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	dollars, err := strconv.ParseUint(whole, 10, 62)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	var cents uint64
+	if fraction != "" {
+		fraction += strings.Repeat("0", 2-len(fraction))
+		cents, err = strconv.ParseUint(fraction, 10, 8)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+		}
+	}
+
+	amount := FromParts(int64(dollars), int64(cents))
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+// The amount in cents, e.g. for a payment provider
+func (m Money) Cents() int64 {
+	return int64(m)
+}
+
+// The cost of quantity of something priced at m
+func (m Money) Times(quantity int) Money {
+	return m * Money(quantity)
+}
+
+// percent% of the amount, rounded to the nearest cent
+func (m Money) Percent(percent int) Money {
+	product := int64(m) * int64(percent)
+	if product < 0 {
+		return Money((product - 50) / 100)
+	}
+	return Money((product + 50) / 100)
+}
+
+// The smaller of two amounts
+func Min(a Money, b Money) Money {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// The amount as a decimal, e.g. "12.50"
+func (m Money) String() string {
+	sign := ""
+	if m < 0 {
+		sign = "-"
+		m = -m
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, m/100, m%100)
+}
+
+// The amount for showing to customers, e.g. "$12.50", or "12.50 EUR" for currencies without a symbol here
+func (m Money) Format(currency string) string {
+	switch strings.ToUpper(currency) {
+	case "USD":
+		if m < 0 {
+			return "-$" + (-m).String()
+		}
+		return "$" + m.String()
+	default:
+		return m.String() + " " + strings.ToUpper(currency)
+	}
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// Accepts a JSON number or string; numbers are read from their text, never through a float
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := strings.Trim(string(data), `"`)
+	if text == "null" {
+		return nil
+	}
+	amount, err := Parse(text)
+	if err != nil {
+		return err
+	}
+	*m = amount
+	return nil
+}
@@ -0,0 +1,80 @@
+package money
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Money
+		wantErr bool
+	}{
+		{input: "12", want: 1200},
+		{input: "12.5", want: 1250},
+		{input: "12.50", want: 1250},
+		{input: "12.", want: 1200},
+		{input: " 7.25 ", want: 725},
+		{input: "0.05", want: 5},
+		{input: "-0.05", want: -5},
+		{input: "-12.5", want: -1250},
+		{input: "1.234", wantErr: true},
+		{input: ".5", wantErr: true},
+		{input: "", wantErr: true},
+		{input: "-", wantErr: true},
+		{input: "--5", wantErr: true},
+		{input: "+5", wantErr: true},
+		{input: "1.-5", wantErr: true},
+		{input: "1e3", wantErr: true},
+		{input: "twelve", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAmount) {
+					t.Fatalf("Parse(%q) = %v, %v; want ErrInvalidAmount", tt.input, got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("Parse(%q) = %v, %v; want %v", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Money
+		wantErr bool
+	}{
+		{input: `12.5`, want: 1250},
+		{input: `"12.50"`, want: 1250},
+		{input: `-0.05`, want: -5},
+		{input: `0.1`, want: 10},  // Not 0.1 as a float, which is slightly less
+		{input: `null`, want: 99}, // Left as it was
+		{input: `1.234`, wantErr: true},
+		{input: `".5"`, wantErr: true},
+		{input: `1e3`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := Money(99)
+			err := got.UnmarshalJSON([]byte(tt.input))
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAmount) {
+					t.Fatalf("UnmarshalJSON(%s) = %v, %v; want ErrInvalidAmount", tt.input, got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("UnmarshalJSON(%s) = %v, %v; want %v", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"golden-arm/routes"
+	"golden-arm/schema"
+	"log"
+	"os"
+)
+
+// Handles the `invite-admin` subcommand, which bootstraps the first admin
+// Prints the invite link instead of emailing it
+//
+//	go run . invite-admin jb@example.com "Joey B"
+func runInviteAdmin(args []string) {
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: invite-admin EMAIL NAME")
+		os.Exit(2)
+	}
+
+	operator, token, err := routes.NewOperatorInvite(context.Background(), schema.GetDBConn(), args[0], args[1], schema.RoleAdmin)
+	if err != nil {
+		log.Fatalf("Failed to invite admin: %v", err)
+	}
+
+	log.Printf("✅ Invited %s as an admin; the invite expires %s", operator.Email, operator.InviteExpiresAt.Format("2006-01-02 15:04"))
+	fmt.Println(routes.OperatorInviteURL(token))
+}
@@ -0,0 +1,71 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// Stands in for a real provider during local development; nothing is charged
+// Checkout URLs go nowhere, so payments are simulated by posting signed events to the webhook:
+//
+//	payload='{"id":"evt_1","type":"paid","order_id":"ORDER_ID","payment_id":"pay_1","amount":2500}'
+//	curl -X POST http://localhost:8080/api/payments/webhook -d "$payload" \
+//		-H "Fake-Signature: $(printf '%s' "$payload" | openssl dgst -sha256 -hmac "$PAYMENT_WEBHOOK_SECRET" -r | cut -d' ' -f1)"
+type FakeProvider struct {
+	webhookSecret string
+}
+
+func NewFakeProvider(webhookSecret string) *FakeProvider {
+	return &FakeProvider{webhookSecret: webhookSecret}
+}
+
+func (p *FakeProvider) CreateCheckout(ctx context.Context, req CheckoutRequest) (*CheckoutSession, error) {
+	id := "fake_cs_" + uuid.New().String()
+	return &CheckoutSession{
+		ID:  id,
+		URL: fmt.Sprintf("https://checkout.invalid/%s?order_id=%s&amount=%d", id, req.OrderID, req.Total()),
+	}, nil
+}
+
+func (p *FakeProvider) ParseWebhook(payload []byte, header http.Header) (*Event, error) {
+	signature, err := hex.DecodeString(header.Get("Fake-Signature"))
+	if err != nil || !hmac.Equal(signature, p.Sign(payload)) {
+		return nil, ErrInvalidSignature
+	}
+
+	var event struct {
+		ID        string    `json:"id"`
+		Type      string    `json:"type"`
+		OrderID   uuid.UUID `json:"order_id"`
+		PaymentID string    `json:"payment_id"`
+		Amount    int64     `json:"amount"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil || event.ID == "" {
+		return nil, ErrMalformedEvent
+	}
+	if event.Type != EventPaid && event.Type != EventRefunded {
+		event.Type = EventIgnored
+	}
+
+	return &Event{
+		ID:        event.ID,
+		Type:      event.Type,
+		OrderID:   event.OrderID,
+		PaymentID: event.PaymentID,
+		Amount:    event.Amount,
+	}, nil
+}
+
+// Signs a webhook payload the way ParseWebhook expects
+func (p *FakeProvider) Sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(p.webhookSecret))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
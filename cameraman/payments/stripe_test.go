@@ -0,0 +1,115 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Signs a payload the way Stripe does, returning the hex signature
+func stripeSignature(secret string, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySignature(t *testing.T) {
+	const secret = "whsec_test"
+	payload := []byte(`{"id":"evt_123","type":"checkout.session.completed"}`)
+	provider := &StripeProvider{webhookSecret: secret}
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	recent := strconv.FormatInt(time.Now().Add(-stripeSignatureTolerance+time.Minute).Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-stripeSignatureTolerance-time.Minute).Unix(), 10)
+	future := strconv.FormatInt(time.Now().Add(stripeSignatureTolerance+time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name    string
+		header  string
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			header: fmt.Sprintf("t=%s,v1=%s", now, stripeSignature(secret, now, payload)),
+		},
+		{
+			name:   "within tolerance",
+			header: fmt.Sprintf("t=%s,v1=%s", recent, stripeSignature(secret, recent, payload)),
+		},
+		{
+			name:   "one of several signatures matches",
+			header: fmt.Sprintf("t=%s,v1=%s,v1=%s,v0=ignored", now, stripeSignature("whsec_old", now, payload), stripeSignature(secret, now, payload)),
+		},
+		{
+			name:    "older than tolerance",
+			header:  fmt.Sprintf("t=%s,v1=%s", stale, stripeSignature(secret, stale, payload)),
+			wantErr: true,
+		},
+		{
+			name:    "further ahead than tolerance",
+			header:  fmt.Sprintf("t=%s,v1=%s", future, stripeSignature(secret, future, payload)),
+			wantErr: true,
+		},
+		{
+			name:    "wrong secret",
+			header:  fmt.Sprintf("t=%s,v1=%s", now, stripeSignature("whsec_other", now, payload)),
+			wantErr: true,
+		},
+		{
+			name:    "signed with another timestamp",
+			header:  fmt.Sprintf("t=%s,v1=%s", now, stripeSignature(secret, recent, payload)),
+			wantErr: true,
+		},
+		{
+			name:    "signed another payload",
+			header:  fmt.Sprintf("t=%s,v1=%s", now, stripeSignature(secret, now, []byte(`{}`))),
+			wantErr: true,
+		},
+		{
+			name:    "signature not hex",
+			header:  fmt.Sprintf("t=%s,v1=not-hex", now),
+			wantErr: true,
+		},
+		{
+			name:    "no timestamp",
+			header:  fmt.Sprintf("v1=%s", stripeSignature(secret, now, payload)),
+			wantErr: true,
+		},
+		{
+			name:    "timestamp not a number",
+			header:  fmt.Sprintf("t=soon,v1=%s", stripeSignature(secret, "soon", payload)),
+			wantErr: true,
+		},
+		{
+			name:    "no signature",
+			header:  fmt.Sprintf("t=%s", now),
+			wantErr: true,
+		},
+		{
+			name:    "empty header",
+			header:  "",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := provider.verifySignature(payload, tt.header)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidSignature) {
+					t.Fatalf("verifySignature() = %v; want ErrInvalidSignature", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifySignature() = %v; want nil", err)
+			}
+		})
+	}
+}
@@ -3,23 +3,27 @@ package routes
 import (
 	"context"
 	"crypto/rand"
+	"database/sql"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"golden-arm/internal"
 	"golden-arm/schema"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type AdminLoginRequest struct {
-	Passkey string `json:"passkey"`
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
 }
 
-// Generates a secure random session token
-func generateSessionToken() (string, error) {
+// Generates a secure random token, e.g. for sessions and emailed links
+func generateSecureToken() (string, error) {
 	bytes := make([]byte, 32)
 	if _, err := rand.Read(bytes); err != nil {
 		return "", err
@@ -27,6 +31,12 @@ func generateSessionToken() (string, error) {
 	return base64.URLEncoding.EncodeToString(bytes), nil
 }
 
+/*
+Logs an operator in with their email and password
+
+	curl -X POST http://localhost:8080/api/admin/login -H "Content-Type: application/json" \
+	-d '{"email":"jb@example.com","password":"correct horse battery staple"}'
+*/
 func AdminLogin(c *gin.Context) {
 	var request AdminLoginRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -35,28 +45,44 @@ func AdminLogin(c *gin.Context) {
 		return
 	}
 
-	// Validate password
-	if request.Passkey != os.Getenv("ADMIN_PASSKEY") {
-		fmt.Println("Invalid passkey")
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	var operator schema.Operator
+	err := db.NewSelect().
+		Model(&operator).
+		Where("lower(email) = lower(?)", request.Email).
+		Where("disabled_at IS NULL AND password_hash IS NOT NULL").
+		Scan(ctx)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		fmt.Printf("Error fetching operator: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	// Validate password; unknown emails get the same response as wrong passwords
+	if err != nil || bcrypt.CompareHashAndPassword([]byte(operator.PasswordHash), []byte(request.Password)) != nil {
+		fmt.Println("Invalid email or password")
 		c.AbortWithError(http.StatusUnauthorized, internal.ErrUnauthorized)
 		return
 	}
 
-	sessionToken, err := generateSessionToken()
+	sessionToken, err := generateSecureToken()
 	if err != nil {
 		fmt.Println("Failed to generate session token:", err)
 		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
 		return
 	}
 
-	// Store the session in an in-memory store
-	internal.StoreSession(sessionToken, "admin", time.Now().Add(1*time.Hour))
+	// Store the session in the database; it expires after 1 hr without use
+	internal.StoreSession(sessionToken, operator.ID.String(), time.Now().Add(1*time.Hour))
 
-	// Set a cookie for session validation with lifetime 3600s = 1 hr
+	// Set a cookie for session validation that lasts as long as the session possibly can
+	// The server decides when the session has actually expired
 	// For production:
 	//     change localhost to site domain
 	//     change `secure` from false to true to only send cookie over https
-	c.SetCookie("sessionToken", sessionToken, 3600, "/", "localhost", false, true)
+	c.SetCookie("sessionToken", sessionToken, int(internal.MaxSessionAge.Seconds()), "/", "localhost", false, true)
 
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Login successful"})
 }
@@ -71,21 +97,61 @@ func AdminLogout(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Logout successful"})
 }
 
-// Validates session token
-func ValidateSession(c *gin.Context) {
-	sessionToken, err := c.Cookie("sessionToken")
+/*
+Logs the current operator out of every session, e.g. after a lost laptop
+Logs everyone out when authorized with the API key
+
+	curl -X POST http://localhost:8080/api/admin/logout-all -H "Authorization: Bearer YOUR API KEY"
+*/
+func AdminLogoutAll(c *gin.Context) {
+	var deleted int64
+	var err error
+	operator := internal.GetOperator(c)
+	if operator.ID != uuid.Nil {
+		deleted, err = internal.DeleteUserSessions(operator.ID.String())
+	} else {
+		deleted, err = internal.DeleteAllSessions()
+	}
 	if err != nil {
+		fmt.Printf("Error deleting sessions: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	// Sessions are keyed by token, so the entry is about whose sessions were deleted
+	// The sessions are already gone, so a failure here is only logged
+	err = recordAudit(context.Background(), schema.GetDBConn(), c, schema.AuditDelete, "session", operator.ID, gin.H{"sessions": deleted}, nil)
+	if err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+	}
+	c.SetCookie("sessionToken", "", -1, "/", "localhost", false, true)
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": fmt.Sprintf("Logged out of %d sessions", deleted)})
+}
+
+// Validates session token and returns who it belongs to
+func ValidateSession(c *gin.Context) {
+	if _, err := c.Cookie("sessionToken"); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"valid": false, "message": "Invalid request"})
 		return
 	}
 
-	isValid := internal.ValidateSession(sessionToken)
-	if !isValid {
+	operator := internal.GetOperator(c)
+	if operator == nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"valid": false, "message": "Invalid session"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"valid": true, "message": "Session is valid"})
+	c.JSON(http.StatusOK, gin.H{
+		"valid":   true,
+		"message": "Session is valid",
+		"operator": gin.H{
+			"id":    operator.ID,
+			"name":  operator.Name,
+			"email": operator.Email,
+			"role":  operator.Role,
+		},
+	})
 }
 
 /*
@@ -94,11 +160,6 @@ Gets list of all unique emails of anyone who has made a reservation, commented,
 	curl -X GET http://localhost:8080/api/emails -H "Authorization: Bearer DO NOT USE IN PRODUCTION"
 */
 func GetEmails(c *gin.Context) {
-	if !internal.CheckAuthorization(c) {
-		c.AbortWithError(http.StatusUnauthorized, internal.ErrUnauthorized)
-		return
-	}
-
 	db := schema.GetDBConn()
 	ctx := context.Background()
 
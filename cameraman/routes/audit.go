@@ -0,0 +1,168 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"golden-arm/internal"
+	"golden-arm/schema"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+// Most audit entries returned by one request
+const maxAuditEntries = 500
+
+// Converts an entity to its JSON fields so it can be diffed and stored
+func auditFields(entity any) (map[string]any, error) {
+	if entity == nil || (reflect.ValueOf(entity).Kind() == reflect.Pointer && reflect.ValueOf(entity).IsNil()) {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// Records a change made by the operator behind the request; pass the handler's transaction so the entry
+// is only kept if the change commits
+// before is nil for created entities and after is nil for deleted ones; for updates only changed fields are kept
+func recordAudit(ctx context.Context, db bun.IDB, c *gin.Context, action string, entityType string, entityID any, before any, after any) error {
+	beforeFields, err := auditFields(before)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit before state: %w", err)
+	}
+	afterFields, err := auditFields(after)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit after state: %w", err)
+	}
+
+	// Drop fields that didn't change
+	if beforeFields != nil && afterFields != nil {
+		for key, value := range beforeFields {
+			if otherValue, exists := afterFields[key]; exists && reflect.DeepEqual(value, otherValue) {
+				delete(beforeFields, key)
+				delete(afterFields, key)
+			}
+		}
+	}
+
+	entry := schema.AuditEntry{
+		ID:         uuid.New(),
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   fmt.Sprint(entityID),
+		Before:     beforeFields,
+		After:      afterFields,
+		IP:         c.ClientIP(),
+		Date:       time.Now(),
+	}
+	if operator := internal.GetOperator(c); operator != nil {
+		entry.ActorID = operator.ID
+		entry.ActorName = operator.Name
+	}
+
+	_, err = db.NewInsert().
+		Model(&entry).
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
+
+/*
+Gets the audit log, most recent first
+Optionally filtered by actor_id, action, entity_type, entity_id, and a since/until date range (RFC 3339)
+Pages with limit (default and max 500) and offset
+
+	curl -X GET "http://localhost:8080/api/audit?entity_type=movie&since=2025-01-01T00:00:00Z&limit=50" \
+	-H "Authorization: Bearer YOUR API KEY"
+*/
+func GetAuditLog(c *gin.Context) {
+	var entries []schema.AuditEntry
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	query := db.NewSelect().
+		Model(&entries).
+		Order("date DESC")
+
+	if param := c.Query("actor_id"); param != "" {
+		actorID, err := uuid.Parse(param)
+		if err != nil {
+			fmt.Println("actor_id must be a valid UUID")
+			c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+			return
+		}
+		query = query.Where("actor_id = ?", actorID)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if entityType := c.Query("entity_type"); entityType != "" {
+		query = query.Where("entity_type = ?", entityType)
+	}
+	if entityID := c.Query("entity_id"); entityID != "" {
+		query = query.Where("entity_id = ?", entityID)
+	}
+	for param, condition := range map[string]string{"since": "date >= ?", "until": "date < ?"} {
+		if value := c.Query(param); value != "" {
+			date, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				fmt.Printf("%s must be an RFC 3339 date", param)
+				c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+				return
+			}
+			query = query.Where(condition, date)
+		}
+	}
+
+	limit := maxAuditEntries
+	if param := c.Query("limit"); param != "" {
+		var err error
+		limit, err = strconv.Atoi(param)
+		if err != nil || limit <= 0 || limit > maxAuditEntries {
+			fmt.Printf("limit must be between 1 and %d", maxAuditEntries)
+			c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+			return
+		}
+	}
+	offset := 0
+	if param := c.Query("offset"); param != "" {
+		var err error
+		offset, err = strconv.Atoi(param)
+		if err != nil || offset < 0 {
+			fmt.Println("offset must be a non-negative integer")
+			c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+			return
+		}
+	}
+
+	err := query.
+		Limit(limit).
+		Offset(offset).
+		Scan(ctx)
+	if err != nil {
+		fmt.Printf("Error fetching audit log: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	if entries == nil {
+		entries = []schema.AuditEntry{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": entries})
+}
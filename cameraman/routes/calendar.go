@@ -26,11 +26,6 @@ Gets all calendars in the database
 	curl -X GET http://localhost:8080/api/calendar/all -H "Authorization: Bearer YOUR API KEY"
 */
 func GetAllCalendars(c *gin.Context) {
-	if !internal.CheckAuthorization(c) {
-		c.AbortWithError(http.StatusUnauthorized, internal.ErrUnauthorized)
-		return
-	}
-
 	var calendars []schema.Calendar
 	db := schema.GetDBConn()
 	ctx := context.Background()
@@ -118,11 +113,6 @@ For file upload submissions:
 		-F "image=@/path/to/image.jpg"
 */
 func AddCalendar(c *gin.Context) {
-	if !internal.CheckAuthorization(c) {
-		c.AbortWithError(http.StatusUnauthorized, internal.ErrUnauthorized)
-		return
-	}
-
 	// Check if the request is multipart/form-data for file uploads
 	contentType := c.Request.Header.Get("Content-Type")
 	isMultipart := strings.HasPrefix(contentType, "multipart/form-data")
@@ -205,8 +195,17 @@ func AddCalendar(c *gin.Context) {
 		return
 	}
 
+	// Begin transaction
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	// Ensure rollback if error occurs
+	defer tx.Rollback()
+
 	// Insert the new calendar into the database
-	_, err = db.NewInsert().
+	_, err = tx.NewInsert().
 		Model(&calendar).
 		Exec(ctx)
 	if err != nil {
@@ -215,6 +214,17 @@ func AddCalendar(c *gin.Context) {
 		return
 	}
 
+	if err := recordAudit(ctx, tx, c, schema.AuditCreate, "calendar", calendar.ID, nil, calendar); err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Calendar added successfully"})
 }
 
@@ -225,11 +235,6 @@ Deletes calendar from database
 	-H "Authorization: Bearer YOUR API KEY"
 */
 func DeleteCalendar(c *gin.Context) {
-	if !internal.CheckAuthorization(c) {
-		c.AbortWithError(http.StatusUnauthorized, internal.ErrUnauthorized)
-		return
-	}
-
 	// Ensure calendar_id is provided and is a valid UUID
 	param := c.Param("calendar_id")
 	if param == "" {
@@ -247,10 +252,21 @@ func DeleteCalendar(c *gin.Context) {
 	db := schema.GetDBConn()
 	ctx := context.Background()
 
-	// Delete the calendar from the database
-	result, err := db.NewDelete().
-		Model((*schema.Calendar)(nil)).
+	// Begin transaction
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	// Ensure rollback if error occurs
+	defer tx.Rollback()
+
+	// Delete the calendar from the database, keeping what was deleted for the audit log
+	var calendar schema.Calendar
+	result, err := tx.NewDelete().
+		Model(&calendar).
 		Where("id = ?", calendarID).
+		Returning("*").
 		Exec(ctx)
 
 	if err != nil {
@@ -265,5 +281,16 @@ func DeleteCalendar(c *gin.Context) {
 		return
 	}
 
+	if err := recordAudit(ctx, tx, c, schema.AuditDelete, "calendar", calendarID, calendar, nil); err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Calendar deleted successfully"})
 }
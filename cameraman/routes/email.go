@@ -0,0 +1,79 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"golden-arm/mailer"
+	"golden-arm/schema"
+	"html/template"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+//go:embed templates/*
+var emailTemplates embed.FS
+
+// Fills in an HTML email template from the templates directory
+func renderEmailTemplate(name string, funcs template.FuncMap, data any) (string, error) {
+	base := template.New(name)
+	if funcs != nil {
+		base.Funcs(funcs)
+	}
+	tmpl, err := base.ParseFS(emailTemplates, "templates/"+name)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse email template: %w", err)
+	}
+
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, data); err != nil {
+		return "", fmt.Errorf("failed to execute email template: %w", err)
+	}
+	return body.String(), nil
+}
+
+// Queues an HTML email in the outbox; pass the open transaction so the email is only sent if it commits
+func queueEmail(ctx context.Context, db bun.IDB, from string, to string, subject string, body string, attachments ...mailer.Attachment) error {
+	now := time.Now()
+	email := schema.OutboxEmail{
+		ID:            uuid.New(),
+		Sender:        from,
+		Recipient:     to,
+		Subject:       subject,
+		Body:          body,
+		Attachments:   attachments,
+		Status:        schema.EmailPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+
+	_, err := db.NewInsert().
+		Model(&email).
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to queue email: %w", err)
+	}
+	return nil
+}
+
+// Sends an HTML email through the configured mailer and returns the message ID
+// REPLYTO is used as the reply-to address and copied on every email
+func sendEmail(ctx context.Context, from string, to string, subject string, body string, attachments []mailer.Attachment) (string, error) {
+	replyTo := os.Getenv("REPLYTO")
+	cc := replyTo // Optional: admin copy
+
+	return mailer.GetMailer().Send(ctx, mailer.Message{
+		From:    from,
+		To:      []string{to},
+		Cc:      []string{cc},
+		ReplyTo: []string{replyTo},
+		Subject: subject,
+		HTML:    body,
+
+		Attachments: attachments,
+	})
+}
@@ -0,0 +1,375 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"golden-arm/internal"
+	"golden-arm/money"
+	"golden-arm/schema"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+// How long a cart's stock is held when STOCK_HOLD_WINDOW is unset or invalid
+const defaultHoldWindow = 15 * time.Minute
+
+// How often lapsed stock holds are expired
+const holdSweepInterval = time.Minute
+
+var (
+	ErrHoldNotActive  = errors.New("stock hold is no longer active")
+	ErrCannotHoldItem = errors.New("can't hold items")
+)
+
+type HoldRequest struct {
+	Items []OrderItem `json:"items"`
+}
+
+type HoldResponse struct {
+	HoldToken string      `json:"hold_token"` // Pass to AddOrder to buy the held items
+	ExpiresAt time.Time   `json:"expires_at"`
+	Subtotal  money.Money `json:"subtotal"`
+	Currency  string      `json:"currency"`
+}
+
+// Identifies a merchandise variant, or a poster size by movie and size
+type stockKey struct {
+	VariantID uuid.UUID
+	MovieID   uuid.UUID
+	Size      string
+}
+
+// Returns how long a shopper's cart is held, e.g. STOCK_HOLD_WINDOW=10m
+func stockHoldWindow() time.Duration {
+	window, err := time.ParseDuration(os.Getenv("STOCK_HOLD_WINDOW"))
+	if err != nil || window <= 0 {
+		return defaultHoldWindow
+	}
+	return window
+}
+
+// Sums the quantities in active holds by merchandise variant or poster size
+func getHeldStock(ctx context.Context, db bun.IDB) (map[stockKey]int, error) {
+	var rows []struct {
+		VariantID *uuid.UUID `bun:"variant_id"`
+		MovieID   *uuid.UUID `bun:"movie_id"`
+		Size      string     `bun:"size"`
+		Quantity  int        `bun:"quantity"`
+	}
+	err := db.NewSelect().
+		Model((*schema.StockHoldItem)(nil)).
+		ColumnExpr("stock_hold_item.variant_id, stock_hold_item.movie_id, stock_hold_item.size").
+		ColumnExpr("sum(stock_hold_item.quantity) AS quantity").
+		Join("JOIN stock_holds AS h ON h.id = stock_hold_item.hold_id").
+		Where("h.status = ? AND h.expires_at > ?", schema.HoldActive, time.Now()).
+		GroupExpr("stock_hold_item.variant_id, stock_hold_item.movie_id, stock_hold_item.size").
+		Scan(ctx, &rows)
+	if err != nil {
+		return nil, err
+	}
+
+	held := make(map[stockKey]int, len(rows))
+	for _, row := range rows {
+		var key stockKey
+		if row.VariantID != nil {
+			key.VariantID = *row.VariantID
+		}
+		if row.MovieID != nil {
+			key.MovieID = *row.MovieID
+			key.Size = row.Size
+		}
+		held[key] += row.Quantity
+	}
+	return held, nil
+}
+
+// Sums the quantity of one merchandise variant or poster size in active holds, leaving out excludeHoldID
+// Lock the variant's or size's inventory first so no hold can be placed between counting and selling
+func getHeldQuantity(ctx context.Context, db bun.IDB, key stockKey, excludeHoldID uuid.UUID) (int, error) {
+	query := db.NewSelect().
+		Model((*schema.StockHoldItem)(nil)).
+		ColumnExpr("coalesce(sum(stock_hold_item.quantity), 0)").
+		Join("JOIN stock_holds AS h ON h.id = stock_hold_item.hold_id").
+		Where("h.status = ? AND h.expires_at > ? AND h.id != ?", schema.HoldActive, time.Now(), excludeHoldID)
+	if key.VariantID != uuid.Nil {
+		query = query.Where("stock_hold_item.variant_id = ?", key.VariantID)
+	} else {
+		query = query.Where("stock_hold_item.movie_id = ? AND stock_hold_item.size = ?", key.MovieID, key.Size)
+	}
+
+	var held int
+	err := query.Scan(ctx, &held)
+	return held, err
+}
+
+// Replaces a hold's items with the order items in the cart, checking they're in stock, and returns their subtotal
+// Returns ErrCannotHoldItem if an item doesn't exist or is out of stock
+func setHoldItems(ctx context.Context, tx bun.Tx, holdID uuid.UUID, items []OrderItem) (money.Money, error) {
+	subtotal, _, orderItems, err := processOrderItems(ctx, tx, items, nil, holdID)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrCannotHoldItem, err)
+	}
+
+	_, err = tx.NewDelete().
+		Model((*schema.StockHoldItem)(nil)).
+		Where("hold_id = ?", holdID).
+		Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, item := range orderItems {
+		// Pre-orders don't come out of stock, so there's nothing to hold
+		if item.Preorder {
+			continue
+		}
+		holdItem := schema.StockHoldItem{
+			ID:        uuid.New(),
+			HoldID:    holdID,
+			VariantID: item.VariantID,
+			MovieID:   item.MovieID,
+			Size:      item.Size,
+			Quantity:  item.Quantity,
+		}
+		if _, err := tx.NewInsert().Model(&holdItem).Exec(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	return subtotal, nil
+}
+
+// Looks up and locks the hold a token was issued for
+// Returns ErrHoldNotActive if it's been ordered, released, or has expired
+func lockActiveHold(ctx context.Context, tx bun.Tx, token string) (*schema.StockHold, error) {
+	subject, err := internal.VerifyToken(internal.TokenStockHold, token)
+	if err != nil {
+		return nil, err
+	}
+	holdID, err := uuid.Parse(subject)
+	if err != nil {
+		return nil, internal.ErrInvalidToken
+	}
+
+	var hold schema.StockHold
+	err = tx.NewSelect().
+		Model(&hold).
+		Where("id = ?", holdID).
+		For("UPDATE").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, internal.ErrInvalidToken
+	} else if err != nil {
+		return nil, err
+	}
+
+	if hold.Status != schema.HoldActive || !time.Now().Before(hold.ExpiresAt) {
+		return &hold, ErrHoldNotActive
+	}
+	return &hold, nil
+}
+
+/*
+Holds the items in a shopper's cart for a few minutes (STOCK_HOLD_WINDOW, 15 minutes by default) so nobody else can buy them
+Pass the returned hold_token to AddOrder to buy them
+
+	curl -X POST http://localhost:8080/api/hold \
+		-H "Content-Type: application/json" -d \
+		'{
+			"items": [
+				{
+				"merchandise_id": "00000000-0000-0000-0000-000000000000",
+				"quantity": 1,
+				"size": "XL"
+				}
+			]
+		}'
+*/
+func CreateHold(c *gin.Context) {
+	var request HoldRequest
+	if err := c.ShouldBindJSON(&request); err != nil || len(request.Items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required fields"})
+		return
+	}
+
+	now := time.Now()
+	hold := schema.StockHold{
+		ID:        uuid.New(),
+		Status:    schema.HoldActive,
+		CreatedAt: now,
+		ExpiresAt: now.Add(stockHoldWindow()),
+	}
+
+	// Begin transaction
+	ctx := context.Background()
+	tx, err := schema.GetDBConn().BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	// Ensure rollback if error occurs
+	defer tx.Rollback()
+
+	if _, err := tx.NewInsert().Model(&hold).Exec(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create hold"})
+		return
+	}
+
+	subtotal, err := setHoldItems(ctx, tx, hold.ID, request.Items)
+	if errors.Is(err, ErrCannotHoldItem) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		fmt.Printf("Error holding items: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, HoldResponse{
+		HoldToken: internal.SignToken(internal.TokenStockHold, hold.ID.String(), time.Time{}),
+		ExpiresAt: hold.ExpiresAt,
+		Subtotal:  subtotal,
+		Currency:  money.Currency(),
+	})
+}
+
+/*
+Replaces the items in a held cart and restarts its hold; a lapsed hold has to be created again
+
+	curl -X PUT http://localhost:8080/api/hold/HOLD_TOKEN \
+		-H "Content-Type: application/json" -d \
+		'{
+			"items": [
+				{
+				"merchandise_id": "00000000-0000-0000-0000-000000000000",
+				"quantity": 2,
+				"size": "XL"
+				}
+			]
+		}'
+*/
+func UpdateHold(c *gin.Context) {
+	var request HoldRequest
+	if err := c.ShouldBindJSON(&request); err != nil || len(request.Items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required fields"})
+		return
+	}
+
+	// Begin transaction
+	ctx := context.Background()
+	tx, err := schema.GetDBConn().BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	// Ensure rollback if error occurs
+	defer tx.Rollback()
+
+	hold, err := lockActiveHold(ctx, tx, c.Param("hold_token"))
+	if errors.Is(err, ErrHoldNotActive) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"success": false, "error": "Your cart is no longer held"})
+		return
+	} else if errors.Is(err, internal.ErrInvalidToken) {
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Error fetching stock hold: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	subtotal, err := setHoldItems(ctx, tx, hold.ID, request.Items)
+	if errors.Is(err, ErrCannotHoldItem) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		fmt.Printf("Error holding items: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	hold.ExpiresAt = time.Now().Add(stockHoldWindow())
+	_, err = tx.NewUpdate().
+		Model(hold).
+		Column("expires_at").
+		WherePK().
+		Exec(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update hold"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, HoldResponse{
+		HoldToken: c.Param("hold_token"),
+		ExpiresAt: hold.ExpiresAt,
+		Subtotal:  subtotal,
+		Currency:  money.Currency(),
+	})
+}
+
+/*
+Puts the items in a held cart back on sale, e.g. when the shopper empties it
+
+	curl -X DELETE http://localhost:8080/api/hold/HOLD_TOKEN
+*/
+func ReleaseHold(c *gin.Context) {
+	subject, err := internal.VerifyToken(internal.TokenStockHold, c.Param("hold_token"))
+	if err != nil {
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	}
+
+	_, err = schema.GetDBConn().NewUpdate().
+		Model((*schema.StockHold)(nil)).
+		Set("status = ?", schema.HoldReleased).
+		Where("id = ? AND status = ?", subject, schema.HoldActive).
+		Exec(context.Background())
+	if err != nil {
+		fmt.Printf("Error releasing stock hold: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// Marks lapsed holds expired; their items are already back on sale, since only unexpired holds are counted
+func expireStockHolds(ctx context.Context) error {
+	_, err := schema.GetDBConn().NewUpdate().
+		Model((*schema.StockHold)(nil)).
+		Set("status = ?", schema.HoldExpired).
+		Where("status = ? AND expires_at <= ?", schema.HoldActive, time.Now()).
+		Exec(ctx)
+	return err
+}
+
+// Periodically expires lapsed stock holds in the background
+func StartStockHoldSweeper() {
+	go func() {
+		ticker := time.NewTicker(holdSweepInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := expireStockHolds(context.Background()); err != nil {
+				fmt.Printf("Error sweeping stock holds: %v\n", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,158 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"golden-arm/internal"
+	"golden-arm/mailer"
+	"golden-arm/schema"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Length of a screening on a calendar when its movie's runtime isn't known
+const defaultEventLength = 2 * time.Hour
+
+// A screening, or a movie-goer's reservation at one, as an iCalendar event
+type icsEvent struct {
+	UID         string // Stays the same when the event changes, so calendars update it instead of adding another
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+}
+
+// Returns where screenings take place, e.g. VENUE="The Golden Arm, 123 Main St"
+func venue() string {
+	if venue := os.Getenv("VENUE"); venue != "" {
+		return venue
+	}
+	return "The Golden Arm"
+}
+
+// Builds the calendar event for a screening; the screening must have its Movie loaded
+func screeningEvent(screening schema.Screening) icsEvent {
+	length := time.Duration(screening.Movie.Runtime) * time.Minute
+	if length <= 0 {
+		length = defaultEventLength
+	}
+
+	return icsEvent{
+		UID:     fmt.Sprintf("screening-%s@goldenarmtheater.com", screening.ID),
+		Start:   screening.Date,
+		End:     screening.Date.Add(length),
+		Summary: fmt.Sprintf("\"%s\" @ The Golden Arm", screening.Movie.Title),
+	}
+}
+
+// Escapes text for an iCalendar property value
+func icsEscape(text string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(text)
+}
+
+// Writes an iCalendar content line, folded so no line is longer than 75 octets
+func writeICSLine(b *strings.Builder, name string, value string) {
+	line := name + ":" + value
+	limit := 75
+	for len(line) > limit {
+		// Don't split a multi-byte character
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		limit = 74 // Continuation lines start with a space
+	}
+	b.WriteString(line + "\r\n")
+}
+
+// Renders events as an iCalendar file; name is shown for subscribed feeds and can be empty
+func renderICS(name string, events []icsEvent) []byte {
+	const timestamp = "20060102T150405Z"
+	now := time.Now().UTC().Format(timestamp)
+	location := icsEscape(venue())
+
+	var b strings.Builder
+	writeICSLine(&b, "BEGIN", "VCALENDAR")
+	writeICSLine(&b, "VERSION", "2.0")
+	writeICSLine(&b, "PRODID", "-//The Golden Arm//cameraman//EN")
+	writeICSLine(&b, "CALSCALE", "GREGORIAN")
+	writeICSLine(&b, "METHOD", "PUBLISH")
+	if name != "" {
+		writeICSLine(&b, "X-WR-CALNAME", icsEscape(name))
+		writeICSLine(&b, "REFRESH-INTERVAL;VALUE=DURATION", "PT12H")
+		writeICSLine(&b, "X-PUBLISHED-TTL", "PT12H")
+	}
+	for _, event := range events {
+		writeICSLine(&b, "BEGIN", "VEVENT")
+		writeICSLine(&b, "UID", event.UID)
+		writeICSLine(&b, "DTSTAMP", now)
+		writeICSLine(&b, "DTSTART", event.Start.UTC().Format(timestamp))
+		writeICSLine(&b, "DTEND", event.End.UTC().Format(timestamp))
+		writeICSLine(&b, "SUMMARY", icsEscape(event.Summary))
+		writeICSLine(&b, "LOCATION", location)
+		if event.Description != "" {
+			writeICSLine(&b, "DESCRIPTION", icsEscape(event.Description))
+		}
+		writeICSLine(&b, "END", "VEVENT")
+	}
+	writeICSLine(&b, "END", "VCALENDAR")
+
+	return []byte(b.String())
+}
+
+// Builds the calendar event attached to a reservation confirmation; the screening must have its Movie loaded
+func reservationCalendarAttachment(screening schema.Screening, seats []string) mailer.Attachment {
+	event := screeningEvent(screening)
+	// Each booking gets its own event, so it isn't merged with the same screening from the feed
+	event.UID = fmt.Sprintf("reservation-%s-%s@goldenarmtheater.com", screening.ID, strings.Join(seats, "-"))
+	event.Description = "Your seats: " + strings.Join(seats, ", ")
+
+	return mailer.Attachment{
+		Filename:    "screening.ics",
+		ContentType: "text/calendar; charset=UTF-8; method=PUBLISH",
+		Data:        renderICS("", []icsEvent{event}),
+	}
+}
+
+/*
+Gets every upcoming screening as an iCalendar feed, for subscribing to in Google Calendar, Apple Calendar, etc.
+
+	curl -X GET http://localhost:8080/api/calendar.ics
+*/
+func GetCalendarFeed(c *gin.Context) {
+	var screenings []schema.Screening
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	err := db.NewSelect().
+		Model(&screenings).
+		Relation("Movie").
+		Where("screening.date >= ?", time.Now()).
+		Order("screening.date ASC").
+		Scan(ctx)
+	if err != nil {
+		fmt.Printf("Error fetching screenings: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	events := make([]icsEvent, 0, len(screenings))
+	for _, screening := range screenings {
+		events = append(events, screeningEvent(screening))
+	}
+
+	c.Header("Content-Disposition", `inline; filename="golden-arm.ics"`)
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", renderICS("The Golden Arm", events))
+}
@@ -0,0 +1,384 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"golden-arm/internal"
+	"golden-arm/schema"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// Most inventory movements returned by one request
+const maxInventoryMovements = 500
+
+type InventoryMovementRequest struct {
+	VariantID    *uuid.UUID `json:"variant_id,omitempty"`
+	PosterSizeID *uuid.UUID `json:"poster_size_id,omitempty"`
+	Kind         string     `json:"kind"`   // restock or adjustment; sales and returns come from orders
+	Change       int        `json:"change"` // Negative to take stock out
+	Reason       string     `json:"reason"`
+}
+
+// Low-stock alert email
+type LowStockEmailData struct {
+	MerchandiseName string
+	SKU             string
+	Options         string
+	Quantity        int
+	Threshold       int
+}
+
+// Starts an inventory movement made by the operator behind the request
+func stockMovement(c *gin.Context, kind string, reason string) schema.InventoryMovement {
+	movement := schema.InventoryMovement{
+		Kind:   kind,
+		Reason: reason,
+	}
+	if operator := internal.GetOperator(c); operator != nil {
+		movement.ActorID = operator.ID
+		movement.ActorName = operator.Name
+	}
+	return movement
+}
+
+// Changes a merchandise variant's or poster size's quantity by movement.Change and records the movement in the ledger
+// Emails REPLYTO if a variant falls to its low-stock threshold
+// Returns ErrInsufficientStock if the quantity would go below zero, or the variant or size doesn't exist
+func moveStock(ctx context.Context, tx bun.Tx, movement schema.InventoryMovement) error {
+	if movement.Change == 0 {
+		return nil
+	}
+
+	var query *bun.UpdateQuery
+	if movement.VariantID != nil {
+		query = tx.NewUpdate().
+			Model((*schema.MerchandiseVariant)(nil)).
+			Where("id = ?", *movement.VariantID)
+	} else {
+		query = tx.NewUpdate().
+			Model((*schema.PosterSize)(nil)).
+			Where("id = ?", *movement.PosterSizeID)
+	}
+
+	var quantity int
+	result, err := query.
+		Set("quantity = quantity + ?", movement.Change).
+		Where("quantity + ? >= 0", movement.Change).
+		Returning("quantity").
+		Exec(ctx, &quantity)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrInsufficientStock
+	}
+
+	movement.ID = uuid.New()
+	movement.QuantityAfter = quantity
+	movement.Date = time.Now()
+	if _, err := tx.NewInsert().Model(&movement).Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record inventory movement: %w", err)
+	}
+
+	if movement.VariantID != nil && movement.Change < 0 {
+		return checkLowStock(ctx, tx, *movement.VariantID, quantity-movement.Change, quantity)
+	}
+	return nil
+}
+
+// Queues a low-stock alert if a variant's stock just fell from above its threshold to at or below it
+func checkLowStock(ctx context.Context, tx bun.Tx, variantID uuid.UUID, before int, after int) error {
+	var variant schema.MerchandiseVariant
+	err := tx.NewSelect().
+		Model(&variant).
+		Relation("Merchandise").
+		Where("merchandise_variant.id = ?", variantID).
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	threshold := variant.LowStockThreshold
+	if threshold <= 0 || before <= threshold || after > threshold {
+		return nil
+	}
+
+	options, err := getMerchOptions(ctx, tx, variant.MerchandiseID)
+	if err != nil {
+		return err
+	}
+
+	data := LowStockEmailData{
+		MerchandiseName: variant.Merchandise.Name,
+		SKU:             variant.SKU,
+		Options:         variantLabel(options, variant),
+		Quantity:        after,
+		Threshold:       threshold,
+	}
+	body, err := renderEmailTemplate("low_stock_email.html", nil, data)
+	if err != nil {
+		return err
+	}
+
+	from := os.Getenv("ORDERS_SENDER")
+	subject := fmt.Sprintf("Low stock: %s (%s)", data.MerchandiseName, data.SKU)
+
+	return queueEmail(ctx, tx, from, os.Getenv("REPLYTO"), subject, body)
+}
+
+// Gets the merchandise variant or poster size a stock movement is for, whichever ID is set, as its audit log entity
+// Returns sql.ErrNoRows if it doesn't exist
+func getInventoryItem(ctx context.Context, db bun.IDB, variantID *uuid.UUID, posterSizeID *uuid.UUID) (string, uuid.UUID, any, error) {
+	if variantID != nil {
+		var variant schema.MerchandiseVariant
+		err := db.NewSelect().Model(&variant).Where("id = ?", *variantID).Scan(ctx)
+		return "merchandise_variant", *variantID, variant, err
+	}
+
+	var size schema.PosterSize
+	err := db.NewSelect().Model(&size).Where("id = ?", *posterSizeID).Scan(ctx)
+	return "poster_size", *posterSizeID, size, err
+}
+
+/*
+Records a restock or adjustment of a merchandise variant's or poster size's stock, e.g. after a delivery or a stock count
+Responds 409 if it would take the quantity below zero; the change is recorded in the audit log as well as the ledger
+
+	curl -X POST http://localhost:8080/api/inventory/movement -H "Authorization: Bearer YOUR API KEY" \
+		-H "Content-Type: application/json" -d
+		'{
+			"variant_id": "00000000-0000-0000-0000-000000000000",
+			"kind": "adjustment",
+			"change": -2,
+			"reason": "Two shirts damaged in storage"
+		}'
+*/
+func AddInventoryMovement(c *gin.Context) {
+	var request InventoryMovementRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		fmt.Printf("Error binding JSON: %v", err)
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	if (request.VariantID == nil) == (request.PosterSizeID == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Exactly one of variant_id or poster_size_id is required"})
+		return
+	}
+	if request.Kind != schema.MovementRestock && request.Kind != schema.MovementAdjustment {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be restock or adjustment"})
+		return
+	}
+	if request.Change == 0 || request.Reason == "" || (request.Kind == schema.MovementRestock && request.Change < 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A non-zero change and a reason are required; restocks must add stock"})
+		return
+	}
+
+	// Begin transaction
+	ctx := context.Background()
+	tx, err := schema.GetDBConn().BeginTx(ctx, nil)
+	if err != nil {
+		fmt.Printf("Error starting transaction: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	// Ensure rollback if error occurs
+	defer tx.Rollback()
+
+	// Make sure the variant or size exists, so a missing one isn't mistaken for running out
+	entityType, entityID, before, err := getInventoryItem(ctx, tx, request.VariantID, request.PosterSizeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Error fetching inventory item: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	movement := stockMovement(c, request.Kind, request.Reason)
+	movement.VariantID = request.VariantID
+	movement.PosterSizeID = request.PosterSizeID
+	movement.Change = request.Change
+
+	err = moveStock(ctx, tx, movement)
+	if errors.Is(err, ErrInsufficientStock) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"success": false, "error": "Not enough stock to take out"})
+		return
+	} else if err != nil {
+		fmt.Printf("Error moving stock: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	_, _, after, err := getInventoryItem(ctx, tx, request.VariantID, request.PosterSizeID)
+	if err == nil {
+		err = recordAudit(ctx, tx, c, request.Kind, entityType, entityID, before, after)
+	}
+	if err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		fmt.Printf("Error committing transaction: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+/*
+Gets the inventory ledger, most recent first
+Optionally filtered by variant_id, poster_size_id, order_id, kind, and a since/until date range (RFC 3339)
+Pages with limit (default and max 500) and offset
+
+	curl -X GET "http://localhost:8080/api/inventory/movements?variant_id=00000000-0000-0000-0000-000000000000" \
+	-H "Authorization: Bearer YOUR API KEY"
+*/
+func GetInventoryMovements(c *gin.Context) {
+	var movements []schema.InventoryMovement
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	query := db.NewSelect().
+		Model(&movements).
+		Order("date DESC")
+
+	for _, param := range []string{"variant_id", "poster_size_id", "order_id"} {
+		if value := c.Query(param); value != "" {
+			id, err := uuid.Parse(value)
+			if err != nil {
+				fmt.Printf("%s must be a valid UUID", param)
+				c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+				return
+			}
+			query = query.Where("? = ?", bun.Ident(param), id)
+		}
+	}
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	for param, condition := range map[string]string{"since": "date >= ?", "until": "date < ?"} {
+		if value := c.Query(param); value != "" {
+			date, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				fmt.Printf("%s must be an RFC 3339 date", param)
+				c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+				return
+			}
+			query = query.Where(condition, date)
+		}
+	}
+
+	limit := maxInventoryMovements
+	if param := c.Query("limit"); param != "" {
+		var err error
+		limit, err = strconv.Atoi(param)
+		if err != nil || limit <= 0 || limit > maxInventoryMovements {
+			fmt.Printf("limit must be between 1 and %d", maxInventoryMovements)
+			c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+			return
+		}
+	}
+	offset := 0
+	if param := c.Query("offset"); param != "" {
+		var err error
+		offset, err = strconv.Atoi(param)
+		if err != nil || offset < 0 {
+			fmt.Println("offset must be a non-negative integer")
+			c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+			return
+		}
+	}
+
+	err := query.
+		Limit(limit).
+		Offset(offset).
+		Scan(ctx)
+	if err != nil {
+		fmt.Printf("Error fetching inventory movements: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	if movements == nil {
+		movements = []schema.InventoryMovement{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": movements})
+}
+
+/*
+Checks every merchandise variant's and poster size's quantity against the sum of its movements in the ledger
+Only lists the ones that don't match, unless all=true
+
+	curl -X GET "http://localhost:8080/api/inventory/reconcile" -H "Authorization: Bearer YOUR API KEY"
+*/
+func ReconcileInventory(c *gin.Context) {
+	type InventoryCount struct {
+		VariantID      *uuid.UUID `bun:"variant_id" json:"variant_id,omitempty"`
+		PosterSizeID   *uuid.UUID `bun:"poster_size_id" json:"poster_size_id,omitempty"`
+		Name           string     `bun:"name" json:"name"` // The variant's SKU, or the poster's movie and size
+		Quantity       int        `bun:"quantity" json:"quantity"`
+		LedgerQuantity int        `bun:"ledger_quantity" json:"ledger_quantity"`
+	}
+
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	var variants []InventoryCount
+	err := db.NewSelect().
+		TableExpr("merchandise_variants AS v").
+		ColumnExpr("v.id AS variant_id, v.sku AS name, v.quantity").
+		ColumnExpr("coalesce(sum(m.change), 0) AS ledger_quantity").
+		Join("LEFT JOIN inventory_movements AS m ON m.variant_id = v.id").
+		GroupExpr("v.id").
+		OrderExpr("v.sku ASC").
+		Scan(ctx, &variants)
+	if err != nil {
+		fmt.Printf("Error counting variant movements: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	var posterSizes []InventoryCount
+	err = db.NewSelect().
+		TableExpr("poster_sizes AS s").
+		ColumnExpr("s.id AS poster_size_id, mv.title || ' (' || s.size || ')' AS name, s.quantity").
+		ColumnExpr("coalesce(sum(m.change), 0) AS ledger_quantity").
+		Join("JOIN posters AS p ON p.id = s.poster_id").
+		Join("JOIN movies AS mv ON mv.id = p.movie_id").
+		Join("LEFT JOIN inventory_movements AS m ON m.poster_size_id = s.id").
+		GroupExpr("s.id, mv.title").
+		OrderExpr("name ASC").
+		Scan(ctx, &posterSizes)
+	if err != nil {
+		fmt.Printf("Error counting poster size movements: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	all := c.Query("all") == "true"
+	counts := []InventoryCount{}
+	for _, count := range append(variants, posterSizes...) {
+		if all || count.Quantity != count.LedgerQuantity {
+			counts = append(counts, count)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": counts})
+}
@@ -0,0 +1,358 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"golden-arm/internal"
+	"golden-arm/money"
+	"golden-arm/schema"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+// How long a lookup link works for
+const lookupLinkLifetime = 24 * time.Hour
+
+// How long before another lookup link is sent to the same address, so the form can't be used to flood an inbox
+const lookupLinkCooldown = 5 * time.Minute
+
+const lookupEmailSubject = "Your reservations and orders @ The Golden Arm"
+
+// Orders the customer still has something to do with
+var openOrderStatuses = []string{schema.OrderPending, schema.OrderPaid, schema.OrderReady}
+
+type LookupRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// Lookup link email
+type LookupEmailData struct {
+	To        string
+	LookupURL string
+	ExpiresAt string
+}
+
+// An upcoming reservation, as shown to the movie-goer who made it
+type LookupReservation struct {
+	ID          uuid.UUID `json:"id"`
+	ScreeningID uuid.UUID `json:"screening_id"`
+	MovieTitle  string    `json:"movie_title"`
+	Date        time.Time `json:"date"` // Of the screening
+	SeatNumber  string    `json:"seat_number"`
+	GuestName   string    `json:"guest_name,omitempty"`
+	CancelToken string    `json:"cancel_token"` // For POST /api/reservation/cancel/:token
+}
+
+// An open order, as shown to the customer who placed it
+type LookupOrder struct {
+	ID         uuid.UUID         `json:"id"`
+	Date       time.Time         `json:"date"`
+	Status     string            `json:"status"`
+	Total      money.Money       `json:"total"`
+	Refunded   money.Money       `json:"refunded"`
+	Currency   string            `json:"currency"`
+	PickupCode string            `json:"pickup_code"`
+	Items      []LookupOrderItem `json:"items"`
+	CanCancel  bool              `json:"can_cancel"`        // Only unpaid orders can be cancelled by the customer
+	PayURL     string            `json:"pay_url,omitempty"` // Where to pay online, if it's unpaid
+}
+
+type LookupOrderItem struct {
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+	Preorder bool   `json:"preorder"`
+}
+
+// Link the movie-goer follows to see their reservations and orders
+func LookupURL(token string) string {
+	return "https://goldenarmtheater.com/my-tickets/" + token
+}
+
+// Checks a lookup token from the URL and returns the email address it was sent to
+// Aborts the request and returns false if it's invalid or expired
+func verifyLookupToken(c *gin.Context) (string, bool) {
+	email, err := internal.VerifyToken(internal.TokenPatronLookup, c.Param("token"))
+	if errors.Is(err, internal.ErrExpiredToken) {
+		c.AbortWithStatusJSON(http.StatusGone, gin.H{"success": false, "error": "This link has expired; request a new one"})
+		return "", false
+	} else if err != nil {
+		fmt.Printf("Error verifying lookup token: %v", err)
+		c.AbortWithError(http.StatusUnauthorized, internal.ErrUnauthorized)
+		return "", false
+	}
+	return email, true
+}
+
+// Queues the email with a movie-goer's lookup link
+func queueLookupEmail(ctx context.Context, db bun.IDB, email string) error {
+	expiresAt := time.Now().Add(lookupLinkLifetime)
+	data := LookupEmailData{
+		To:        email,
+		LookupURL: LookupURL(internal.SignToken(internal.TokenPatronLookup, email, expiresAt)),
+	}
+	var err error
+	data.ExpiresAt, err = formatScreeningDate(expiresAt)
+	if err != nil {
+		return err
+	}
+
+	body, err := renderEmailTemplate("lookup_email.html", nil, data)
+	if err != nil {
+		return err
+	}
+
+	from := os.Getenv("RESERVATIONS_SENDER")
+
+	return queueEmail(ctx, db, from, data.To, lookupEmailSubject, body)
+}
+
+/*
+Emails a link for looking up and cancelling a movie-goer's upcoming reservations and open orders
+Always succeeds, so it can't be used to find out who has booked; the link is only sent if there's something to show
+
+	curl -X POST http://localhost:8080/api/lookup -H "Content-Type: application/json" -d '{"email": "jb@example.com"}'
+*/
+func RequestLookupLink(c *gin.Context) {
+	var request LookupRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		fmt.Println(err)
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(request.Email))
+
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	hasReservations, err := db.NewSelect().
+		Model((*schema.Reservation)(nil)).
+		Join("JOIN screenings ON screenings.id = reservation.screening_id").
+		Where("lower(reservation.email) = ? AND screenings.date > ?", email, time.Now()).
+		Exists(ctx)
+	if err != nil {
+		fmt.Printf("Error checking reservations: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	hasOrders, err := db.NewSelect().
+		Model((*schema.Order)(nil)).
+		Where("lower(email) = ? AND status IN (?)", email, bun.In(openOrderStatuses)).
+		Exists(ctx)
+	if err != nil {
+		fmt.Printf("Error checking orders: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	recentlySent, err := db.NewSelect().
+		Model((*schema.OutboxEmail)(nil)).
+		Where("lower(recipient) = ? AND subject = ? AND created_at > ?", email, lookupEmailSubject, time.Now().Add(-lookupLinkCooldown)).
+		Exists(ctx)
+	if err != nil {
+		fmt.Printf("Error checking outbox: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if (hasReservations || hasOrders) && !recentlySent {
+		if err := queueLookupEmail(ctx, db, email); err != nil {
+			fmt.Printf("Error queueing lookup email: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "If we have any bookings for that address, we've emailed it a link to see them",
+	})
+}
+
+/*
+Gets the upcoming reservations and open orders for the email address a lookup link was sent to
+Reservations are cancelled with their cancel_token; unpaid orders with POST /api/lookup/:token/order/:order_id/cancel
+
+	curl -X GET http://localhost:8080/api/lookup/LOOKUP_TOKEN
+*/
+func GetLookup(c *gin.Context) {
+	email, ok := verifyLookupToken(c)
+	if !ok {
+		return
+	}
+
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	var reservations []schema.Reservation
+	err := db.NewSelect().
+		Model(&reservations).
+		Relation("Screening").
+		Relation("Screening.Movie").
+		Where("lower(reservation.email) = ? AND screening.date > ?", email, time.Now()).
+		Order("screening.date ASC", "reservation.seat_number ASC").
+		Scan(ctx)
+	if err != nil {
+		fmt.Printf("Error fetching reservations: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	lookupReservations := make([]LookupReservation, 0, len(reservations))
+	for _, res := range reservations {
+		lookupReservations = append(lookupReservations, LookupReservation{
+			ID:          res.ID,
+			ScreeningID: res.ScreeningID,
+			MovieTitle:  res.Screening.Movie.Title,
+			Date:        res.Screening.Date,
+			SeatNumber:  res.SeatNumber,
+			GuestName:   res.GuestName,
+			CancelToken: cancelToken(res.ID),
+		})
+	}
+
+	var orders []schema.Order
+	err = db.NewSelect().
+		Model(&orders).
+		Where("lower(email) = ? AND status IN (?)", email, bun.In(openOrderStatuses)).
+		Order("date DESC").
+		Scan(ctx)
+	if err != nil {
+		fmt.Printf("Error fetching orders: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	lookupOrders := make([]LookupOrder, 0, len(orders))
+	for _, order := range orders {
+		var items []schema.OrderItem
+		err := db.NewSelect().
+			Model(&items).
+			Relation("Merchandise").
+			Relation("Movie").
+			Where("order_id = ?", order.ID).
+			Scan(ctx)
+		if err != nil {
+			fmt.Printf("Error fetching order items: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+
+		lookupOrder := LookupOrder{
+			ID:         order.ID,
+			Date:       order.Date,
+			Status:     order.Status,
+			Total:      order.Total,
+			Refunded:   order.Refunded,
+			Currency:   order.Currency,
+			PickupCode: order.PickupCode,
+			Items:      make([]LookupOrderItem, 0, len(items)),
+			CanCancel:  order.Status == schema.OrderPending,
+		}
+		if order.Status == schema.OrderPending {
+			lookupOrder.PayURL = OrderCheckoutURL(order.ID)
+		}
+		for _, item := range items {
+			lookupOrder.Items = append(lookupOrder.Items, LookupOrderItem{
+				Name:     orderItemName(item),
+				Quantity: item.Quantity,
+				Preorder: item.Preorder,
+			})
+		}
+		lookupOrders = append(lookupOrders, lookupOrder)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"email":        email,
+			"reservations": lookupReservations,
+			"orders":       lookupOrders,
+		},
+	})
+}
+
+/*
+Cancels an unpaid order for the customer who placed it, using their lookup link, and emails them to confirm
+Raises error if the order isn't theirs or has been paid; paid orders are refunded by the shop instead
+
+	curl -X POST http://localhost:8080/api/lookup/LOOKUP_TOKEN/order/00000000-0000-0000-0000-000000000000/cancel
+*/
+func CancelLookupOrder(c *gin.Context) {
+	email, ok := verifyLookupToken(c)
+	if !ok {
+		return
+	}
+
+	orderID, err := uuid.Parse(c.Param("order_id"))
+	if err != nil {
+		fmt.Println("order_id must be a valid UUID")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	// Begin transaction
+	ctx := context.Background()
+	tx, err := schema.GetDBConn().BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	// Ensure rollback if error occurs
+	defer tx.Rollback()
+
+	// Someone else's order is treated as not found
+	var order schema.Order
+	err = tx.NewSelect().
+		Model(&order).
+		Where("id = ? AND lower(email) = ?", orderID, email).
+		For("UPDATE").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Println("Order not found")
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Error fetching order: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if order.Status != schema.OrderPending {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   "Only unpaid orders can be cancelled; reply to your order confirmation to ask for a refund",
+		})
+		return
+	}
+
+	err = transitionOrder(ctx, tx, &order, schema.OrderCancelled, uuid.Nil)
+	if errors.Is(err, ErrInvalidOrderTransition) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"success": false, "error": err.Error()})
+		return
+	} else if err != nil {
+		fmt.Printf("Error cancelling order: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := queueOrderStatusEmail(ctx, tx, order); err != nil {
+		fmt.Printf("Error queueing order status email: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Order cancelled"})
+}
@@ -2,33 +2,290 @@ package routes
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"golden-arm/internal"
+	"golden-arm/money"
 	"golden-arm/schema"
 	"golden-arm/utils"
 	"net/http"
-	"strconv"
+	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/uptrace/bun"
 )
 
+var ErrInvalidVariant = errors.New("invalid merchandise variants")
+
 type MerchandiseRequest struct {
-	Name        string     `json:"name"`
-	Description string     `json:"description"`
-	Price       float64    `json:"price"`
-	ImageURL    string     `json:"image_url"`
-	Sizes       []SizeInfo `json:"sizes"`
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Price       money.Money   `json:"price"`
+	ImageURL    string        `json:"image_url"`
+	Options     []OptionInfo  `json:"options"`
+	Variants    []VariantInfo `json:"variants"`
+	Preorder    *PreorderInfo `json:"preorder"` // Sells the item as a pre-order, printed once the window closes
+}
+
+// An option type and its values, e.g. "Colour" with "Red" and "Blue"
+type OptionInfo struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+// A variant, matched by SKU; fields left out are unchanged on update
+type VariantInfo struct {
+	SKU      string            `json:"sku"`
+	Options  map[string]string `json:"options"`   // Option name to value, e.g. {"Colour": "Red", "Size": "M"}
+	Price    *money.Money      `json:"price"`     // Overrides the item's price; 0 clears the override
+	Quantity *int              `json:"quantity"`  // Changes to the quantity are recorded in the inventory ledger as adjustments
+	ImageURL *string           `json:"image_url"` // Overrides the item's image; "" clears the override
+	Remove   bool              `json:"remove"`    // Updates only: deletes the variant
+
+	LowStockThreshold *int `json:"low_stock_threshold"` // Emails REPLYTO when stock falls to this; 0 for no alert
+}
+
+// A merchandise item with its options and variants, as recorded in the audit log
+type merchAuditState struct {
+	schema.Merchandise
+	Options  []schema.MerchandiseOption
+	Variants []schema.MerchandiseVariant
+}
+
+// Gets a merchandise item and its variants for the audit log
+func getMerchAuditState(ctx context.Context, db bun.IDB, merchID uuid.UUID) (*merchAuditState, error) {
+	var state merchAuditState
+	err := db.NewSelect().
+		Model(&state.Merchandise).
+		Where("id = ?", merchID).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	state.Options, err = getMerchOptions(ctx, db, merchID)
+	if err != nil {
+		return nil, err
+	}
+	state.Variants, err = getMerchVariants(ctx, db, merchID)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// Gets a merchandise item's options in the order they're shown
+func getMerchOptions(ctx context.Context, db bun.IDB, merchID uuid.UUID) ([]schema.MerchandiseOption, error) {
+	options := []schema.MerchandiseOption{}
+	err := db.NewSelect().
+		Model(&options).
+		Where("merchandise_id = ?", merchID).
+		Order("position ASC").
+		Scan(ctx)
+	return options, err
+}
+
+// Gets a merchandise item's variants
+func getMerchVariants(ctx context.Context, db bun.IDB, merchID uuid.UUID) ([]schema.MerchandiseVariant, error) {
+	variants := []schema.MerchandiseVariant{}
+	err := db.NewSelect().
+		Model(&variants).
+		Where("merchandise_id = ?", merchID).
+		Order("sku ASC").
+		Scan(ctx)
+	return variants, err
+}
+
+// Describes a variant by its option values in order, e.g. "Red / M"; empty for items without options
+func variantLabel(options []schema.MerchandiseOption, variant schema.MerchandiseVariant) string {
+	values := make([]string, 0, len(options))
+	for _, option := range options {
+		values = append(values, variant.Options[option.Name])
+	}
+	return strings.Join(values, " / ")
+}
+
+// Reads options and variants from a multipart form, where each is a JSON array like the JSON request's
+// A variant's image can be uploaded as a file named variant_image_SKU
+func bindVariantForm(c *gin.Context, options *[]OptionInfo, variants *[]VariantInfo) error {
+	if value := c.PostForm("options"); value != "" {
+		if err := json.Unmarshal([]byte(value), options); err != nil {
+			return fmt.Errorf("%w: options must be a JSON array", ErrInvalidVariant)
+		}
+	}
+	if value := c.PostForm("variants"); value != "" {
+		if err := json.Unmarshal([]byte(value), variants); err != nil {
+			return fmt.Errorf("%w: variants must be a JSON array", ErrInvalidVariant)
+		}
+	}
+
+	for i := range *variants {
+		variant := &(*variants)[i]
+		imageFile, _ := c.FormFile("variant_image_" + variant.SKU)
+		if imageFile == nil {
+			continue
+		}
+		imageURL, err := utils.UploadToS3(imageFile, "Merchandise", variant.SKU)
+		if err != nil {
+			return err
+		}
+		variant.ImageURL = &imageURL
+	}
+
+	return nil
+}
+
+// Replaces a merchandise item's options
+func saveMerchOptions(ctx context.Context, tx bun.Tx, merchID uuid.UUID, options []OptionInfo) error {
+	_, err := tx.NewDelete().
+		Model((*schema.MerchandiseOption)(nil)).
+		Where("merchandise_id = ?", merchID).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i, info := range options {
+		if info.Name == "" || len(info.Values) == 0 {
+			return fmt.Errorf("%w: options need a name and values", ErrInvalidVariant)
+		}
+		option := schema.MerchandiseOption{
+			ID:            uuid.New(),
+			MerchandiseID: merchID,
+			Name:          info.Name,
+			Values:        info.Values,
+			Position:      i,
+		}
+		if _, err := tx.NewInsert().Model(&option).Exec(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-type SizeInfo struct {
-	Size     string `json:"size"`
-	Quantity int    `json:"quantity"`
+// Adds, updates, or removes a merchandise item's variants by SKU, then checks every variant against the item's options
+// Quantity changes are recorded in the inventory ledger as made by the operator behind the request
+// Returns ErrInvalidVariant if a variant is missing an option value, duplicates another, or its SKU is taken
+func saveMerchVariants(ctx context.Context, tx bun.Tx, c *gin.Context, merchID uuid.UUID, variants []VariantInfo) error {
+	for _, info := range variants {
+		if info.SKU == "" {
+			return fmt.Errorf("%w: every variant needs a SKU", ErrInvalidVariant)
+		}
+		if (info.Price != nil && *info.Price < 0) || (info.Quantity != nil && *info.Quantity < 0) ||
+			(info.LowStockThreshold != nil && *info.LowStockThreshold < 0) {
+			return fmt.Errorf("%w: invalid price or quantity for %s", ErrInvalidVariant, info.SKU)
+		}
+
+		var variant schema.MerchandiseVariant
+		err := tx.NewSelect().
+			Model(&variant).
+			Where("sku = ?", info.SKU).
+			For("UPDATE").
+			Scan(ctx)
+		isNew := errors.Is(err, sql.ErrNoRows)
+		if err != nil && !isNew {
+			return err
+		}
+		if !isNew && variant.MerchandiseID != merchID {
+			return fmt.Errorf("%w: SKU %s belongs to another item", ErrInvalidVariant, info.SKU)
+		}
+
+		if info.Remove {
+			if !isNew {
+				if _, err := tx.NewDelete().Model(&variant).WherePK().Exec(ctx); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if isNew {
+			variant = schema.MerchandiseVariant{
+				ID:            uuid.New(),
+				MerchandiseID: merchID,
+				SKU:           info.SKU,
+				Options:       map[string]string{},
+			}
+		}
+		if info.Options != nil {
+			variant.Options = info.Options
+		}
+		if info.Price != nil {
+			variant.Price = *info.Price
+		}
+		if info.ImageURL != nil {
+			variant.ImageURL = *info.ImageURL
+		}
+		if info.LowStockThreshold != nil {
+			variant.LowStockThreshold = *info.LowStockThreshold
+		}
+
+		// The quantity only changes through the inventory ledger
+		if isNew {
+			_, err = tx.NewInsert().Model(&variant).Exec(ctx)
+		} else {
+			_, err = tx.NewUpdate().Model(&variant).ExcludeColumn("quantity").WherePK().Exec(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		if info.Quantity != nil {
+			kind, reason := schema.MovementAdjustment, "Quantity set on merchandise update"
+			if isNew {
+				kind, reason = schema.MovementRestock, "Initial stock"
+			}
+			movement := stockMovement(c, kind, reason)
+			movement.VariantID = &variant.ID
+			movement.Change = *info.Quantity - variant.Quantity
+			if err := moveStock(ctx, tx, movement); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Every variant needs exactly one of each option's values, and no two variants can be the same
+	options, err := getMerchOptions(ctx, tx, merchID)
+	if err != nil {
+		return err
+	}
+	saved, err := getMerchVariants(ctx, tx, merchID)
+	if err != nil {
+		return err
+	}
+	if len(saved) == 0 {
+		return fmt.Errorf("%w: items need at least one variant", ErrInvalidVariant)
+	}
+	seen := make(map[string]string, len(saved))
+	for _, variant := range saved {
+		if len(variant.Options) != len(options) {
+			return fmt.Errorf("%w: %s needs a value for each option", ErrInvalidVariant, variant.SKU)
+		}
+		for _, option := range options {
+			if !slices.Contains(option.Values, variant.Options[option.Name]) {
+				return fmt.Errorf("%w: %s has no valid %s", ErrInvalidVariant, variant.SKU, option.Name)
+			}
+		}
+		label := variantLabel(options, variant)
+		if other, found := seen[label]; found {
+			return fmt.Errorf("%w: %s and %s are the same variant", ErrInvalidVariant, other, variant.SKU)
+		}
+		seen[label] = variant.SKU
+	}
+
+	return nil
 }
 
 /*
-Adds new merchandise item to the database, including its available sizes; supports file upload and JSON-based submissions
+Adds new merchandise item to the database, including its options and variants; supports file upload and JSON-based submissions
+Each variant has its own SKU and inventory, and can override the item's price and image; an item without options has one variant
+An optional preorder window sells the item beyond its stock until closes_at; customers are then emailed whether it's being
+printed, depending on whether the minimum number of units was ordered
 
 	For JSON-based submissions:
 
@@ -39,44 +296,56 @@ Adds new merchandise item to the database, including its available sizes; suppor
 			"description": "Put a description here",
 			"price": 15.00,
 			"image_url": "https://example.com/images/movie-tshirt.jpg",
-			"sizes": [
+			"options": [
 				{
-				"size": "S",
-				"quantity": 10
+				"name": "Colour",
+				"values": ["Black", "Gold"]
 				},
 				{
-				"size": "M",
+				"name": "Size",
+				"values": ["M", "L"]
+				}
+			],
+			"variants": [
+				{
+				"sku": "TEE-BLK-M",
+				"options": {"Colour": "Black", "Size": "M"},
 				"quantity": 15
 				},
 				{
-				"size": "L",
+				"sku": "TEE-BLK-L",
+				"options": {"Colour": "Black", "Size": "L"},
 				"quantity": 20
 				},
 				{
-				"size": "XL",
-				"quantity": 0
+				"sku": "TEE-GLD-M",
+				"options": {"Colour": "Gold", "Size": "M"},
+				"price": 18.00,
+				"quantity": 5,
+				"image_url": "https://example.com/images/movie-tshirt-gold.jpg"
 				}
-			]
+			],
+			"preorder": {
+				"opens_at": "2025-03-01T00:00:00Z",
+				"closes_at": "2025-03-15T00:00:00Z",
+				"minimum": 24,
+				"ship_date": "2025-04-01T00:00:00Z"
+			}
 		}'
 
-	For file upload submissions:
+	For file upload submissions, options and variants are JSON; variant images are uploaded as variant_image_SKU:
 
 	curl -X POST http://localhost:8080/api/merch -H "Authorization: Bearer YOUR API KEY" \
-		-F "name=Movie T-Shirt" \
+		-F "name=Movie Tote" \
 		-F "description=Put a description here" \
-		-F "price=15.00" \
-		-F "image=@/path/to/image.jpg"
-		-F "sizes=S,10" \
-		-F "sizes=M,15" \
-		-F "sizes=L,20" \
-		-F "sizes=XL,0"
+		-F "price=12.00" \
+		-F "image=@/path/to/image.jpg" \
+		-F 'options=[{"name": "Colour", "values": ["Natural", "Black"]}]' \
+		-F 'variants=[{"sku": "TOTE-NAT", "options": {"Colour": "Natural"}, "quantity": 10},
+			{"sku": "TOTE-BLK", "options": {"Colour": "Black"}, "quantity": 10}]' \
+		-F "variant_image_TOTE-BLK=@/path/to/black-tote.jpg"
 */
 func AddMerchandise(c *gin.Context) {
-	if !internal.CheckAuthorization(c) {
-		c.AbortWithError(http.StatusUnauthorized, internal.ErrUnauthorized)
-		return
-	}
-
 	// Check if the request is multipart/form-data for file uploads
 	contentType := c.Request.Header.Get("Content-Type")
 	isMultipart := strings.HasPrefix(contentType, "multipart/form-data")
@@ -89,7 +358,7 @@ func AddMerchandise(c *gin.Context) {
 		// Merch item details
 		newMerch.Name = c.PostForm("name")
 		newMerch.Description = c.PostForm("description")
-		newMerch.Price, err = strconv.ParseFloat(c.PostForm("price"), 64)
+		newMerch.Price, err = money.Parse(c.PostForm("price"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid price format"})
 			return
@@ -108,29 +377,18 @@ func AddMerchandise(c *gin.Context) {
 			newMerch.ImageURL = c.PostForm("image_url")
 		}
 
-		// Process sizes from form data
-		// Each size is submitted as "sizes=S,10"
-		sizesValues := c.PostFormArray("sizes")
-
-		newMerch.Sizes = []SizeInfo{}
-		for _, sizeValue := range sizesValues {
-			parts := strings.Split(sizeValue, ",")
-			if len(parts) != 2 {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid size format. Expected: Size,Quantity"})
-				return
-			}
-
-			size := parts[0]
-			quantity, err := strconv.Atoi(parts[1])
-			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quantity value. Must be a number"})
-				return
-			}
-
-			newMerch.Sizes = append(newMerch.Sizes, SizeInfo{
-				Size:     size,
-				Quantity: quantity,
-			})
+		// Process options and variants from form data
+		err = bindVariantForm(c, &newMerch.Options, &newMerch.Variants)
+		if err == nil {
+			err = bindPreorderForm(c, &newMerch.Preorder)
+		}
+		if errors.Is(err, ErrInvalidVariant) || errors.Is(err, ErrInvalidPreorder) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			fmt.Println("Error uploading variant image file:", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
 		}
 
 	} else {
@@ -160,6 +418,12 @@ func AddMerchandise(c *gin.Context) {
 		Price:       newMerch.Price,
 		ImageURL:    newMerch.ImageURL,
 	}
+	if newMerch.Preorder != nil {
+		if err := applyPreorder(&merch, *newMerch.Preorder); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	// Begin transaction
 	ctx := context.Background()
@@ -178,20 +442,27 @@ func AddMerchandise(c *gin.Context) {
 		return
 	}
 
-	// Insert sizes
-	for _, sizeInfo := range newMerch.Sizes {
-		size := schema.MerchandiseSize{
-			ID:            uuid.New(),
-			MerchandiseID: merch.ID,
-			Size:          sizeInfo.Size,
-			Quantity:      sizeInfo.Quantity,
-		}
+	// Insert options and variants
+	err = saveMerchOptions(ctx, tx, merch.ID, newMerch.Options)
+	if err == nil {
+		err = saveMerchVariants(ctx, tx, c, merch.ID, newMerch.Variants)
+	}
+	if errors.Is(err, ErrInvalidVariant) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert variants"})
+		return
+	}
 
-		_, err = tx.NewInsert().Model(&size).Exec(ctx)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert size"})
-			return
-		}
+	after, err := getMerchAuditState(ctx, tx, merch.ID)
+	if err == nil {
+		err = recordAudit(ctx, tx, c, schema.AuditCreate, "merchandise", merch.ID, nil, after)
+	}
+	if err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
 	}
 
 	// Commit transaction
@@ -208,14 +479,16 @@ func AddMerchandise(c *gin.Context) {
 }
 
 /*
-Gets all merchandise items in the database with their associated sizes
+Gets all merchandise items in the database with their options and variants
+Each variant's quantity is what's left to buy, so stock held in shoppers' carts isn't included
 
 	curl -X GET http://localhost:8080/api/merch/all
 */
 func GetAllMerchandise(c *gin.Context) {
-	type MerchandiseWithSizes struct {
+	type MerchandiseWithVariants struct {
 		schema.Merchandise
-		Sizes []schema.MerchandiseSize `json:"sizes"`
+		Options  []schema.MerchandiseOption  `json:"options"`
+		Variants []schema.MerchandiseVariant `json:"variants"`
 	}
 
 	var merchandise []schema.Merchandise
@@ -233,28 +506,40 @@ func GetAllMerchandise(c *gin.Context) {
 		return
 	}
 
-	result := make([]MerchandiseWithSizes, 0, len(merchandise))
+	held, err := getHeldStock(ctx, db)
+	if err != nil {
+		fmt.Printf("Error fetching held stock: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
 
-	// For each merchandise item, get its sizes
-	for _, merch := range merchandise {
-		var sizes []schema.MerchandiseSize
+	result := make([]MerchandiseWithVariants, 0, len(merchandise))
 
-		// Query sizes for this specific merchandise item
-		err := db.NewSelect().
-			Model(&sizes).
-			Where("merchandise_id = ?", merch.ID).
-			Scan(ctx)
+	// For each merchandise item, get its options and variants
+	for _, merch := range merchandise {
+		options, err := getMerchOptions(ctx, db, merch.ID)
+		if err != nil {
+			fmt.Printf("Error fetching options for merchandise ID %s: %v", merch.ID, err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
 
+		variants, err := getMerchVariants(ctx, db, merch.ID)
 		if err != nil {
-			fmt.Printf("Error fetching sizes for merchandise ID %s: %v", merch.ID, err)
+			fmt.Printf("Error fetching variants for merchandise ID %s: %v", merch.ID, err)
 			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
 			return
 		}
 
-		// Add merchandise with its sizes to result
-		result = append(result, MerchandiseWithSizes{
+		for i := range variants {
+			variants[i].Quantity = max(variants[i].Quantity-held[stockKey{VariantID: variants[i].ID}], 0)
+		}
+
+		// Add merchandise with its options and variants to result
+		result = append(result, MerchandiseWithVariants{
 			Merchandise: merch,
-			Sizes:       sizes,
+			Options:     options,
+			Variants:    variants,
 		})
 	}
 
@@ -262,17 +547,12 @@ func GetAllMerchandise(c *gin.Context) {
 }
 
 /*
-Deletes merch item from database along with all associated sizes
+Deletes merch item from database along with all its options and variants
 
 	curl -X DELETE http://localhost:8080/api/merch/00000000-0000-0000-0000-000000000000 \
 	-H "Authorization: Bearer YOUR API KEY"
 */
 func DeleteMerchandise(c *gin.Context) {
-	if !internal.CheckAuthorization(c) {
-		c.AbortWithError(http.StatusUnauthorized, internal.ErrUnauthorized)
-		return
-	}
-
 	// Ensure merch_id is provided and is a valid UUID
 	param := c.Param("merch_id")
 	if param == "" {
@@ -317,14 +597,32 @@ func DeleteMerchandise(c *gin.Context) {
 		return
 	}
 
-	// Delete the associated sizes first
+	before, err := getMerchAuditState(ctx, tx, merchID)
+	if err != nil {
+		fmt.Printf("Error fetching merchandise: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	// Delete the associated variants and options first
+	_, err = tx.NewDelete().
+		Model((*schema.MerchandiseVariant)(nil)).
+		Where("merchandise_id = ?", merchID).
+		Exec(ctx)
+
+	if err != nil {
+		fmt.Printf("Error deleting associated variants: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
 	_, err = tx.NewDelete().
-		Model((*schema.MerchandiseSize)(nil)).
+		Model((*schema.MerchandiseOption)(nil)).
 		Where("merchandise_id = ?", merchID).
 		Exec(ctx)
 
 	if err != nil {
-		fmt.Printf("Error deleting associated sizes: %v", err)
+		fmt.Printf("Error deleting associated options: %v", err)
 		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
 		return
 	}
@@ -341,6 +639,12 @@ func DeleteMerchandise(c *gin.Context) {
 		return
 	}
 
+	if err := recordAudit(ctx, tx, c, schema.AuditDelete, "merchandise", merchID, before, nil); err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
 	// Commit the transaction
 	if err = tx.Commit(); err != nil {
 		fmt.Printf("Error committing transaction: %v", err)
@@ -350,25 +654,23 @@ func DeleteMerchandise(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "Merchandise item and associated sizes deleted successfully",
+		"message": "Merchandise item and associated variants deleted successfully",
 	})
 }
 
-type SizeUpdateInfo struct {
-	Size     string `json:"size"`
-	Quantity *int   `json:"quantity"` // Pointer to allow nil (no update)
-}
-
 type MerchandiseUpdateRequest struct {
-	Name        string           `json:"name"`
-	Description string           `json:"description"`
-	Price       float64          `json:"price"`
-	ImageURL    string           `json:"image_url"`
-	SizeUpdates []SizeUpdateInfo `json:"sizes"` // Array of size updates
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Price       money.Money   `json:"price"`
+	ImageURL    string        `json:"image_url"`
+	Options     []OptionInfo  `json:"options"`  // Replaces the options if given
+	Variants    []VariantInfo `json:"variants"` // Variant updates, matched by SKU
+	Preorder    *PreorderInfo `json:"preorder"` // Replaces the pre-order window if given; {} takes the item off pre-order
 }
 
 /*
-Updates an existing merchandise item and its associated sizes
+Updates an existing merchandise item and its options and variants
+Options, if given, replace the item's options; variants are matched by SKU, added if new, and removed with "remove": true
 
 	curl -X PUT http://localhost:8080/api/merch/00000000-0000-0000-0000-000000000000 \
 		-H "Authorization: Bearer YOUR API KEY" \
@@ -378,18 +680,18 @@ Updates an existing merchandise item and its associated sizes
 			"description": "Updated description",
 			"price": 19.99,
 			"image_url": "https://example.com/images/updated-tshirt.jpg",
-			"sizes": [
+			"variants": [
 				{
-					"size": "S",
-					"quantity": 0
+					"sku": "TEE-BLK-M",
+					"quantity": 25
 				},
 				{
-					"size": "M",
-					"quantity": 25
+					"sku": "TEE-GLD-M",
+					"price": 0
 				},
 				{
-					"size": "L",
-					"quantity": 15
+					"sku": "TEE-BLK-L",
+					"remove": true
 				}
 			]
 		}'
@@ -402,16 +704,11 @@ Updates an existing merchandise item and its associated sizes
 		-F "description=Updated description" \
 		-F "price=19.99" \
 		-F "image=@/path/to/updated-image.jpg" \
-		-F "sizes=S,0" \
-		-F "sizes=M,25" \
-		-F "sizes=L,15"
+		-F 'variants=[{"sku": "TEE-BLK-M", "quantity": 25}]' \
+		-F "variant_image_TEE-BLK-M=@/path/to/black-tshirt.jpg" \
+		-F 'preorder={"closes_at": "2025-03-22T00:00:00Z", "minimum": 24}'
 */
 func UpdateMerchandise(c *gin.Context) {
-	if !internal.CheckAuthorization(c) {
-		c.AbortWithError(http.StatusUnauthorized, internal.ErrUnauthorized)
-		return
-	}
-
 	// Ensure merch_id is provided and is a valid UUID
 	param := c.Param("merch_id")
 	if param == "" {
@@ -441,7 +738,7 @@ func UpdateMerchandise(c *gin.Context) {
 		updateReq.Description = c.PostForm("description")
 
 		if priceStr := c.PostForm("price"); priceStr != "" {
-			updateReq.Price, err = strconv.ParseFloat(priceStr, 64)
+			updateReq.Price, err = money.Parse(priceStr)
 			if err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid price format"})
 				return
@@ -461,26 +758,18 @@ func UpdateMerchandise(c *gin.Context) {
 			updateReq.ImageURL = imageURL
 		}
 
-		// Process sizes from form data
-		sizesValues := c.PostFormArray("sizes")
-		for _, sizeValue := range sizesValues {
-			parts := strings.Split(sizeValue, ",")
-			if len(parts) != 2 {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid size format. Expected: Size,Quantity"})
-				return
-			}
-
-			size := parts[0]
-			quantity, err := strconv.Atoi(parts[1])
-			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quantity value. Must be a number"})
-				return
-			}
-
-			updateReq.SizeUpdates = append(updateReq.SizeUpdates, SizeUpdateInfo{
-				Size:     size,
-				Quantity: &quantity,
-			})
+		// Process options and variants from form data
+		err = bindVariantForm(c, &updateReq.Options, &updateReq.Variants)
+		if err == nil {
+			err = bindPreorderForm(c, &updateReq.Preorder)
+		}
+		if errors.Is(err, ErrInvalidVariant) || errors.Is(err, ErrInvalidPreorder) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			fmt.Println("Error uploading variant image file:", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
 		}
 	} else {
 		// Handle JSON requests
@@ -513,6 +802,13 @@ func UpdateMerchandise(c *gin.Context) {
 		return
 	}
 
+	before, err := getMerchAuditState(ctx, tx, merchID)
+	if err != nil {
+		fmt.Printf("Error fetching merchandise: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
 	// Update merchandise fields (only update non-empty fields)
 	updates := make(map[string]any)
 
@@ -532,6 +828,10 @@ func UpdateMerchandise(c *gin.Context) {
 		updates["image_url"] = updateReq.ImageURL
 	}
 
+	if updateReq.Preorder != nil {
+		updates["preorder"] = *updateReq.Preorder
+	}
+
 	// Only update if there are changes
 	if len(updates) > 0 {
 		// First get the existing merchandise
@@ -547,7 +847,7 @@ func UpdateMerchandise(c *gin.Context) {
 		}
 
 		// Apply updates
-		if price, ok := updates["price"].(float64); ok {
+		if price, ok := updates["price"].(money.Money); ok {
 			merch.Price = price
 		}
 		if name, ok := updates["name"].(string); ok {
@@ -559,6 +859,12 @@ func UpdateMerchandise(c *gin.Context) {
 		if imgURL, ok := updates["image_url"].(string); ok {
 			merch.ImageURL = imgURL
 		}
+		if preorder, ok := updates["preorder"].(PreorderInfo); ok {
+			if err := applyPreorder(merch, preorder); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
 
 		// Save the updates
 		_, err = tx.NewUpdate().
@@ -573,44 +879,32 @@ func UpdateMerchandise(c *gin.Context) {
 		}
 	}
 
-	// Handle size updates
-	for _, sizeUpdate := range updateReq.SizeUpdates {
-		if sizeUpdate.Quantity == nil {
-			continue // Skip if no quantity update
+	// Handle option and variant updates
+	if updateReq.Options != nil || updateReq.Variants != nil {
+		if updateReq.Options != nil {
+			err = saveMerchOptions(ctx, tx, merchID, updateReq.Options)
 		}
-
-		// Try to update existing size
-		result, err := tx.NewUpdate().
-			Model((*schema.MerchandiseSize)(nil)).
-			Set("quantity = ?", *sizeUpdate.Quantity).
-			Where("merchandise_id = ? AND size = ?", merchID, sizeUpdate.Size).
-			Exec(ctx)
-
-		if err != nil {
-			fmt.Printf("Error updating size: %v", err)
+		if err == nil {
+			err = saveMerchVariants(ctx, tx, c, merchID, updateReq.Variants)
+		}
+		if errors.Is(err, ErrInvalidVariant) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			fmt.Printf("Error updating variants: %v", err)
 			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
 			return
 		}
+	}
 
-		// If no rows were updated, insert new size
-		if affected, _ := result.RowsAffected(); affected == 0 {
-			size := schema.MerchandiseSize{
-				ID:            uuid.New(),
-				MerchandiseID: merchID,
-				Size:          sizeUpdate.Size,
-				Quantity:      *sizeUpdate.Quantity,
-			}
-
-			_, err = tx.NewInsert().
-				Model(&size).
-				Exec(ctx)
-
-			if err != nil {
-				fmt.Printf("Error inserting new size: %v", err)
-				c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
-				return
-			}
-		}
+	after, err := getMerchAuditState(ctx, tx, merchID)
+	if err == nil {
+		err = recordAudit(ctx, tx, c, schema.AuditUpdate, "merchandise", merchID, before, after)
+	}
+	if err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
 	}
 
 	// Commit the transaction
@@ -13,19 +13,21 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/uptrace/bun"
 )
 
 type MovieRequest struct {
-	Title     string    `json:"title"`
-	Date      time.Time `json:"date"`
-	Runtime   int       `json:"runtime"`
-	PosterUrl string    `json:"poster_url"`
-	MenuUrl   string    `json:"menu_url"`
+	Title     string     `json:"title"`
+	Date      *time.Time `json:"date"` // Optional; creates the movie's first screening
+	Runtime   int        `json:"runtime"`
+	PosterUrl string     `json:"poster_url"`
+	MenuUrl   string     `json:"menu_url"`
 }
 
 /*
 Adds new movie to database; supports file upload and JSON-based submissions
-e.g. set the upcoming screening
+If a date is given, a screening of the movie is scheduled for that date
+Further showings are added through the screening endpoints
 
 For JSON-based submissions:
 
@@ -49,11 +51,6 @@ For file upload submissions:
 		-F "menu=@/path/to/menu.jpg"
 */
 func AddMovie(c *gin.Context) {
-	if !internal.CheckAuthorization(c) {
-		c.AbortWithError(http.StatusUnauthorized, internal.ErrUnauthorized)
-		return
-	}
-
 	// Check if the request is multipart/form-data for file uploads
 	contentType := c.Request.Header.Get("Content-Type")
 	isMultipart := strings.HasPrefix(contentType, "multipart/form-data")
@@ -64,12 +61,14 @@ func AddMovie(c *gin.Context) {
 		var err error
 
 		newMovie.Title = c.PostForm("title")
-		date := c.PostForm("date")
-		newMovie.Date, err = time.Parse(time.RFC3339, date)
-		if err != nil {
-			fmt.Println("Error parsing date:", err)
-			c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
-			return
+		if date := c.PostForm("date"); date != "" {
+			t, err := time.Parse(time.RFC3339, date)
+			if err != nil {
+				fmt.Println("Error parsing date:", err)
+				c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+				return
+			}
+			newMovie.Date = &t
 		}
 		newMovie.Runtime, err = strconv.Atoi(c.PostForm("runtime"))
 		if err != nil {
@@ -119,59 +118,92 @@ func AddMovie(c *gin.Context) {
 	movie := schema.Movie{
 		ID:        uuid.New(),
 		Title:     newMovie.Title,
-		Date:      newMovie.Date,
 		Runtime:   newMovie.Runtime,
 		PosterURL: newMovie.PosterUrl,
 		MenuURL:   newMovie.MenuUrl,
 	}
 
-	// Database connection
-	db := schema.GetDBConn()
+	// Begin transaction
 	ctx := context.Background()
+	tx, err := schema.GetDBConn().BeginTx(ctx, nil)
+	if err != nil {
+		fmt.Printf("Error starting transaction: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	defer tx.Rollback()
 
-	// Upsert operation
-	err := db.NewInsert().
+	_, err = tx.NewInsert().
 		Model(&movie).
-		On("CONFLICT (date) DO UPDATE").
-		Set("title = EXCLUDED.title").
-		Set("runtime = EXCLUDED.runtime").
-		Set("poster_url = EXCLUDED.poster_url").
-		Set("menu_url = EXCLUDED.menu_url").
-		Returning("id").
-		Scan(ctx, &movie.ID)
-
+		Exec(ctx)
 	if err != nil {
 		fmt.Printf("Error adding movie to database: %v", err)
 		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Movie added successfully"})
+	// Schedule the first screening in the default seat map if a date was given
+	if newMovie.Date != nil {
+		seatMapID, err := getDefaultSeatMapID(ctx, tx)
+		if err != nil {
+			fmt.Printf("Error finding default seat map: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+
+		screening := schema.Screening{
+			ID:        uuid.New(),
+			MovieID:   movie.ID,
+			SeatMapID: seatMapID,
+			Date:      *newMovie.Date,
+		}
+		_, err = tx.NewInsert().
+			Model(&screening).
+			Exec(ctx)
+		if err != nil {
+			fmt.Printf("Error adding screening to database: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+		if err := recordAudit(ctx, tx, c, schema.AuditCreate, "screening", screening.ID, nil, screening); err != nil {
+			fmt.Printf("Error recording audit entry: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+	}
+
+	if err := recordAudit(ctx, tx, c, schema.AuditCreate, "movie", movie.ID, nil, movie); err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		fmt.Printf("Error committing transaction: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Movie added successfully", "id": movie.ID})
 }
 
 /*
-Updates an existing movie
+Updates an existing movie's metadata; screening dates are updated through the screening endpoints
 
 	curl -X PUT http://localhost:8080/api/movie/00000000-0000-0000-0000-000000000000 \
 		-H "Authorization: Bearer YOUR API KEY" \
 		-H "Content-Type: application/json" \
-		-d '{"title":"Updated Movie Title","date":"2025-04-15","runtime":120}'
+		-d '{"title":"Updated Movie Title","runtime":120}'
 
 	For file upload submissions:
 
 	curl -X PUT http://localhost:8080/api/movie/00000000-0000-0000-0000-000000000000 \
 		-H "Authorization: Bearer YOUR API KEY" \
 		-F "title=Updated Movie Title" \
-		-F "date=2025-04-15" \
 		-F "runtime=120" \
 		-F "menu=@/path/to/updated-menu.jpg"
 */
 func UpdateMovie(c *gin.Context) {
-	if !internal.CheckAuthorization(c) {
-		c.AbortWithError(http.StatusUnauthorized, internal.ErrUnauthorized)
-		return
-	}
-
 	// Ensure movie_id is provided and is a valid UUID
 	param := c.Param("movie_id")
 	if param == "" {
@@ -191,25 +223,16 @@ func UpdateMovie(c *gin.Context) {
 	isMultipart := strings.HasPrefix(contentType, "multipart/form-data")
 
 	type MovieUpdateRequest struct {
-		Title     string     `json:"title"`
-		Date      *time.Time `json:"date"`
-		Runtime   *int       `json:"runtime"`
-		PosterUrl string     `json:"poster_url"`
-		MenuUrl   string     `json:"menu_url"`
+		Title     string `json:"title"`
+		Runtime   *int   `json:"runtime"`
+		PosterUrl string `json:"poster_url"`
+		MenuUrl   string `json:"menu_url"`
 	}
 
 	var updateReq MovieUpdateRequest
 	if isMultipart {
 		var err error
 		updateReq.Title = c.PostForm("title")
-		if dateStr := c.PostForm("date"); dateStr != "" {
-			t, err := time.Parse(time.RFC3339, dateStr)
-			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use RFC3339."})
-				return
-			}
-			updateReq.Date = &t
-		}
 		if runtimeStr := c.PostForm("runtime"); runtimeStr != "" {
 			r, err := strconv.Atoi(runtimeStr)
 			if err != nil {
@@ -279,9 +302,6 @@ func UpdateMovie(c *gin.Context) {
 	if updateReq.Title != "" {
 		updates["title"] = updateReq.Title
 	}
-	if updateReq.Date != nil {
-		updates["date"] = *updateReq.Date
-	}
 	if updateReq.Runtime != nil {
 		updates["runtime"] = *updateReq.Runtime
 	}
@@ -306,9 +326,6 @@ func UpdateMovie(c *gin.Context) {
 		if title, ok := updates["title"].(string); ok {
 			movie.Title = title
 		}
-		if date, ok := updates["date"].(time.Time); ok {
-			movie.Date = date
-		}
 		if runtime, ok := updates["runtime"].(int); ok {
 			movie.Runtime = runtime
 		}
@@ -327,6 +344,11 @@ func UpdateMovie(c *gin.Context) {
 			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
 			return
 		}
+		if err := recordAudit(ctx, tx, c, schema.AuditUpdate, "movie", movie.ID, existingMovie, movie); err != nil {
+			fmt.Printf("Error recording audit entry: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
 	}
 
 	if err = tx.Commit(); err != nil {
@@ -342,46 +364,48 @@ func UpdateMovie(c *gin.Context) {
 }
 
 /*
-Gets movie closest in the future; e.g. get the upcoming screening info
+Gets the screening closest in the future along with its movie; e.g. get the upcoming screening info
 If none, gets most recent past screening
 
-	curl -X GET http://localhost:8080/api/movie
+	curl -X GET http://localhost:8080/api/movie/next
 */
 func GetNextMovie(c *gin.Context) {
-	var nextMovie schema.Movie
+	var nextScreening schema.Screening
 	db := schema.GetDBConn()
 	ctx := context.Background()
 
-	// Try to find the closest upcoming movie
+	// Try to find the closest upcoming screening
 	err := db.NewSelect().
-		Model(&nextMovie).
-		Where("date > ?", time.Now()).
-		Order("date ASC"). // closest future date
+		Model(&nextScreening).
+		Relation("Movie").
+		Where("screening.date > ?", time.Now()).
+		Order("screening.date ASC"). // closest future date
 		Limit(1).
 		Scan(ctx)
 
 	if err != nil {
-		// Try to find the most recent past movie
+		// Try to find the most recent past screening
 		err = db.NewSelect().
-			Model(&nextMovie).
-			Where("date <= ?", time.Now()).
-			Order("date DESC"). // most recent past date
+			Model(&nextScreening).
+			Relation("Movie").
+			Where("screening.date <= ?", time.Now()).
+			Order("screening.date DESC"). // most recent past date
 			Limit(1).
 			Scan(ctx)
 
-		// No movies in the database
+		// No screenings in the database
 		if err != nil {
-			fmt.Printf("Error fetching movie: %v", err)
+			fmt.Printf("Error fetching screening: %v", err)
 			c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
 			return
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{"success": true, "data": nextMovie})
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": nextScreening})
 }
 
 /*
-Gets movie info by ID
+Gets movie info by ID, including all of its screenings
 
 	curl -X GET http://localhost:8080/api/movie/00000000-0000-0000-0000-000000000000
 */
@@ -404,9 +428,12 @@ func GetMovie(c *gin.Context) {
 	db := schema.GetDBConn()
 	ctx := context.Background()
 
-	// Fetch the movie from the database
+	// Fetch the movie and its screenings from the database
 	err = db.NewSelect().
 		Model(&movie).
+		Relation("Screenings", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Order("screening.date ASC")
+		}).
 		Where("id = ?", movieID).
 		Scan(ctx)
 	if err != nil {
@@ -419,7 +446,8 @@ func GetMovie(c *gin.Context) {
 }
 
 /*
-Gets all movies in the database
+Gets all movies in the database with their screenings, most recently screened first
+Movies that have no screenings yet are listed last
 
 	curl -X GET http://localhost:8080/api/movie/all
 */
@@ -428,10 +456,13 @@ func GetAllMovies(c *gin.Context) {
 	db := schema.GetDBConn()
 	ctx := context.Background()
 
-	// Fetch all movies from the database
+	// Fetch all movies from the database, ordered by their latest screening
 	err := db.NewSelect().
 		Model(&movies).
-		Order("date DESC").
+		Relation("Screenings", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Order("screening.date ASC")
+		}).
+		OrderExpr("(SELECT MAX(s.date) FROM screenings AS s WHERE s.movie_id = movie.id) DESC NULLS LAST").
 		Scan(ctx)
 	if err != nil {
 		fmt.Printf("Error fetching movies: %v", err)
@@ -443,20 +474,21 @@ func GetAllMovies(c *gin.Context) {
 }
 
 /*
-Gets all past movies screened
+Gets all past movies screened, each with its most recent past screening, most recent first
 
 	curl -X GET http://localhost:8080/api/movie/archive
 */
 func GetMovieArchive(c *gin.Context) {
-	var movieArchive []schema.Movie
+	var pastScreenings []schema.Screening
 	db := schema.GetDBConn()
 	ctx := context.Background()
 
-	// Select all movies whose screening date is strictly in the past
+	// Select all screenings whose date is strictly in the past
 	err := db.NewSelect().
-		Model(&movieArchive).
-		Where("date < ?", time.Now()).
-		Order("date DESC").
+		Model(&pastScreenings).
+		Relation("Movie").
+		Where("screening.date < ?", time.Now()).
+		Order("screening.date DESC").
 		Scan(ctx)
 
 	if err != nil {
@@ -465,21 +497,27 @@ func GetMovieArchive(c *gin.Context) {
 		return
 	}
 
+	// Keep only the most recent screening of movies that were shown more than once
+	seen := make(map[uuid.UUID]bool)
+	movieArchive := []schema.Screening{}
+	for _, screening := range pastScreenings {
+		if seen[screening.MovieID] {
+			continue
+		}
+		seen[screening.MovieID] = true
+		movieArchive = append(movieArchive, screening)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": movieArchive})
 }
 
 /*
-Deletes movie from database
+Deletes movie from database along with its screenings and their reservations
 
 	curl -X DELETE http://localhost:8080/api/movie/00000000-0000-0000-0000-000000000000 \
 	-H "Authorization: Bearer YOUR API KEY"
 */
 func DeleteMovie(c *gin.Context) {
-	if !internal.CheckAuthorization(c) {
-		c.AbortWithError(http.StatusUnauthorized, internal.ErrUnauthorized)
-		return
-	}
-
 	// Ensure movie_id is provided and is a valid UUID
 	param := c.Param("movie_id")
 	if param == "" {
@@ -497,10 +535,21 @@ func DeleteMovie(c *gin.Context) {
 	db := schema.GetDBConn()
 	ctx := context.Background()
 
-	// Delete the movie from the database
-	result, err := db.NewDelete().
-		Model((*schema.Movie)(nil)).
+	// Begin transaction
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	// Ensure rollback if error occurs
+	defer tx.Rollback()
+
+	// Delete the movie from the database, keeping what was deleted for the audit log
+	var movie schema.Movie
+	result, err := tx.NewDelete().
+		Model(&movie).
 		Where("id = ?", movieID).
+		Returning("*").
 		Exec(ctx)
 
 	if err != nil {
@@ -515,5 +564,16 @@ func DeleteMovie(c *gin.Context) {
 		return
 	}
 
+	if err := recordAudit(ctx, tx, c, schema.AuditDelete, "movie", movieID, movie, nil); err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Movie deleted successfully"})
 }
@@ -0,0 +1,399 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"golden-arm/internal"
+	"golden-arm/schema"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// How long an operator has to accept an invite
+const operatorInviteLifetime = 7 * 24 * time.Hour
+
+// Shortest password an operator can choose
+const minPasswordLength = 12
+
+var ErrOperatorExists = errors.New("an operator with this email already exists")
+
+type OperatorInviteRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Name  string `json:"name" binding:"required"`
+	Role  string `json:"role" binding:"required"`
+}
+
+type AcceptInviteRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// Operator invite email
+type InviteEmailData struct {
+	To          string
+	Name        string
+	Role        string
+	InviteToken string
+	ExpiresAt   string
+}
+
+func isValidRole(role string) bool {
+	switch role {
+	case schema.RoleAdmin, schema.RoleProgrammer, schema.RoleShopManager:
+		return true
+	}
+	return false
+}
+
+// Creates an operator who can log in once they accept the returned invite token
+// Returns ErrOperatorExists if the email already belongs to an operator
+func NewOperatorInvite(ctx context.Context, db bun.IDB, email string, name string, role string) (*schema.Operator, string, error) {
+	if !isValidRole(role) {
+		return nil, "", fmt.Errorf("invalid role %q", role)
+	}
+
+	exists, err := db.NewSelect().
+		Model((*schema.Operator)(nil)).
+		Where("lower(email) = lower(?)", email).
+		Exists(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	if exists {
+		return nil, "", ErrOperatorExists
+	}
+
+	token, err := generateSecureToken()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate invite token: %w", err)
+	}
+	expiresAt := time.Now().Add(operatorInviteLifetime)
+
+	operator := schema.Operator{
+		ID:              uuid.New(),
+		Email:           email,
+		Name:            name,
+		Role:            role,
+		InviteTokenHash: internal.HashToken(token),
+		InviteExpiresAt: &expiresAt,
+		CreatedAt:       time.Now(),
+	}
+	_, err = db.NewInsert().
+		Model(&operator).
+		Exec(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &operator, token, nil
+}
+
+// Link the invited operator follows to choose a password
+func OperatorInviteURL(token string) string {
+	return "https://goldenarmtheater.com/admin/invite/" + token
+}
+
+// Queues the email inviting a new operator to choose a password
+func queueOperatorInviteEmail(ctx context.Context, db bun.IDB, operator schema.Operator, token string) error {
+	data := InviteEmailData{
+		To:          operator.Email,
+		Name:        operator.Name,
+		Role:        operator.Role,
+		InviteToken: token,
+	}
+	var err error
+	data.ExpiresAt, err = formatScreeningDate(*operator.InviteExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	body, err := renderEmailTemplate("invite_email.html", nil, data)
+	if err != nil {
+		return err
+	}
+
+	// Invites come from the same verified address as reservation emails
+	from := os.Getenv("RESERVATIONS_SENDER")
+	subject := "You're invited to help run The Golden Arm"
+
+	return queueEmail(ctx, db, from, data.To, subject, body)
+}
+
+/*
+Invites a new operator by email; roles are admin, programmer, or shop_manager
+
+	curl -X POST http://localhost:8080/api/operator/invite -H "Authorization: Bearer YOUR API KEY" \
+	-H "Content-Type: application/json" -d
+	'{
+		"email": "jb@example.com",
+		"name": "Joey B",
+		"role": "programmer"
+	}'
+*/
+func InviteOperator(c *gin.Context) {
+	var request OperatorInviteRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		fmt.Println(err)
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	if !isValidRole(request.Role) {
+		fmt.Printf("Invalid role %s", request.Role)
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	// Begin transaction
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	// Ensure rollback if error occurs
+	defer tx.Rollback()
+
+	operator, token, err := NewOperatorInvite(ctx, tx, request.Email, request.Name, request.Role)
+	if errors.Is(err, ErrOperatorExists) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"success": false, "error": "An operator with this email already exists"})
+		return
+	} else if err != nil {
+		fmt.Printf("Error creating operator invite: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := queueOperatorInviteEmail(ctx, tx, *operator, token); err != nil {
+		fmt.Printf("Error queueing invite email: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := recordAudit(ctx, tx, c, schema.AuditCreate, "operator", operator.ID, nil, operator); err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": gin.H{"id": operator.ID}})
+}
+
+/*
+Accepts an operator invite by choosing a password
+
+	curl -X POST http://localhost:8080/api/operator/accept -H "Content-Type: application/json" \
+	-d '{"token":"INVITE_TOKEN","password":"correct horse battery staple"}'
+*/
+func AcceptOperatorInvite(c *gin.Context) {
+	var request AcceptInviteRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		fmt.Println(err)
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	if len(request.Password) < minPasswordLength {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   fmt.Sprintf("Password must be at least %d characters", minPasswordLength),
+		})
+		return
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+	if err != nil {
+		fmt.Printf("Error hashing password: %v", err)
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	result, err := db.NewUpdate().
+		Model((*schema.Operator)(nil)).
+		Set("password_hash = ?", string(passwordHash)).
+		Set("invite_token_hash = NULL").
+		Set("invite_expires_at = NULL").
+		Where("invite_token_hash = ?", internal.HashToken(request.Token)).
+		Where("invite_expires_at > ? AND disabled_at IS NULL", time.Now()).
+		Exec(ctx)
+	if err != nil {
+		fmt.Printf("Error accepting invite: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.AbortWithStatusJSON(http.StatusGone, gin.H{"success": false, "error": "Invite is invalid or has expired"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Invite accepted, you can now log in"})
+}
+
+/*
+Gets all operators, including disabled ones and pending invites
+
+	curl -X GET http://localhost:8080/api/operator/all -H "Authorization: Bearer YOUR API KEY"
+*/
+func GetAllOperators(c *gin.Context) {
+	var operators []schema.Operator
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	err := db.NewSelect().
+		Model(&operators).
+		ExcludeColumn("password_hash", "invite_token_hash").
+		Order("name ASC").
+		Scan(ctx)
+	if err != nil {
+		fmt.Printf("Error fetching operators: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	if operators == nil {
+		operators = []schema.Operator{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": operators})
+}
+
+/*
+Updates an operator's name or role, or disables them
+Disabling an operator logs them out everywhere; operators can't demote or disable themselves
+
+	curl -X PUT http://localhost:8080/api/operator/00000000-0000-0000-0000-000000000000 \
+		-H "Authorization: Bearer YOUR API KEY" \
+		-H "Content-Type: application/json" \
+		-d '{"role":"shop_manager","disabled":false}'
+*/
+func UpdateOperator(c *gin.Context) {
+	// Ensure operator_id is provided and is a valid UUID
+	param := c.Param("operator_id")
+	if param == "" {
+		fmt.Println("operator_id path parameter is required")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	operatorID, err := uuid.Parse(param)
+	if err != nil {
+		fmt.Println("operator_id must be a valid UUID")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	var request struct {
+		Name     *string `json:"name"`
+		Role     *string `json:"role"`
+		Disabled *bool   `json:"disabled"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		fmt.Println(err)
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	if request.Name == nil && request.Role == nil && request.Disabled == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+		return
+	}
+	if request.Role != nil && !isValidRole(*request.Role) {
+		fmt.Printf("Invalid role %s", *request.Role)
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	// Keep admins from locking themselves out
+	if internal.GetOperator(c).ID == operatorID &&
+		((request.Role != nil && *request.Role != schema.RoleAdmin) || (request.Disabled != nil && *request.Disabled)) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"success": false, "error": "You can't demote or disable yourself"})
+		return
+	}
+
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	// Begin transaction
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	// Ensure rollback if error occurs
+	defer tx.Rollback()
+
+	var existingOperator schema.Operator
+	err = tx.NewSelect().
+		Model(&existingOperator).
+		Where("id = ?", operatorID).
+		For("UPDATE").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Println("Operator not found")
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Error fetching operator: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	var operator schema.Operator
+	query := tx.NewUpdate().
+		Model(&operator).
+		Where("id = ?", operatorID).
+		Returning("*")
+	if request.Name != nil {
+		query = query.Set("name = ?", *request.Name)
+	}
+	if request.Role != nil {
+		query = query.Set("role = ?", *request.Role)
+	}
+	if request.Disabled != nil {
+		if *request.Disabled {
+			query = query.Set("disabled_at = COALESCE(disabled_at, ?)", time.Now())
+		} else {
+			query = query.Set("disabled_at = NULL")
+		}
+	}
+	if _, err := query.Exec(ctx); err != nil {
+		fmt.Printf("Error updating operator: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := recordAudit(ctx, tx, c, schema.AuditUpdate, "operator", operatorID, existingOperator, operator); err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	if request.Disabled != nil && *request.Disabled {
+		if _, err := internal.DeleteUserSessions(operatorID.String()); err != nil {
+			fmt.Printf("Error logging out disabled operator: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Operator updated successfully"})
+}
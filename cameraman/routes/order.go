@@ -1,47 +1,50 @@
 package routes
 
 import (
-	"bytes"
 	"context"
-	"embed"
+	"database/sql"
 	"errors"
 	"fmt"
-	"html/template"
 	"net/http"
 	"os"
 	"time"
 
 	"golden-arm/internal"
+	"golden-arm/money"
 	"golden-arm/schema"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/sesv2"
-	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/uptrace/bun"
 )
 
-// Fixed poster price
-const PosterPrice = 10.00
-
 type OrderRequest struct {
-	Name  string      `json:"name"`
-	Email string      `json:"email"`
-	Items []OrderItem `json:"items"`
+	Name      string      `json:"name"`
+	Email     string      `json:"email"`
+	Items     []OrderItem `json:"items"`
+	PromoCode string      `json:"promo_code,omitempty"`
+	HoldToken string      `json:"hold_token,omitempty"` // From CreateHold; the held stock is used for the order
 }
 
 type OrderItem struct {
-	MerchandiseID *uuid.UUID `json:"merchandise_id,omitempty"`
-	MovieID       *uuid.UUID `json:"movie_id,omitempty"`
+	MerchandiseID *uuid.UUID `json:"merchandise_id,omitempty"` // Enough on its own for an item with a single variant
+	VariantID     *uuid.UUID `json:"variant_id,omitempty"`     // Which variant of the merchandise
+	MovieID       *uuid.UUID `json:"movie_id,omitempty"`       // For the movie's poster
 	Quantity      int        `json:"quantity"`
-	Size          string     `json:"size,omitempty"`
+	Size          string     `json:"size,omitempty"` // Required for posters
 }
 
 type OrderResponse struct {
-	OrderID uuid.UUID `json:"order_id"`
-	Total   float64   `json:"total"`
+	OrderID     uuid.UUID   `json:"order_id"`
+	Subtotal    money.Money `json:"subtotal"`
+	Discount    money.Money `json:"discount"`
+	PromoCode   string      `json:"promo_code,omitempty"`
+	Total       money.Money `json:"total"`
+	Currency    string      `json:"currency"`
+	Status      string      `json:"status"`
+	CheckoutURL string      `json:"checkout_url,omitempty"` // Missing if the order is free or the payment provider couldn't be reached
+	PickupCode  string      `json:"pickup_code"`            // Shown at the merch table to collect the order
+	PickupQR    string      `json:"pickup_qr"`              // Text to show as a QR code for the door scanner
 }
 
 // Order confirmation email
@@ -52,10 +55,14 @@ type OrderEmailData struct {
 		Items []schema.OrderItem `json:"items"`
 	}
 	Response OrderResponse
+	PayURL   string // Where to pay online; empty if there's nothing to pay
+
+	PickupPassURL string // Where the customer can show their pickup code at the merch table
 }
 
 /*
-Adds new order
+Adds new order and starts an online checkout for it; send the customer to the returned checkout_url to pay
+An optional promo_code is applied to the order; orders it makes free are paid straight away
 
 	curl -X POST http://localhost:8080/api/order \
 		-H "Content-Type: application/json" -d \
@@ -75,13 +82,16 @@ Adds new order
 				},
 				{
 				"movie_id": "00000000-0000-0000-0000-000000000000",
-				"quantity": 1
+				"quantity": 1,
+				"size": "11x17"
 				},
 				{
 				"movie_id": "00000000-0000-0000-0000-000000000000",
-				"quantity": 2
+				"quantity": 2,
+				"size": "24x36"
 				}
-			]
+			],
+			"promo_code": "POSTERPAL"
 		}'
 */
 func AddOrder(c *gin.Context) {
@@ -106,22 +116,74 @@ func AddOrder(c *gin.Context) {
 	// Ensure rollback - undoes entire db transaction if an error occurs
 	defer tx.Rollback()
 
+	// Stock held for this shopper's cart is theirs to buy; a lapsed hold just means competing with everyone else
+	holdID := uuid.Nil
+	if newOrder.HoldToken != "" {
+		hold, err := lockActiveHold(ctx, tx, newOrder.HoldToken)
+		switch {
+		case err == nil:
+			holdID = hold.ID
+		case errors.Is(err, ErrHoldNotActive) && hold.Status == schema.HoldConverted:
+			c.JSON(http.StatusConflict, gin.H{"error": "This cart has already been ordered"})
+			return
+		case errors.Is(err, ErrHoldNotActive):
+			// Lapsed or released, so there's nothing held to use
+		case errors.Is(err, internal.ErrInvalidToken):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hold token"})
+			return
+		default:
+			fmt.Printf("Error fetching stock hold: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch hold"})
+			return
+		}
+	}
+
+	// Look up the promo code, if any, before pricing the order
+	var promo *schema.PromoCode
+	if newOrder.PromoCode != "" {
+		promo, err = lookupPromoCode(ctx, tx, newOrder.PromoCode, newOrder.Email)
+		if errors.Is(err, ErrInvalidPromo) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			fmt.Printf("Error looking up promo code: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up promo code"})
+			return
+		}
+	}
+
 	// Process order items
-	total, orderItems, err := processOrderItems(ctx, tx, newOrder.Items)
-	if err != nil {
+	total, discount, orderItems, err := processOrderItems(ctx, tx, newOrder.Items, promo, holdID)
+	if errors.Is(err, ErrInvalidPromo) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
 		c.JSON(http.StatusBadRequest, internal.ErrBadRequest)
 		return
 	}
 
+	pickupCode, err := generatePickupCode(ctx, tx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create pickup code"})
+		return
+	}
+
 	// Create order
 	orderID := uuid.New()
 	order := schema.Order{
-		ID:    orderID,
-		Name:  newOrder.Name,
-		Email: newOrder.Email,
-		Date:  time.Now(),
-		Total: total,
-		Paid:  false,
+		ID:       orderID,
+		Name:     newOrder.Name,
+		Email:    newOrder.Email,
+		Date:     time.Now(),
+		Total:    total,
+		Currency: money.Currency(),
+		Status:   schema.OrderPending,
+		Discount: discount,
+
+		PickupCode: pickupCode,
+	}
+	if promo != nil {
+		order.PromoCode = promo.Code
 	}
 
 	_, err = tx.NewInsert().Model(&order).Exec(ctx)
@@ -139,16 +201,62 @@ func AddOrder(c *gin.Context) {
 		}
 	}
 
+	// The hold's stock is now sold
+	if holdID != uuid.Nil {
+		_, err := tx.NewUpdate().
+			Model((*schema.StockHold)(nil)).
+			Set("status = ?", schema.HoldConverted).
+			Set("order_id = ?", orderID).
+			Where("id = ?", holdID).
+			Exec(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to convert hold"})
+			return
+		}
+	}
+
+	// Record the promo code's use, counting towards its limits
+	if promo != nil {
+		redemption := schema.PromoRedemption{
+			ID:          uuid.New(),
+			PromoCodeID: promo.ID,
+			OrderID:     orderID,
+			Email:       newOrder.Email,
+			Discount:    discount,
+			Date:        order.Date,
+		}
+		if _, err := tx.NewInsert().Model(&redemption).Exec(ctx); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record promo code"})
+			return
+		}
+	}
+
 	// Update inventory
 	if err := updateInventory(ctx, tx, orderItems); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// Nothing to pay for, e.g. a free poster
+	if total == 0 {
+		if err := transitionOrder(ctx, tx, &order, schema.OrderPaid, uuid.Nil); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark free order paid"})
+			return
+		}
+	}
+
 	// Prepare response
 	response := OrderResponse{
-		OrderID: orderID,
-		Total:   total,
+		OrderID:   orderID,
+		Subtotal:  total + discount,
+		Discount:  discount,
+		PromoCode: order.PromoCode,
+		Total:     total,
+		Currency:  order.Currency,
+		Status:    order.Status,
+
+		PickupCode: order.PickupCode,
+		PickupQR:   PickupQRPayload(order.PickupCode),
 	}
 
 	// Prepare email data with schema.OrderItem that includes relationships
@@ -156,6 +264,7 @@ func AddOrder(c *gin.Context) {
 	err = tx.NewSelect().
 		Model(&orderItemsWithRelations).
 		Relation("Merchandise").
+		Relation("Variant").
 		Relation("Movie").
 		Where("order_id = ?", orderID).
 		Scan(ctx)
@@ -164,7 +273,7 @@ func AddOrder(c *gin.Context) {
 		return
 	}
 
-	// Send confirmation email
+	// Prepare confirmation email
 	emailData := OrderEmailData{
 		Order: struct {
 			Name  string             `json:"name"`
@@ -177,30 +286,46 @@ func AddOrder(c *gin.Context) {
 		},
 		Response: response,
 	}
+	if order.Status == schema.OrderPending {
+		emailData.PayURL = OrderCheckoutURL(orderID)
+	}
+	emailData.PickupPassURL = PickupPassURL(order.PickupCode)
 
-	if err := sendOrderConfirmationEmail(emailData); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to send confirmation email: %v", err)})
+	// Queued email is only sent if the order commits
+	if err := queueOrderConfirmationEmail(ctx, tx, emailData); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to queue confirmation email: %v", err)})
 		return
 	}
 
-	// Only commit if email was sent successfully
 	if err := tx.Commit(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
 		return
 	}
 
+	// The order stands even if the payment provider is down; the customer can pay later from the link in their email
+	if order.Status == schema.OrderPending {
+		session, err := createOrderCheckout(ctx, schema.GetDBConn(), order)
+		if err != nil {
+			fmt.Printf("Error creating checkout for order %s: %v", orderID, err)
+		} else {
+			response.CheckoutURL = session.URL
+		}
+	}
+
 	// Return success response
 	c.JSON(http.StatusCreated, response)
 }
 
-// Validates order items and calculates the total cost
-func processOrderItems(ctx context.Context, tx bun.Tx, items []OrderItem) (float64, []schema.OrderItem, error) {
-	var total float64
+// Validates order items and calculates the total cost, less any discount from the promo code (which may be nil)
+// Stock in other shoppers' active holds isn't available; holdID is the shopper's own hold, or uuid.Nil
+// Returns the total, the discount, and the items
+func processOrderItems(ctx context.Context, tx bun.Tx, items []OrderItem, promo *schema.PromoCode, holdID uuid.UUID) (money.Money, money.Money, []schema.OrderItem, error) {
+	var total money.Money
 	var orderItems []schema.OrderItem
 
 	for _, item := range items {
 		if item.Quantity <= 0 {
-			return 0, nil, errors.New("quantity must be positive")
+			return 0, 0, nil, errors.New("quantity must be positive")
 		}
 
 		orderItem := schema.OrderItem{
@@ -209,166 +334,201 @@ func processOrderItems(ctx context.Context, tx bun.Tx, items []OrderItem) (float
 		}
 
 		// Process merchandise item
-		if item.MerchandiseID != nil {
+		if item.VariantID != nil || item.MerchandiseID != nil {
+			var variants []schema.MerchandiseVariant
+			query := tx.NewSelect().Model(&variants).For("UPDATE")
+			if item.VariantID != nil {
+				query = query.Where("id = ?", item.VariantID)
+			} else {
+				// Without a variant, the item can't have more than one to choose from
+				query = query.Where("merchandise_id = ?", item.MerchandiseID).Limit(2)
+			}
+			err := query.Scan(ctx)
+			if err != nil || len(variants) == 0 {
+				return 0, 0, nil, errors.New("merchandise not found")
+			}
+			if len(variants) > 1 {
+				return 0, 0, nil, errors.New("variant_id is required for this merchandise")
+			}
+			variant := variants[0]
+			if item.MerchandiseID != nil && *item.MerchandiseID != variant.MerchandiseID {
+				return 0, 0, nil, errors.New("variant is not of this merchandise")
+			}
+
 			var merch schema.Merchandise
-			err := tx.NewSelect().Model(&merch).Where("id = ?", item.MerchandiseID).Scan(ctx)
+			err = tx.NewSelect().Model(&merch).Where("id = ?", variant.MerchandiseID).Scan(ctx)
 			if err != nil {
-				return 0, nil, errors.New("merchandise not found")
+				return 0, 0, nil, errors.New("merchandise not found")
 			}
 
-			// Set merchandise-specific fields
-			orderItem.MerchandiseID = item.MerchandiseID
-			orderItem.MovieID = nil
-			orderItem.Price = merch.Price
-			orderItem.Size = item.Size
-
-			// Validate size and check inventory if size is specified
-			if item.Size != "" {
-				var merchSize schema.MerchandiseSize
-				err := tx.NewSelect().Model(&merchSize).
-					Where("merchandise_id = ? AND size = ?", item.MerchandiseID, item.Size).
-					Scan(ctx)
+			options, err := getMerchOptions(ctx, tx, merch.ID)
+			if err != nil {
+				return 0, 0, nil, errors.New("merchandise not found")
+			}
 
+			// Pre-orders are printed to order, so they don't come out of stock
+			if preorderOpen(merch, time.Now()) {
+				orderItem.Preorder = true
+			} else {
+				held, err := getHeldQuantity(ctx, tx, stockKey{VariantID: variant.ID}, holdID)
 				if err != nil {
-					return 0, nil, errors.New("size not available for this merchandise")
+					return 0, 0, nil, errors.New("could not check inventory")
 				}
 
-				if merchSize.Quantity < item.Quantity {
-					return 0, nil, errors.New("insufficient inventory for " + merch.Name + " size " + item.Size)
+				if variant.Quantity-held < item.Quantity {
+					return 0, 0, nil, errors.New("insufficient inventory for " + merch.Name + " " + variant.SKU)
 				}
 			}
 
-			total += merch.Price * float64(item.Quantity)
+			// Set merchandise-specific fields
+			orderItem.MerchandiseID = &merch.ID
+			orderItem.VariantID = &variant.ID
+			orderItem.MovieID = nil
+			orderItem.Price = merch.Price
+			if variant.Price != 0 {
+				orderItem.Price = variant.Price
+			}
+			orderItem.Size = variantLabel(options, variant)
+
+			total += orderItem.Price.Times(item.Quantity)
 		} else if item.MovieID != nil {
 			// Process movie poster item
-			var movie schema.Movie
-			err := tx.NewSelect().Model(&movie).Where("id = ?", item.MovieID).Scan(ctx)
+			var poster schema.Poster
+			err := tx.NewSelect().Model(&poster).Where("movie_id = ?", item.MovieID).Scan(ctx)
+			if err != nil || !poster.Available {
+				return 0, 0, nil, errors.New("poster not available for this movie")
+			}
+			if item.Size == "" {
+				return 0, 0, nil, errors.New("size is required for posters")
+			}
+
+			var posterSize schema.PosterSize
+			err = tx.NewSelect().Model(&posterSize).
+				Where("poster_id = ? AND size = ?", poster.ID, item.Size).
+				For("UPDATE").
+				Scan(ctx)
+			if err != nil || !posterSize.Available {
+				return 0, 0, nil, errors.New("size not available for this poster")
+			}
+
+			held, err := getHeldQuantity(ctx, tx, stockKey{MovieID: *item.MovieID, Size: item.Size}, holdID)
 			if err != nil {
-				return 0, nil, errors.New("movie not found")
+				return 0, 0, nil, errors.New("could not check inventory")
 			}
 
-			// Set movie-specific fields
+			if posterSize.Quantity-held < item.Quantity {
+				return 0, 0, nil, errors.New("insufficient inventory for poster size " + item.Size)
+			}
+
+			// Set poster-specific fields
 			orderItem.MovieID = item.MovieID
 			orderItem.MerchandiseID = nil
-			orderItem.Price = PosterPrice
-			orderItem.Size = "" // No size for movie posters
+			orderItem.Price = posterSize.Price
+			orderItem.Size = item.Size
 
-			total += PosterPrice * float64(item.Quantity)
+			total += posterSize.Price.Times(item.Quantity)
 		} else {
-			return 0, nil, errors.New("either merchandise_id or movie_id must be provided")
+			return 0, 0, nil, errors.New("either variant_id or movie_id must be provided")
 		}
 
 		orderItems = append(orderItems, orderItem)
 	}
 
-	return total, orderItems, nil
+	// Apply the promo code now that the whole order is known
+	var discount money.Money
+	if promo != nil {
+		var err error
+		discount, err = applyPromoCode(promo, orderItems, total)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+	}
+
+	return total - discount, discount, orderItems, nil
+}
+
+// Points an inventory movement at the merchandise variant or poster size an order item came from
+// Returns false for items whose stock isn't tracked, including pre-orders, which are printed to order,
+// and posters whose size has since been deleted
+func setMovementItem(ctx context.Context, tx bun.Tx, movement *schema.InventoryMovement, item schema.OrderItem) (bool, error) {
+	if item.Preorder {
+		return false, nil
+	}
+	if item.VariantID != nil {
+		movement.VariantID = item.VariantID
+		return true, nil
+	}
+	if item.MovieID == nil || item.Size == "" {
+		return false, nil
+	}
+
+	var posterSizeID uuid.UUID
+	err := tx.NewSelect().
+		Model((*schema.PosterSize)(nil)).
+		Column("id").
+		Where("poster_id = (SELECT id FROM posters WHERE movie_id = ?) AND size = ?", item.MovieID, item.Size).
+		Scan(ctx, &posterSizeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	movement.PosterSizeID = &posterSizeID
+	return true, nil
 }
 
-// Reduces the quantity of merchandise in inventory according to the order
+// Reduces the quantity of merchandise in inventory according to the order, recording each sale in the inventory ledger
 func updateInventory(ctx context.Context, tx bun.Tx, items []schema.OrderItem) error {
 	for _, item := range items {
-		// Only update inventory for merchandise items with a size
-		if item.MerchandiseID != nil && item.Size != "" {
-			result, err := tx.NewUpdate().Model((*schema.MerchandiseSize)(nil)).
-				Set("quantity = quantity - ?", item.Quantity).
-				Where("merchandise_id = ? AND size = ? AND quantity >= ?",
-					item.MerchandiseID, item.Size, item.Quantity).
-				Exec(ctx)
+		movement := schema.InventoryMovement{
+			Kind:    schema.MovementSale,
+			Change:  -item.Quantity,
+			OrderID: item.OrderID,
+			Reason:  "Ordered",
+		}
 
-			if err != nil {
-				return err
-			}
+		// Only update inventory for merchandise variants and poster sizes
+		tracked, err := setMovementItem(ctx, tx, &movement, item)
+		if err != nil {
+			return errors.New("could not update inventory")
+		}
+		if !tracked {
+			continue
+		}
 
-			rowsAffected, err := result.RowsAffected()
-			if err != nil || rowsAffected == 0 {
-				return errors.New("could not update inventory")
-			}
+		err = moveStock(ctx, tx, movement)
+		if errors.Is(err, ErrInsufficientStock) {
+			return errors.New("could not update inventory")
+		} else if err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-//go:embed templates/*
-var orderEmailTemplate embed.FS
-
-func sendOrderConfirmationEmail(data OrderEmailData) error {
-	// Load AWS config
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+// Queues the order confirmation email in the outbox
+func queueOrderConfirmationEmail(ctx context.Context, db bun.IDB, data OrderEmailData) error {
+	body, err := renderEmailTemplate("order_email.html", nil, data)
 	if err != nil {
-		return fmt.Errorf("failed to load AWS config: %w", err)
+		return err
 	}
 
-	// Create SESv2 client
-	client := sesv2.NewFromConfig(cfg)
-
-	// Prepare template
-	base := template.New("order_email.html")
-	base.Funcs(template.FuncMap{
-		"mul": func(price float64, quantity int) float64 {
-			return price * float64(quantity)
-		},
-	})
-	tmpl, err := base.ParseFS(orderEmailTemplate, "templates/order_email.html")
-	if err != nil {
-		return fmt.Errorf("failed to parse email template: %w", err)
-	}
-
-	var body bytes.Buffer
-	if err := tmpl.Execute(&body, data); err != nil {
-		return fmt.Errorf("failed to execute email template: %w", err)
-	}
-
-	// Compose email
 	from := os.Getenv("ORDERS_SENDER")
-	replyTo := os.Getenv("REPLYTO")
-	to := data.Order.Email
-	cc := replyTo // Optional: admin copy
 	subject := "Confirming your order at The Golden Arm"
 
-	input := &sesv2.SendEmailInput{
-		FromEmailAddress: aws.String(from),
-		Destination: &types.Destination{
-			ToAddresses: []string{to},
-			CcAddresses: []string{cc},
-		},
-		ReplyToAddresses: []string{replyTo},
-		Content: &types.EmailContent{
-			Simple: &types.Message{
-				Subject: &types.Content{
-					Data: aws.String(subject),
-				},
-				Body: &types.Body{
-					Html: &types.Content{
-						Data: aws.String(body.String()),
-					},
-				},
-			},
-		},
-	}
-
-	out, err := client.SendEmail(context.TODO(), input)
-	if err != nil {
-		return fmt.Errorf("failed to send email: %w", err)
-	}
-
-	fmt.Printf("Confirmation email sent to %s (SES Message ID: %s)\n", to, aws.ToString(out.MessageId))
-	return nil
+	return queueEmail(ctx, db, from, data.Order.Email, subject, body)
 }
 
 /*
-Updates an order's payment status
+Moves an order to a new status; see orderTransitions for the allowed changes
+Cancelling, or refunding before pickup, restocks the order's items; set notify to email the customer
 
 	curl -X PUT http://localhost:8080/api/order/status/:order_id -H "Authorization: Bearer YOUR API KEY" \
 		-H "Content-Type: application/json" \
-		-d '{"paid": true}'
+		-d '{"status": "ready", "notify": true}'
 */
 func UpdateOrderStatus(c *gin.Context) {
-	if !internal.CheckAuthorization(c) {
-		c.AbortWithError(http.StatusUnauthorized, internal.ErrUnauthorized)
-		return
-	}
-
 	// Get order ID from URL parameter
 	orderID, err := uuid.Parse(c.Param("order_id"))
 	if err != nil {
@@ -378,48 +538,84 @@ func UpdateOrderStatus(c *gin.Context) {
 
 	// Parse request body
 	var request struct {
-		Paid bool `json:"paid"`
+		Status string `json:"status" binding:"required"`
+		Notify bool   `json:"notify"`
 	}
 	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, internal.ErrBadRequest)
 		return
 	}
+	if !isValidOrderStatus(request.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order status"})
+		return
+	}
 
-	// Update order in database
-	db := schema.GetDBConn()
+	// Begin transaction
 	ctx := context.Background()
+	tx, err := schema.GetDBConn().BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
 
-	result, err := db.NewUpdate().
-		Model((*schema.Order)(nil)).
-		Set("paid = ?", request.Paid).
+	var existingOrder schema.Order
+	err = tx.NewSelect().
+		Model(&existingOrder).
 		Where("id = ?", orderID).
-		Exec(ctx)
+		For("UPDATE").
+		Scan(ctx)
 
 	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	// Update order in database
+	order := existingOrder
+	err = transitionOrder(ctx, tx, &order, request.Status, internal.GetOperator(c).ID)
+	if errors.Is(err, ErrInvalidOrderTransition) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   fmt.Sprintf("Order can't go from %s to %s", existingOrder.Status, request.Status),
+		})
+		return
+	} else if err != nil {
+		fmt.Printf("Error updating order status: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order"})
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+	if request.Notify {
+		if err := queueOrderStatusEmail(ctx, tx, order); err != nil {
+			fmt.Printf("Error queueing order status email: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue status email"})
+			return
+		}
+	}
+
+	if err := recordAudit(ctx, tx, c, schema.AuditUpdate, "order", orderID, existingOrder, order); err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit entry"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"success": true})
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": order})
 }
 
 /*
-Deletes an order and restores inventory
+Deletes a pending or cancelled order, restoring inventory if it was pending
+Orders that were paid keep their history of refunds, handovers and status changes; refund them instead
 
 	curl -X DELETE http://localhost:8080/api/order/:order_id -H "Authorization: Bearer YOUR API KEY"
 */
 func DeleteOrder(c *gin.Context) {
-	if !internal.CheckAuthorization(c) {
-		c.AbortWithError(http.StatusUnauthorized, internal.ErrUnauthorized)
-		return
-	}
-
 	// Get order ID from URL parameter
 	orderID, err := uuid.Parse(c.Param("order_id"))
 	if err != nil {
@@ -436,17 +632,25 @@ func DeleteOrder(c *gin.Context) {
 	}
 	defer tx.Rollback()
 
-	// Check if the order exists and get its payment status
+	// Check if the order exists and get its payment status; locked so it can't be paid meanwhile
 	var order schema.Order
 	err = tx.NewSelect().
 		Model(&order).
 		Where("id = ?", orderID).
+		For("UPDATE").
 		Scan(ctx)
 
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		return
 	}
+	if order.Status != schema.OrderPending && order.Status != schema.OrderCancelled {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   fmt.Sprintf("Can't delete a %s order; only pending and cancelled orders can be deleted", order.Status),
+		})
+		return
+	}
 
 	// Fetch the order items
 	var orderItems []schema.OrderItem
@@ -460,9 +664,9 @@ func DeleteOrder(c *gin.Context) {
 		return
 	}
 
-	// Only restore inventory if the order was unpaid
-	if !order.Paid {
-		if err := restoreInventory(ctx, tx, orderItems); err != nil {
+	// Only restore inventory if the order was still waiting for payment; cancelled orders were already restocked
+	if order.Status == schema.OrderPending {
+		if err := restoreInventory(ctx, tx, orderItems, stockMovement(c, schema.MovementReturn, "Order deleted")); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -496,6 +700,16 @@ func DeleteOrder(c *gin.Context) {
 		return
 	}
 
+	before := struct {
+		schema.Order
+		Items []schema.OrderItem
+	}{order, orderItems}
+	if err := recordAudit(ctx, tx, c, schema.AuditDelete, "order", orderID, before, nil); err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit entry"})
+		return
+	}
+
 	// Commit transaction
 	if err := tx.Commit(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
@@ -505,25 +719,29 @@ func DeleteOrder(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
-// Restores inventory quantities when an order is deleted
-func restoreInventory(ctx context.Context, tx bun.Tx, items []schema.OrderItem) error {
+// Restores inventory quantities when an order is deleted, cancelled, or refunded before pickup
+// movement says who's returning the stock and why; each item is recorded in the inventory ledger
+func restoreInventory(ctx context.Context, tx bun.Tx, items []schema.OrderItem, movement schema.InventoryMovement) error {
 	for _, item := range items {
-		// Only update inventory for merchandise items with a size
-		if item.MerchandiseID != nil && item.Size != "" {
-			result, err := tx.NewUpdate().Model((*schema.MerchandiseSize)(nil)).
-				Set("quantity = quantity + ?", item.Quantity).
-				Where("merchandise_id = ? AND size = ?",
-					item.MerchandiseID, item.Size).
-				Exec(ctx)
+		if item.Quantity <= 0 {
+			continue
+		}
+		itemMovement := movement
+		itemMovement.Kind = schema.MovementReturn
+		itemMovement.Change = item.Quantity
+		itemMovement.OrderID = item.OrderID
 
-			if err != nil {
-				return err
-			}
+		// Only update inventory for merchandise variants and poster sizes
+		tracked, err := setMovementItem(ctx, tx, &itemMovement, item)
+		if err != nil {
+			return errors.New("could not restore inventory for poster of movie ID: " + item.MovieID.String())
+		}
+		if !tracked {
+			continue
+		}
 
-			rowsAffected, err := result.RowsAffected()
-			if err != nil || rowsAffected == 0 {
-				return errors.New("could not restore inventory for merchandise ID: " + item.MerchandiseID.String())
-			}
+		if err := moveStock(ctx, tx, itemMovement); err != nil {
+			return fmt.Errorf("could not restore inventory: %w", err)
 		}
 	}
 
@@ -531,35 +749,43 @@ func restoreInventory(ctx context.Context, tx bun.Tx, items []schema.OrderItem)
 }
 
 /*
-Gets all orders in the database with their items
+Gets all orders in the database with their items and status history
+Optionally filtered by status
 
-	curl -X GET http://localhost:8080/api/order/all -H "Authorization: Bearer YOUR API KEY"
+	curl -X GET "http://localhost:8080/api/order/all?status=paid" -H "Authorization: Bearer YOUR API KEY"
 */
 func GetAllOrders(c *gin.Context) {
-	if !internal.CheckAuthorization(c) {
-		c.AbortWithError(http.StatusUnauthorized, internal.ErrUnauthorized)
-		return
-	}
-
 	type OrderItem struct {
 		ID            uuid.UUID           `json:"id"`
 		MerchandiseID *uuid.UUID          `json:"merchandise_id,omitempty"`
+		VariantID     *uuid.UUID          `json:"variant_id,omitempty"`
 		MovieID       *uuid.UUID          `json:"movie_id,omitempty"`
 		Quantity      int                 `json:"quantity"`
 		Size          string              `json:"size,omitempty"`
-		Price         float64             `json:"price"`
+		Price         money.Money         `json:"price"`
+		Discount      money.Money         `json:"discount"`
+		Refunded      int                 `json:"refunded_quantity"`
+		Preorder      bool                `json:"preorder"`
 		Merchandise   *schema.Merchandise `json:"merchandise,omitempty"`
 		Movie         *schema.Movie       `json:"movie,omitempty"`
 	}
 
 	type OrderWithItems struct {
-		ID    uuid.UUID   `json:"id"`
-		Name  string      `json:"name"`
-		Email string      `json:"email"`
-		Date  time.Time   `json:"date"`
-		Total float64     `json:"total"`
-		Paid  bool        `json:"paid"`
-		Items []OrderItem `json:"items"`
+		ID            uuid.UUID                  `json:"id"`
+		Name          string                     `json:"name"`
+		Email         string                     `json:"email"`
+		Date          time.Time                  `json:"date"`
+		Total         money.Money                `json:"total"`
+		Discount      money.Money                `json:"discount"`
+		PromoCode     string                     `json:"promo_code,omitempty"`
+		Refunded      money.Money                `json:"refunded"`
+		NetTotal      money.Money                `json:"net_total"` // Total less refunds
+		Currency      string                     `json:"currency"`
+		Status        string                     `json:"status"`
+		PickupCode    string                     `json:"pickup_code"`
+		Items         []OrderItem                `json:"items"`
+		StatusChanges []schema.OrderStatusChange `json:"status_changes"`
+		Refunds       []schema.OrderRefund       `json:"refunds"`
 	}
 
 	var orders []schema.Order
@@ -567,9 +793,16 @@ func GetAllOrders(c *gin.Context) {
 	ctx := context.Background()
 
 	// Fetch all orders from the database
-	err := db.NewSelect().
-		Model(&orders).
-		Scan(ctx)
+	query := db.NewSelect().
+		Model(&orders)
+	if status := c.Query("status"); status != "" {
+		if !isValidOrderStatus(status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order status"})
+			return
+		}
+		query = query.Where("status = ?", status)
+	}
+	err := query.Scan(ctx)
 
 	if err != nil {
 		fmt.Printf("Error fetching orders: %v", err)
@@ -594,29 +827,74 @@ func GetAllOrders(c *gin.Context) {
 			return
 		}
 
+		statusChanges := []schema.OrderStatusChange{}
+		err = db.NewSelect().
+			Model(&statusChanges).
+			Where("order_id = ?", order.ID).
+			Order("date ASC").
+			Scan(ctx)
+
+		if err != nil {
+			fmt.Printf("Error fetching order status changes: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+
+		refunds := []schema.OrderRefund{}
+		err = db.NewSelect().
+			Model(&refunds).
+			Relation("Items").
+			Where("order_id = ?", order.ID).
+			Order("date ASC").
+			Scan(ctx)
+
+		if err != nil {
+			fmt.Printf("Error fetching order refunds: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+		refunded := make(map[uuid.UUID]int)
+		for _, refund := range refunds {
+			for _, item := range refund.Items {
+				refunded[item.OrderItemID] += item.Quantity
+			}
+		}
+
 		// Convert schema items to our simplified response items
 		responseItems := make([]OrderItem, len(schemaItems))
 		for i, item := range schemaItems {
 			responseItems[i] = OrderItem{
 				ID:            item.ID,
 				MerchandiseID: item.MerchandiseID,
+				VariantID:     item.VariantID,
 				MovieID:       item.MovieID,
 				Quantity:      item.Quantity,
 				Size:          item.Size,
 				Price:         item.Price,
+				Discount:      item.Discount,
+				Refunded:      refunded[item.ID],
+				Preorder:      item.Preorder,
 				Merchandise:   item.Merchandise,
 				Movie:         item.Movie,
 			}
 		}
 
 		result = append(result, OrderWithItems{
-			ID:    order.ID,
-			Name:  order.Name,
-			Email: order.Email,
-			Date:  order.Date,
-			Total: order.Total,
-			Paid:  order.Paid,
-			Items: responseItems,
+			ID:            order.ID,
+			Name:          order.Name,
+			Email:         order.Email,
+			Date:          order.Date,
+			Total:         order.Total,
+			Discount:      order.Discount,
+			PromoCode:     order.PromoCode,
+			Refunded:      order.Refunded,
+			NetTotal:      order.Total - order.Refunded,
+			Currency:      order.Currency,
+			Status:        order.Status,
+			PickupCode:    order.PickupCode,
+			Items:         responseItems,
+			StatusChanges: statusChanges,
+			Refunds:       refunds,
 		})
 	}
 
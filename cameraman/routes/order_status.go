@@ -0,0 +1,164 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golden-arm/money"
+	"golden-arm/schema"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+var ErrInvalidOrderTransition = errors.New("order can't move to this status")
+
+// Statuses each order status can move to; cancelled and refunded orders are final
+var orderTransitions = map[string][]string{
+	schema.OrderPending:  {schema.OrderPaid, schema.OrderCancelled},
+	schema.OrderPaid:     {schema.OrderReady, schema.OrderRefunded},
+	schema.OrderReady:    {schema.OrderPickedUp, schema.OrderRefunded},
+	schema.OrderPickedUp: {schema.OrderRefunded},
+}
+
+// Order status update email
+type OrderStatusEmailData struct {
+	To       string
+	Name     string
+	OrderID  uuid.UUID
+	Status   string
+	Total    money.Money
+	Currency string
+}
+
+func isValidOrderStatus(status string) bool {
+	switch status {
+	case schema.OrderPending, schema.OrderPaid, schema.OrderReady,
+		schema.OrderPickedUp, schema.OrderCancelled, schema.OrderRefunded:
+		return true
+	}
+	return false
+}
+
+// Items go back into stock if the order is called off before the customer took them home
+// Items handed over before a paid or ready order is refunded aren't restocked; see transitionOrder
+func orderRestocks(from string, to string) bool {
+	return to == schema.OrderCancelled || (to == schema.OrderRefunded && from != schema.OrderPickedUp)
+}
+
+// Moves an order to a new status, restocking its items if needed, and records the change in its history
+// actorID is the operator making the change, or uuid.Nil if it's automatic
+// Returns ErrInvalidOrderTransition if the order can't move from its current status to the new one
+func transitionOrder(ctx context.Context, tx bun.Tx, order *schema.Order, status string, actorID uuid.UUID) error {
+	if !slices.Contains(orderTransitions[order.Status], status) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidOrderTransition, order.Status, status)
+	}
+
+	if orderRestocks(order.Status, status) {
+		var items []schema.OrderItem
+		err := tx.NewSelect().
+			Model(&items).
+			Where("order_id = ?", order.ID).
+			Scan(ctx)
+		if err != nil {
+			return err
+		}
+
+		// Items refunded on their own were restocked, or written off, then
+		refunded, err := getRefundedQuantities(ctx, tx, order.ID)
+		if err != nil {
+			return err
+		}
+		// Items already handed over left with the customer
+		fulfilled, err := getFulfilledQuantities(ctx, tx, order.ID)
+		if err != nil {
+			return err
+		}
+		for i := range items {
+			items[i].Quantity -= refunded[items[i].ID] + fulfilled[items[i].ID]
+		}
+
+		movement := schema.InventoryMovement{
+			ActorID: actorID,
+			Reason:  "Order " + status,
+		}
+		if err := restoreInventory(ctx, tx, items, movement); err != nil {
+			return err
+		}
+	}
+
+	// Only move the order if nobody else has since
+	query := tx.NewUpdate().
+		Model((*schema.Order)(nil)).
+		Set("status = ?", status).
+		Where("id = ? AND status = ?", order.ID, order.Status)
+	if status == schema.OrderRefunded {
+		// Whatever wasn't already refunded item by item goes back too
+		query = query.Set("refunded_cents = total_cents")
+	}
+	result, err := query.Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fmt.Errorf("%w: order status changed concurrently", ErrInvalidOrderTransition)
+	}
+
+	change := schema.OrderStatusChange{
+		ID:         uuid.New(),
+		OrderID:    order.ID,
+		FromStatus: order.Status,
+		ToStatus:   status,
+		ActorID:    actorID,
+		Date:       time.Now(),
+	}
+	if _, err := tx.NewInsert().Model(&change).Exec(ctx); err != nil {
+		return err
+	}
+
+	order.Status = status
+	if status == schema.OrderRefunded {
+		order.Refunded = order.Total
+	}
+	return nil
+}
+
+// Queues an email telling the customer their order's new status
+func queueOrderStatusEmail(ctx context.Context, db bun.IDB, order schema.Order) error {
+	data := OrderStatusEmailData{
+		To:       order.Email,
+		Name:     order.Name,
+		OrderID:  order.ID,
+		Status:   order.Status,
+		Total:    order.Total,
+		Currency: order.Currency,
+	}
+
+	body, err := renderEmailTemplate("order_status_email.html", nil, data)
+	if err != nil {
+		return err
+	}
+
+	from := os.Getenv("ORDERS_SENDER")
+	var subject string
+	switch order.Status {
+	case schema.OrderPaid:
+		subject = "We've received your payment"
+	case schema.OrderReady:
+		subject = "Your order is ready for pickup"
+	case schema.OrderPickedUp:
+		subject = "Thanks for picking up your order"
+	case schema.OrderCancelled:
+		subject = "Your order was cancelled"
+	case schema.OrderRefunded:
+		subject = "Your order was refunded"
+	default:
+		subject = "An update on your order"
+	}
+	subject += " @ The Golden Arm"
+
+	return queueEmail(ctx, db, from, data.To, subject, body)
+}
@@ -0,0 +1,242 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"golden-arm/internal"
+	"golden-arm/schema"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+// Default for EMAIL_MAX_ATTEMPTS
+const defaultEmailMaxAttempts = 8
+
+// How often the outbox is checked for emails that are due
+const emailWorkerInterval = 15 * time.Second
+
+// Retries back off exponentially from emailRetryBase, doubling after each failed attempt up to emailRetryMax
+const (
+	emailRetryBase = time.Minute
+	emailRetryMax  = 6 * time.Hour
+)
+
+// Returns how many times an email is attempted before it's dead-lettered, e.g. EMAIL_MAX_ATTEMPTS=5
+func emailMaxAttempts() int {
+	max, err := strconv.Atoi(os.Getenv("EMAIL_MAX_ATTEMPTS"))
+	if err != nil || max <= 0 {
+		return defaultEmailMaxAttempts
+	}
+	return max
+}
+
+// Returns how long to wait before retrying an email that has failed the given number of times
+func emailRetryDelay(attempts int) time.Duration {
+	delay := emailRetryBase
+	for i := 1; i < attempts && delay < emailRetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, emailRetryMax)
+}
+
+// Sends the next email that is due, if any, and records the outcome
+// Returns false once there's nothing left to send
+func deliverNextEmail(ctx context.Context) (bool, error) {
+	db := schema.GetDBConn()
+
+	found := false
+	err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// Lock the email so other workers skip it while it's being sent
+		var email schema.OutboxEmail
+		err := tx.NewSelect().
+			Model(&email).
+			Where("status = ? AND next_attempt_at <= ?", schema.EmailPending, time.Now()).
+			Order("next_attempt_at ASC").
+			Limit(1).
+			For("UPDATE SKIP LOCKED").
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		found = true
+
+		email.Attempts++
+		messageID, err := sendEmail(ctx, email.Sender, email.Recipient, email.Subject, email.Body, email.Attachments)
+		if err == nil {
+			now := time.Now()
+			email.Status = schema.EmailSent
+			email.MessageID = messageID
+			email.SentAt = &now
+			email.LastError = ""
+			fmt.Printf("Email \"%s\" sent to %s (Message ID: %s)\n", email.Subject, email.Recipient, messageID)
+		} else {
+			email.LastError = err.Error()
+			if email.Attempts >= emailMaxAttempts() {
+				email.Status = schema.EmailFailed
+				fmt.Printf("Giving up on email %s to %s after %d attempts: %v\n", email.ID, email.Recipient, email.Attempts, err)
+			} else {
+				email.NextAttemptAt = time.Now().Add(emailRetryDelay(email.Attempts))
+				fmt.Printf("Error sending email %s to %s, retrying at %s: %v\n", email.ID, email.Recipient, email.NextAttemptAt, err)
+			}
+		}
+
+		_, err = tx.NewUpdate().
+			Model(&email).
+			Column("status", "attempts", "next_attempt_at", "last_error", "message_id", "sent_at").
+			WherePK().
+			Exec(ctx)
+		return err
+	})
+
+	return found, err
+}
+
+// Periodically sends queued emails in the background
+func StartEmailWorker() {
+	go func() {
+		ticker := time.NewTicker(emailWorkerInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			for {
+				found, err := deliverNextEmail(context.Background())
+				if err != nil {
+					fmt.Printf("Error delivering email: %v\n", err)
+				}
+				if err != nil || !found {
+					break
+				}
+			}
+		}
+	}()
+}
+
+/*
+Gets emails in the outbox, most recent first, optionally filtered by status (pending, sent, or failed)
+Email bodies are left out
+
+	curl -X GET "http://localhost:8080/api/outbox?status=failed" -H "Authorization: Bearer YOUR API KEY"
+*/
+func GetOutbox(c *gin.Context) {
+	status := c.Query("status")
+	if status != "" && status != schema.EmailPending && status != schema.EmailSent && status != schema.EmailFailed {
+		fmt.Println("status must be pending, sent, or failed")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	var emails []schema.OutboxEmail
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	query := db.NewSelect().
+		Model(&emails).
+		ExcludeColumn("body", "attachments").
+		Order("created_at DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Scan(ctx); err != nil {
+		fmt.Printf("Error fetching outbox: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	if emails == nil {
+		emails = []schema.OutboxEmail{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": emails})
+}
+
+/*
+Queues a failed email to be sent again with a fresh set of attempts
+
+	curl -X POST http://localhost:8080/api/outbox/00000000-0000-0000-0000-000000000000/resend \
+	-H "Authorization: Bearer YOUR API KEY"
+*/
+func ResendEmail(c *gin.Context) {
+	// Ensure email_id is provided and is a valid UUID
+	param := c.Param("email_id")
+	if param == "" {
+		fmt.Println("email_id path parameter is required")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	emailID, err := uuid.Parse(param)
+	if err != nil {
+		fmt.Println("email_id must be a valid UUID")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	// Begin transaction
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	// Ensure rollback if error occurs
+	defer tx.Rollback()
+
+	var email schema.OutboxEmail
+	err = tx.NewSelect().
+		Model(&email).
+		ExcludeColumn("body", "attachments").
+		Where("id = ?", emailID).
+		For("UPDATE").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Println("Email not found")
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Error fetching email: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	if email.Status != schema.EmailFailed {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"success": false, "error": "Only failed emails can be re-sent"})
+		return
+	}
+
+	requeued := email
+	requeued.Status = schema.EmailPending
+	requeued.Attempts = 0
+	requeued.NextAttemptAt = time.Now()
+	_, err = tx.NewUpdate().
+		Model(&requeued).
+		Column("status", "attempts", "next_attempt_at").
+		WherePK().
+		Exec(ctx)
+	if err != nil {
+		fmt.Printf("Error re-queueing email: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := recordAudit(ctx, tx, c, schema.AuditUpdate, "outbox_email", emailID, email, requeued); err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Email queued to be re-sent"})
+}
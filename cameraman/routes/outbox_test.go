@@ -0,0 +1,96 @@
+package routes
+
+import (
+	"context"
+	"golden-arm/mailer"
+	"testing"
+	"time"
+)
+
+func TestEmailRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 0, want: time.Minute},
+		{attempts: 1, want: time.Minute},
+		{attempts: 2, want: 2 * time.Minute},
+		{attempts: 3, want: 4 * time.Minute},
+		{attempts: 7, want: 64 * time.Minute},
+		{attempts: 9, want: 256 * time.Minute},
+		{attempts: 10, want: 6 * time.Hour}, // 512 minutes, capped
+		{attempts: 100, want: 6 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := emailRetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("emailRetryDelay(%d) = %v; want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestEmailRetryDelayNeverDecreases(t *testing.T) {
+	previous := time.Duration(0)
+	for attempts := 1; attempts <= 64; attempts++ {
+		delay := emailRetryDelay(attempts)
+		if delay < previous || delay > emailRetryMax {
+			t.Fatalf("emailRetryDelay(%d) = %v after %v", attempts, delay, previous)
+		}
+		previous = delay
+	}
+}
+
+func TestEmailMaxAttempts(t *testing.T) {
+	tests := []struct {
+		env  string
+		want int
+	}{
+		{env: "", want: defaultEmailMaxAttempts},
+		{env: "5", want: 5},
+		{env: "0", want: defaultEmailMaxAttempts},
+		{env: "-3", want: defaultEmailMaxAttempts},
+		{env: "lots", want: defaultEmailMaxAttempts},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("EMAIL_MAX_ATTEMPTS", tt.env)
+		if got := emailMaxAttempts(); got != tt.want {
+			t.Errorf("EMAIL_MAX_ATTEMPTS=%q: emailMaxAttempts() = %d; want %d", tt.env, got, tt.want)
+		}
+	}
+}
+
+// The outbox worker hands each email to the configured mailer through sendEmail
+func TestSendEmail(t *testing.T) {
+	t.Setenv("MAIL_BACKEND", "memory")
+	t.Setenv("REPLYTO", "team@example.com")
+	memory, ok := mailer.GetMailer().(*mailer.MemoryMailer)
+	if !ok {
+		t.Fatalf("GetMailer() = %T; want *mailer.MemoryMailer", mailer.GetMailer())
+	}
+	memory.Reset()
+
+	calendar := mailer.Attachment{Filename: "screening.ics", ContentType: "text/calendar", Data: []byte("BEGIN:VCALENDAR")}
+	messageID, err := sendEmail(context.Background(), "reservations@example.com", "jb@example.com", "Reminder", "<p>Hi</p>", []mailer.Attachment{calendar})
+	if err != nil || messageID == "" {
+		t.Fatalf("sendEmail() = %q, %v", messageID, err)
+	}
+
+	messages := memory.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("sent %d messages; want 1", len(messages))
+	}
+	msg := messages[0]
+	if msg.From != "reservations@example.com" || len(msg.To) != 1 || msg.To[0] != "jb@example.com" {
+		t.Errorf("message from %q to %v", msg.From, msg.To)
+	}
+	if len(msg.ReplyTo) != 1 || msg.ReplyTo[0] != "team@example.com" || len(msg.Cc) != 1 || msg.Cc[0] != "team@example.com" {
+		t.Errorf("REPLYTO should be the reply-to address and copied: Reply-To %v, Cc %v", msg.ReplyTo, msg.Cc)
+	}
+	if msg.Subject != "Reminder" || msg.HTML != "<p>Hi</p>" {
+		t.Errorf("message subject %q, body %q", msg.Subject, msg.HTML)
+	}
+	if len(msg.Attachments) != 1 || msg.Attachments[0].Filename != "screening.ics" {
+		t.Errorf("attachments = %+v; want the calendar", msg.Attachments)
+	}
+}
@@ -0,0 +1,345 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"golden-arm/internal"
+	"golden-arm/money"
+	"golden-arm/payments"
+	"golden-arm/schema"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+// Largest webhook body accepted from the payment provider
+const maxWebhookSize = 1 << 20
+
+// Page where a customer pays for their order; it asks the API for a fresh checkout session
+func OrderCheckoutURL(orderID uuid.UUID) string {
+	return "https://goldenarmtheater.com/shop/checkout/" + orderID.String()
+}
+
+// Names an order item for customers, e.g. "Movie T-Shirt (Black / M)"; load its Merchandise and Movie first
+func orderItemName(item schema.OrderItem) string {
+	switch {
+	case item.Merchandise != nil && item.Size != "":
+		return fmt.Sprintf("%s (%s)", item.Merchandise.Name, item.Size)
+	case item.Merchandise != nil:
+		return item.Merchandise.Name
+	case item.Movie != nil && item.Size != "":
+		return fmt.Sprintf("\"%s\" Poster (%s)", item.Movie.Title, item.Size)
+	case item.Movie != nil:
+		return fmt.Sprintf("\"%s\" Poster", item.Movie.Title)
+	default:
+		return "Golden Arm merch"
+	}
+}
+
+// Starts a hosted checkout for a pending order; this calls out to the payment provider,
+// so never do it while holding a transaction open
+func createOrderCheckout(ctx context.Context, db bun.IDB, order schema.Order) (*payments.CheckoutSession, error) {
+	var items []schema.OrderItem
+	err := db.NewSelect().
+		Model(&items).
+		Relation("Merchandise").
+		Relation("Movie").
+		Where("order_item.order_id = ?", order.ID).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req := payments.CheckoutRequest{
+		OrderID:    order.ID,
+		Email:      order.Email,
+		Currency:   order.Currency,
+		SuccessURL: OrderCheckoutURL(order.ID) + "?status=success",
+		CancelURL:  OrderCheckoutURL(order.ID) + "?status=cancelled",
+	}
+	// Checkout pages can't show negative lines, so a discounted order is charged as one line
+	if order.Discount > 0 {
+		req.Items = []payments.LineItem{{
+			Name:       fmt.Sprintf("Golden Arm order (%s applied)", order.PromoCode),
+			Quantity:   1,
+			UnitAmount: order.Total.Cents(),
+		}}
+		return payments.GetProvider().CreateCheckout(ctx, req)
+	}
+
+	for _, item := range items {
+		req.Items = append(req.Items, payments.LineItem{
+			Name:       orderItemName(item),
+			Quantity:   item.Quantity,
+			UnitAmount: item.Price.Cents(),
+		})
+	}
+
+	// The provider charges the sum of the items, so make sure it's what the customer was quoted
+	if req.Total() != order.Total.Cents() {
+		return nil, fmt.Errorf("order items add up to %d cents but the order total is %d", req.Total(), order.Total.Cents())
+	}
+
+	return payments.GetProvider().CreateCheckout(ctx, req)
+}
+
+/*
+Starts an online checkout for an unpaid order and returns the payment page to send the customer to
+
+	curl -X POST http://localhost:8080/api/order/00000000-0000-0000-0000-000000000000/checkout
+*/
+func CreateCheckout(c *gin.Context) {
+	// Ensure order_id is provided and is a valid UUID
+	param := c.Param("order_id")
+	if param == "" {
+		fmt.Println("order_id path parameter is required")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	orderID, err := uuid.Parse(param)
+	if err != nil {
+		fmt.Println("order_id must be a valid UUID")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	var order schema.Order
+	err = db.NewSelect().
+		Model(&order).
+		Where("id = ?", orderID).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Println("Order not found")
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Error fetching order: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	if order.Status != schema.OrderPending {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"success": false, "error": "Order is not awaiting payment"})
+		return
+	}
+
+	session, err := createOrderCheckout(ctx, db, order)
+	if err != nil {
+		fmt.Printf("Error creating checkout: %v", err)
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"success": false,
+			"error":   "Online payment is unavailable right now, please try again later",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"checkout_url": session.URL}})
+}
+
+/*
+Receives signed payment events from the payment provider; each event is only acted on once
+
+	Configure the provider to send webhooks to https://YOUR DOMAIN/api/payments/webhook
+*/
+func PaymentWebhook(c *gin.Context) {
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookSize))
+	if err != nil {
+		fmt.Printf("Error reading webhook: %v", err)
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	event, err := payments.GetProvider().ParseWebhook(payload, c.Request.Header)
+	if err != nil {
+		fmt.Printf("Rejected payment webhook: %v", err)
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	err = schema.GetDBConn().RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// Claim the event; a redelivery finds it already recorded and does nothing
+		record := schema.PaymentEvent{
+			ID:        event.ID,
+			Type:      event.Type,
+			Date:      time.Now(),
+			PaymentID: event.PaymentID,
+			Amount:    money.Money(event.Amount),
+		}
+		result, err := tx.NewInsert().
+			Model(&record).
+			On("CONFLICT (id) DO NOTHING").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return nil
+		}
+
+		order, attention, err := handlePaymentEvent(ctx, tx, event)
+		if err != nil {
+			return err
+		}
+		if order != nil {
+			record.OrderID = order.ID
+		}
+		record.Attention = attention
+		if order == nil && attention == "" {
+			return nil
+		}
+
+		_, err = tx.NewUpdate().
+			Model(&record).
+			Column("order_id", "attention").
+			WherePK().
+			Exec(ctx)
+		if err != nil || attention == "" {
+			return err
+		}
+
+		// Money was taken that the shop hasn't accounted for, so someone has to refund it or fix the order
+		fmt.Printf("Payment event %s needs attention: %s", event.ID, attention)
+		return queuePaymentAttentionEmail(ctx, tx, record, order)
+	})
+	if err != nil {
+		// The provider retries failed deliveries
+		fmt.Printf("Error handling payment event %s: %v", event.ID, err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// Applies a payment event to its order and returns the order, or nil if the event doesn't concern one
+// Also returns why an operator needs to sort out a payment that couldn't be applied, or "" if nothing needs doing
+func handlePaymentEvent(ctx context.Context, tx bun.Tx, event *payments.Event) (*schema.Order, string, error) {
+	if event.Type == payments.EventIgnored {
+		return nil, "", nil
+	}
+
+	// Refunds may only identify the payment
+	var order schema.Order
+	query := tx.NewSelect().
+		Model(&order).
+		For("UPDATE")
+	if event.OrderID != uuid.Nil {
+		query = query.Where("id = ?", event.OrderID)
+	} else if event.PaymentID != "" {
+		query = query.Where("payment_id = ?", event.PaymentID)
+	} else if event.Type == payments.EventPaid {
+		return nil, "the payment doesn't say which order it's for", nil
+	} else {
+		fmt.Printf("Payment event %s doesn't identify an order", event.ID)
+		return nil, "", nil
+	}
+	err := query.Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		if event.Type == payments.EventPaid {
+			return nil, "the payment is for an order that doesn't exist", nil
+		}
+		fmt.Printf("Payment event %s is for an unknown order", event.ID)
+		return nil, "", nil
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	switch event.Type {
+	case payments.EventPaid:
+		if order.Status != schema.OrderPending {
+			// e.g. the order was cancelled while the customer was paying; an operator has to refund it
+			return &order, fmt.Sprintf("the order was paid for while it was %s", order.Status), nil
+		}
+		if event.Amount != order.Total.Cents() {
+			paid := money.Money(event.Amount).Format(order.Currency)
+			return &order, fmt.Sprintf("%s was paid for an order that costs %s", paid, order.Total.Format(order.Currency)), nil
+		}
+
+		if err := transitionOrder(ctx, tx, &order, schema.OrderPaid, uuid.Nil); err != nil {
+			return nil, "", err
+		}
+		order.PaymentID = event.PaymentID
+		_, err := tx.NewUpdate().
+			Model(&order).
+			Column("payment_id").
+			WherePK().
+			Exec(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+
+	case payments.EventRefunded:
+		if !slices.Contains(orderTransitions[order.Status], schema.OrderRefunded) {
+			return &order, "", nil
+		}
+		if err := transitionOrder(ctx, tx, &order, schema.OrderRefunded, uuid.Nil); err != nil {
+			return nil, "", err
+		}
+	}
+
+	return &order, "", queueOrderStatusEmail(ctx, tx, order)
+}
+
+// Payment needs attention email, sent to REPLYTO
+type PaymentAttentionEmailData struct {
+	Event schema.PaymentEvent
+	Order *schema.Order // nil if the order isn't known
+}
+
+// Queues an email to REPLYTO about a payment that couldn't be applied to its order
+func queuePaymentAttentionEmail(ctx context.Context, tx bun.Tx, event schema.PaymentEvent, order *schema.Order) error {
+	data := PaymentAttentionEmailData{
+		Event: event,
+		Order: order,
+	}
+
+	body, err := renderEmailTemplate("payment_attention_email.html", nil, data)
+	if err != nil {
+		return err
+	}
+
+	from := os.Getenv("ORDERS_SENDER")
+	subject := "Payment needs attention @ The Golden Arm"
+
+	return queueEmail(ctx, tx, from, os.Getenv("REPLYTO"), subject, body)
+}
+
+/*
+Gets payment events that couldn't be applied to their orders, e.g. an order paid after it was cancelled, most recent first
+Each has to be refunded, or its order fixed, through the payment provider and the admin site
+
+	curl -X GET http://localhost:8080/api/payments/attention \
+	-H "Authorization: Bearer YOUR API KEY"
+*/
+func GetPaymentsNeedingAttention(c *gin.Context) {
+	var events []schema.PaymentEvent
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	err := db.NewSelect().
+		Model(&events).
+		Where("attention IS NOT NULL").
+		Order("date DESC").
+		Scan(ctx)
+	if err != nil {
+		fmt.Printf("Error fetching payment events: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	if events == nil {
+		events = []schema.PaymentEvent{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": events})
+}
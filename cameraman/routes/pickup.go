@@ -0,0 +1,434 @@
+package routes
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"golden-arm/internal"
+	"golden-arm/schema"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+var ErrInvalidFulfilment = errors.New("invalid fulfilment")
+
+const (
+	// Pickup codes leave out letters and digits that are easy to mix up, like O and 0
+	pickupCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	pickupCodeLength   = 6
+	// Prefix of the text in a pickup QR code, so the door scanner can tell it from other codes
+	pickupQRPrefix = "goldenarm:pickup:"
+	// Orders need a week's notice, so they're ready from the first screening a week after they're placed
+	pickupNotice = 7 * 24 * time.Hour
+	// How far ahead the unfulfilled orders report looks by default
+	defaultPickupReportDays = 30
+)
+
+type FulfilRequest struct {
+	Items []FulfilItemInfo `json:"items"` // Leave out to hand over everything that's left
+}
+
+type FulfilItemInfo struct {
+	OrderItemID uuid.UUID `json:"order_item_id"`
+	Quantity    int       `json:"quantity"`
+}
+
+// An order item and how much of it is still to be handed over
+type PickupItem struct {
+	OrderItemID uuid.UUID `json:"order_item_id"`
+	Name        string    `json:"name"`
+	Quantity    int       `json:"quantity"` // As ordered
+	Refunded    int       `json:"refunded"`
+	Fulfilled   int       `json:"fulfilled"`
+	Remaining   int       `json:"remaining"`
+}
+
+// An order as seen at the merch table
+type PickupOrder struct {
+	OrderID    uuid.UUID    `json:"order_id"`
+	Name       string       `json:"name"`
+	Email      string       `json:"email"`
+	Date       time.Time    `json:"date"`
+	Status     string       `json:"status"`
+	PickupCode string       `json:"pickup_code"`
+	Items      []PickupItem `json:"items"`
+}
+
+// Text for an order's pickup QR code; the door scanner sends it, or just the code, to GetPickupOrder
+func PickupQRPayload(code string) string {
+	return pickupQRPrefix + code
+}
+
+// Page where a customer shows their pickup code at the merch table
+func PickupPassURL(code string) string {
+	return "https://goldenarmtheater.com/shop/pickup/" + code
+}
+
+// Makes a pickup code no other order has
+func generatePickupCode(ctx context.Context, db bun.IDB) (string, error) {
+	max := big.NewInt(int64(len(pickupCodeAlphabet)))
+	for attempt := 0; attempt < 5; attempt++ {
+		var code strings.Builder
+		for i := 0; i < pickupCodeLength; i++ {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return "", err
+			}
+			code.WriteByte(pickupCodeAlphabet[n.Int64()])
+		}
+
+		taken, err := db.NewSelect().
+			Model((*schema.Order)(nil)).
+			Where("pickup_code = ?", code.String()).
+			Exists(ctx)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return code.String(), nil
+		}
+	}
+	return "", errors.New("could not find an unused pickup code")
+}
+
+// Reads a pickup code from a path parameter, which may be the whole QR payload
+func parsePickupCode(param string) string {
+	return strings.ToUpper(strings.TrimPrefix(strings.TrimSpace(param), pickupQRPrefix))
+}
+
+// Sums how much of each of an order's items has been handed over, by order item ID
+func getFulfilledQuantities(ctx context.Context, db bun.IDB, orderID uuid.UUID) (map[uuid.UUID]int, error) {
+	var rows []struct {
+		OrderItemID uuid.UUID `bun:"order_item_id"`
+		Quantity    int       `bun:"quantity"`
+	}
+	err := db.NewSelect().
+		Model((*schema.OrderFulfilment)(nil)).
+		ColumnExpr("order_item_id, sum(quantity) AS quantity").
+		Where("order_id = ?", orderID).
+		GroupExpr("order_item_id").
+		Scan(ctx, &rows)
+	if err != nil {
+		return nil, err
+	}
+
+	fulfilled := make(map[uuid.UUID]int, len(rows))
+	for _, row := range rows {
+		fulfilled[row.OrderItemID] = row.Quantity
+	}
+	return fulfilled, nil
+}
+
+// Gets an order's items with how much of each is refunded, handed over, and left to hand over
+func getPickupOrder(ctx context.Context, db bun.IDB, order schema.Order) (*PickupOrder, error) {
+	var items []schema.OrderItem
+	err := db.NewSelect().
+		Model(&items).
+		Relation("Merchandise").
+		Relation("Movie").
+		Where("order_id = ?", order.ID).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	refunded, err := getRefundedQuantities(ctx, db, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	fulfilled, err := getFulfilledQuantities(ctx, db, order.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	pickup := PickupOrder{
+		OrderID:    order.ID,
+		Name:       order.Name,
+		Email:      order.Email,
+		Date:       order.Date,
+		Status:     order.Status,
+		PickupCode: order.PickupCode,
+		Items:      make([]PickupItem, 0, len(items)),
+	}
+	for _, item := range items {
+		pickup.Items = append(pickup.Items, PickupItem{
+			OrderItemID: item.ID,
+			Name:        orderItemName(item),
+			Quantity:    item.Quantity,
+			Refunded:    refunded[item.ID],
+			Fulfilled:   fulfilled[item.ID],
+			Remaining:   max(item.Quantity-refunded[item.ID]-fulfilled[item.ID], 0),
+		})
+	}
+	return &pickup, nil
+}
+
+/*
+Looks up an order by the pickup code the customer shows at the merch table, or the text of its QR code
+
+	curl -X GET http://localhost:8080/api/order/pickup/K7PX3M -H "Authorization: Bearer YOUR API KEY"
+*/
+func GetPickupOrder(c *gin.Context) {
+	code := parsePickupCode(c.Param("code"))
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	var order schema.Order
+	err := db.NewSelect().
+		Model(&order).
+		Where("pickup_code = ?", code).
+		Scan(ctx)
+	if err != nil {
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	}
+
+	pickup, err := getPickupOrder(ctx, db, order)
+	if err != nil {
+		fmt.Printf("Error fetching order items: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": pickup})
+}
+
+/*
+Hands over some or all of a paid order's items at the merch table, found by pickup code
+Leave out items to hand over everything that's left; once nothing is left, the order is marked picked up
+
+	curl -X POST http://localhost:8080/api/order/pickup/K7PX3M -H "Authorization: Bearer YOUR API KEY" \
+		-H "Content-Type: application/json" \
+		-d '{
+			"items": [
+				{
+					"order_item_id": "00000000-0000-0000-0000-000000000000",
+					"quantity": 1
+				}
+			]
+		}'
+*/
+func FulfilOrder(c *gin.Context) {
+	code := parsePickupCode(c.Param("code"))
+
+	// The body is optional
+	var request FulfilRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			fmt.Printf("Error binding JSON: %v", err)
+			c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+			return
+		}
+	}
+
+	// Begin transaction
+	ctx := context.Background()
+	tx, err := schema.GetDBConn().BeginTx(ctx, nil)
+	if err != nil {
+		fmt.Printf("Error starting transaction: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	// Ensure rollback if error occurs
+	defer tx.Rollback()
+
+	// Lock the order so it can't be handed over twice
+	var order schema.Order
+	err = tx.NewSelect().
+		Model(&order).
+		Where("pickup_code = ?", code).
+		For("UPDATE").
+		Scan(ctx)
+	if err != nil {
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	}
+	before := order
+
+	if order.Status != schema.OrderPaid && order.Status != schema.OrderReady {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   fmt.Sprintf("Can't hand over a %s order", order.Status),
+		})
+		return
+	}
+
+	pickup, err := getPickupOrder(ctx, tx, order)
+	if err != nil {
+		fmt.Printf("Error fetching order items: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	// Hand over everything that's left unless told otherwise
+	if len(request.Items) == 0 {
+		for _, item := range pickup.Items {
+			if item.Remaining > 0 {
+				request.Items = append(request.Items, FulfilItemInfo{OrderItemID: item.OrderItemID, Quantity: item.Remaining})
+			}
+		}
+	}
+
+	actorID, actorName := uuid.Nil, ""
+	if operator := internal.GetOperator(c); operator != nil {
+		actorID, actorName = operator.ID, operator.Name
+	}
+
+	now := time.Now()
+	for _, info := range request.Items {
+		index := slices.IndexFunc(pickup.Items, func(item PickupItem) bool { return item.OrderItemID == info.OrderItemID })
+		if index < 0 || info.Quantity <= 0 || info.Quantity > pickup.Items[index].Remaining {
+			err = fmt.Errorf("%w: can't hand over %d of item %s", ErrInvalidFulfilment, info.Quantity, info.OrderItemID)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		pickup.Items[index].Fulfilled += info.Quantity
+		pickup.Items[index].Remaining -= info.Quantity
+
+		fulfilment := schema.OrderFulfilment{
+			ID:          uuid.New(),
+			OrderID:     order.ID,
+			OrderItemID: info.OrderItemID,
+			Quantity:    info.Quantity,
+			ActorID:     actorID,
+			ActorName:   actorName,
+			Date:        now,
+		}
+		if _, err := tx.NewInsert().Model(&fulfilment).Exec(ctx); err != nil {
+			fmt.Printf("Error recording fulfilment: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+	}
+
+	// Everything's been handed over, so the order's picked up; paid orders skip straight past ready
+	if !slices.ContainsFunc(pickup.Items, func(item PickupItem) bool { return item.Remaining > 0 }) {
+		for _, status := range []string{schema.OrderReady, schema.OrderPickedUp} {
+			if order.Status == status || !slices.Contains(orderTransitions[order.Status], status) {
+				continue
+			}
+			if err := transitionOrder(ctx, tx, &order, status, actorID); err != nil {
+				fmt.Printf("Error updating order status: %v", err)
+				c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+				return
+			}
+		}
+		pickup.Status = order.Status
+	}
+
+	if err := recordAudit(ctx, tx, c, "fulfil", "order", order.ID, before, order); err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		fmt.Printf("Error committing transaction: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": pickup})
+}
+
+/*
+Lists the paid orders still waiting to be picked up at each screening night, so they can be packed and brought along
+An order is due from the first screening a week after it was placed, and shows up every night until it's picked up
+Covers the next 30 days unless given a from/to date range (YYYY-MM-DD)
+
+	curl -X GET "http://localhost:8080/api/order/unfulfilled?from=2025-06-01&to=2025-06-30" \
+	-H "Authorization: Bearer YOUR API KEY"
+*/
+func GetUnfulfilledOrders(c *gin.Context) {
+	type ScreeningNight struct {
+		Date   string        `json:"date"`
+		Movies []string      `json:"movies"`
+		Orders []PickupOrder `json:"orders"`
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	from, to := today, today.AddDate(0, 0, defaultPickupReportDays)
+	for param, date := range map[string]*time.Time{"from": &from, "to": &to} {
+		if value := c.Query(param); value != "" {
+			parsed, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+			if err != nil {
+				fmt.Printf("%s must be a date like 2025-06-01", param)
+				c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+				return
+			}
+			*date = parsed
+		}
+	}
+
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	var screenings []schema.Screening
+	err := db.NewSelect().
+		Model(&screenings).
+		Relation("Movie").
+		Where("screening.date >= ? AND screening.date < ?", from, to.AddDate(0, 0, 1)).
+		Order("screening.date ASC").
+		Scan(ctx)
+	if err != nil {
+		fmt.Printf("Error fetching screenings: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	var orders []schema.Order
+	err = db.NewSelect().
+		Model(&orders).
+		Where("status IN (?)", bun.In([]string{schema.OrderPaid, schema.OrderReady})).
+		Order("date ASC").
+		Scan(ctx)
+	if err != nil {
+		fmt.Printf("Error fetching orders: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	// Only orders with something left to hand over
+	var waiting []PickupOrder
+	for _, order := range orders {
+		pickup, err := getPickupOrder(ctx, db, order)
+		if err != nil {
+			fmt.Printf("Error fetching order items: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+		pickup.Items = slices.DeleteFunc(pickup.Items, func(item PickupItem) bool { return item.Remaining == 0 })
+		if len(pickup.Items) > 0 {
+			waiting = append(waiting, *pickup)
+		}
+	}
+
+	nights := []ScreeningNight{}
+	for _, screening := range screenings {
+		date := screening.Date.In(time.Local).Format(time.DateOnly)
+		if len(nights) == 0 || nights[len(nights)-1].Date != date {
+			night := ScreeningNight{Date: date, Movies: []string{}, Orders: []PickupOrder{}}
+			for _, order := range waiting {
+				if !order.Date.Add(pickupNotice).After(screening.Date) {
+					night.Orders = append(night.Orders, order)
+				}
+			}
+			nights = append(nights, night)
+		}
+		if screening.Movie != nil {
+			nights[len(nights)-1].Movies = append(nights[len(nights)-1].Movies, screening.Movie.Title)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": nights})
+}
@@ -0,0 +1,465 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"golden-arm/internal"
+	"golden-arm/money"
+	"golden-arm/schema"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+var ErrInvalidPosterSize = errors.New("invalid poster size")
+
+type PosterRequest struct {
+	MovieID   uuid.UUID        `json:"movie_id"`
+	Available *bool            `json:"available"` // Defaults to true
+	Sizes     []PosterSizeInfo `json:"sizes"`
+}
+
+// Fields left out are unchanged on update; price is required for new sizes
+type PosterSizeInfo struct {
+	Size      string       `json:"size"`
+	Price     *money.Money `json:"price"`
+	Quantity  *int         `json:"quantity"`
+	Available *bool        `json:"available"`
+}
+
+// Gets a poster with its sizes, e.g. for the audit log
+func getPoster(ctx context.Context, db bun.IDB, posterID uuid.UUID) (*schema.Poster, error) {
+	var poster schema.Poster
+	err := db.NewSelect().
+		Model(&poster).
+		Relation("Sizes", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Order("size ASC")
+		}).
+		Where("poster.id = ?", posterID).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &poster, nil
+}
+
+// Adds or updates a poster's sizes by name
+// Quantity changes are recorded in the inventory ledger as made by the operator behind the request
+// Returns ErrInvalidPosterSize if a size is missing its name, or its price or quantity is invalid
+func upsertPosterSizes(ctx context.Context, tx bun.Tx, c *gin.Context, posterID uuid.UUID, sizes []PosterSizeInfo) error {
+	for _, info := range sizes {
+		if info.Size == "" {
+			return fmt.Errorf("%w: size is required", ErrInvalidPosterSize)
+		}
+		if (info.Price != nil && *info.Price <= 0) || (info.Quantity != nil && *info.Quantity < 0) {
+			return fmt.Errorf("%w: invalid price or quantity for %s", ErrInvalidPosterSize, info.Size)
+		}
+
+		var size schema.PosterSize
+		err := tx.NewSelect().
+			Model(&size).
+			Where("poster_id = ? AND size = ?", posterID, info.Size).
+			For("UPDATE").
+			Scan(ctx)
+		isNew := errors.Is(err, sql.ErrNoRows)
+		if isNew {
+			if info.Price == nil {
+				return fmt.Errorf("%w: price is required for new size %s", ErrInvalidPosterSize, info.Size)
+			}
+			size = schema.PosterSize{
+				ID:        uuid.New(),
+				PosterID:  posterID,
+				Size:      info.Size,
+				Available: true,
+			}
+		} else if err != nil {
+			return err
+		}
+
+		if info.Price != nil {
+			size.Price = *info.Price
+		}
+		if info.Available != nil {
+			size.Available = *info.Available
+		}
+
+		// The quantity only changes through the inventory ledger
+		if isNew {
+			_, err = tx.NewInsert().Model(&size).Exec(ctx)
+		} else {
+			_, err = tx.NewUpdate().Model(&size).ExcludeColumn("quantity").WherePK().Exec(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		if info.Quantity != nil {
+			kind, reason := schema.MovementAdjustment, "Quantity set on poster update"
+			if isNew {
+				kind, reason = schema.MovementRestock, "Initial stock"
+			}
+			movement := stockMovement(c, kind, reason)
+			movement.PosterSizeID = &size.ID
+			movement.Change = *info.Quantity - size.Quantity
+			if err := moveStock(ctx, tx, movement); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+Puts a movie's poster up for sale in the given sizes, each with its own price and inventory
+
+	curl -X POST http://localhost:8080/api/poster -H "Authorization: Bearer YOUR API KEY" \
+		-H "Content-Type: application/json" -d
+		'{
+			"movie_id": "00000000-0000-0000-0000-000000000000",
+			"sizes": [
+				{
+				"size": "11x17",
+				"price": 10.00,
+				"quantity": 30
+				},
+				{
+				"size": "24x36",
+				"price": 25.00,
+				"quantity": 10
+				}
+			]
+		}'
+*/
+func AddPoster(c *gin.Context) {
+	var request PosterRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		fmt.Println(err)
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	if request.MovieID == uuid.Nil || len(request.Sizes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required fields"})
+		return
+	}
+
+	poster := schema.Poster{
+		ID:        uuid.New(),
+		MovieID:   request.MovieID,
+		Available: request.Available == nil || *request.Available,
+	}
+
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	// Begin transaction
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	// Ensure rollback if error occurs
+	defer tx.Rollback()
+
+	exists, err := tx.NewSelect().
+		Model((*schema.Movie)(nil)).
+		Where("id = ?", request.MovieID).
+		Exists(ctx)
+	if err != nil {
+		fmt.Printf("Error checking if movie exists: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	if !exists {
+		fmt.Println("Movie not found")
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	}
+
+	result, err := tx.NewInsert().
+		Model(&poster).
+		On("CONFLICT (movie_id) DO NOTHING").
+		Exec(ctx)
+	if err != nil {
+		fmt.Printf("Error inserting poster: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"success": false, "error": "This movie already has a poster"})
+		return
+	}
+
+	err = upsertPosterSizes(ctx, tx, c, poster.ID, request.Sizes)
+	if errors.Is(err, ErrInvalidPosterSize) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		fmt.Printf("Error saving poster sizes: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	after, err := getPoster(ctx, tx, poster.ID)
+	if err == nil {
+		err = recordAudit(ctx, tx, c, schema.AuditCreate, "poster", poster.ID, nil, after)
+	}
+	if err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": gin.H{"id": poster.ID}})
+}
+
+/*
+Gets all posters with their movies and sizes, newest movies first; check available on the poster and each size before offering it
+Each size's quantity is what's left to buy, so stock held in shoppers' carts isn't included
+
+	curl -X GET http://localhost:8080/api/poster/all
+*/
+func GetAllPosters(c *gin.Context) {
+	var posters []schema.Poster
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	err := db.NewSelect().
+		Model(&posters).
+		Relation("Movie").
+		Relation("Sizes", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Order("size ASC")
+		}).
+		OrderExpr("(SELECT MAX(s.date) FROM screenings AS s WHERE s.movie_id = poster.movie_id) DESC NULLS LAST").
+		Scan(ctx)
+	if err != nil {
+		fmt.Printf("Error fetching posters: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	if posters == nil {
+		posters = []schema.Poster{}
+	}
+
+	held, err := getHeldStock(ctx, db)
+	if err != nil {
+		fmt.Printf("Error fetching held stock: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	for _, poster := range posters {
+		for i := range poster.Sizes {
+			size := &poster.Sizes[i]
+			size.Quantity = max(size.Quantity-held[stockKey{MovieID: poster.MovieID, Size: size.Size}], 0)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": posters})
+}
+
+/*
+Updates a poster's availability and its sizes; sizes are matched by name, and new ones are added
+
+	curl -X PUT http://localhost:8080/api/poster/00000000-0000-0000-0000-000000000000 \
+		-H "Authorization: Bearer YOUR API KEY" \
+		-H "Content-Type: application/json" \
+		-d '{
+			"available": true,
+			"sizes": [
+				{
+					"size": "11x17",
+					"quantity": 50
+				},
+				{
+					"size": "24x36",
+					"available": false
+				}
+			]
+		}'
+*/
+func UpdatePoster(c *gin.Context) {
+	// Ensure poster_id is provided and is a valid UUID
+	param := c.Param("poster_id")
+	if param == "" {
+		fmt.Println("poster_id path parameter is required")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	posterID, err := uuid.Parse(param)
+	if err != nil {
+		fmt.Println("poster_id must be a valid UUID")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	var request PosterRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		fmt.Println(err)
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	if request.Available == nil && len(request.Sizes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+		return
+	}
+
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	// Begin transaction
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	// Ensure rollback if error occurs
+	defer tx.Rollback()
+
+	before, err := getPoster(ctx, tx, posterID)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Println("Poster not found")
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Error fetching poster: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if request.Available != nil {
+		_, err := tx.NewUpdate().
+			Model((*schema.Poster)(nil)).
+			Set("available = ?", *request.Available).
+			Where("id = ?", posterID).
+			Exec(ctx)
+		if err != nil {
+			fmt.Printf("Error updating poster: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+	}
+
+	err = upsertPosterSizes(ctx, tx, c, posterID, request.Sizes)
+	if errors.Is(err, ErrInvalidPosterSize) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		fmt.Printf("Error saving poster sizes: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	after, err := getPoster(ctx, tx, posterID)
+	if err == nil {
+		err = recordAudit(ctx, tx, c, schema.AuditUpdate, "poster", posterID, before, after)
+	}
+	if err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": after})
+}
+
+/*
+Deletes a poster along with its sizes; to stop selling it for a while, mark it unavailable instead
+Posters on orders that are still open can't be deleted, since cancelling or refunding them puts the posters back into stock
+
+	curl -X DELETE http://localhost:8080/api/poster/00000000-0000-0000-0000-000000000000 \
+	-H "Authorization: Bearer YOUR API KEY"
+*/
+func DeletePoster(c *gin.Context) {
+	// Ensure poster_id is provided and is a valid UUID
+	param := c.Param("poster_id")
+	if param == "" {
+		fmt.Println("poster_id path parameter is required")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	posterID, err := uuid.Parse(param)
+	if err != nil {
+		fmt.Println("poster_id must be a valid UUID")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	// Begin transaction
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	// Ensure rollback if error occurs
+	defer tx.Rollback()
+
+	before, err := getPoster(ctx, tx, posterID)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Println("Poster not found")
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Error fetching poster: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	openOrders, err := tx.NewSelect().
+		Model((*schema.OrderItem)(nil)).
+		Join(`JOIN orders AS o ON o.id = order_item.order_id`).
+		Where("order_item.movie_id = ? AND o.status IN (?)", before.MovieID, bun.In(openOrderStatuses)).
+		Count(ctx)
+	if err != nil {
+		fmt.Printf("Error checking poster orders: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	if openOrders > 0 {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"success": false, "error": "Poster is on open orders; mark it unavailable instead"})
+		return
+	}
+
+	// Sizes go with it
+	_, err = tx.NewDelete().
+		Model((*schema.Poster)(nil)).
+		Where("id = ?", posterID).
+		Exec(ctx)
+	if err != nil {
+		fmt.Printf("Error deleting poster: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := recordAudit(ctx, tx, c, schema.AuditDelete, "poster", posterID, before, nil); err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Poster and its sizes deleted successfully",
+	})
+}
@@ -0,0 +1,415 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golden-arm/money"
+	"golden-arm/schema"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+// How often closed pre-order windows are checked for
+const preorderSweepInterval = 5 * time.Minute
+
+var ErrInvalidPreorder = errors.New("invalid pre-order")
+
+// A merchandise item's pre-order window; orders within it are taken beyond stock and printed once it closes
+type PreorderInfo struct {
+	OpensAt  *time.Time `json:"opens_at"`  // Open straight away if not set
+	ClosesAt *time.Time `json:"closes_at"` // Leave out to take the item off pre-order
+	Minimum  int        `json:"minimum"`   // Units needed to go ahead with printing; 0 for no minimum
+	ShipDate *time.Time `json:"ship_date"` // Estimated date pre-orders are ready
+}
+
+// An item on a pre-order status email
+type PreorderEmailItem struct {
+	Options  string
+	Quantity int
+}
+
+// Pre-order status email, sent to each customer when a pre-order window closes
+type PreorderEmailData struct {
+	Name       string
+	OrderID    uuid.UUID
+	PickupCode string
+	MerchName  string
+	Items      []PreorderEmailItem
+	Printing   bool   // Whether the minimum was met; the pre-orders are refunded if not
+	Cancelled  bool   // Whether the order was unpaid, so was cancelled instead of refunded
+	ShipDate   string // Empty if there's no estimate
+}
+
+// A refund recorded for a pre-order that didn't go ahead, still to be issued through the payment provider
+type PreorderRefund struct {
+	OrderID   uuid.UUID
+	Name      string
+	Email     string
+	PaymentID string // Empty if the order wasn't paid online
+	Amount    money.Money
+	Currency  string
+}
+
+// Email to REPLYTO listing the refunds to issue once a pre-order is called off
+type PreorderRefundsEmailData struct {
+	MerchName string
+	Refunds   []PreorderRefund
+}
+
+// Whether a merchandise item is taking pre-orders at the given time
+func preorderOpen(merch schema.Merchandise, now time.Time) bool {
+	if merch.PreorderClosesAt == nil || merch.PreorderStatus != "" {
+		return false
+	}
+	if merch.PreorderOpensAt != nil && now.Before(*merch.PreorderOpensAt) {
+		return false
+	}
+	return now.Before(*merch.PreorderClosesAt)
+}
+
+// Reads the pre-order window from a multipart form, where it's a JSON object like the JSON request's
+func bindPreorderForm(c *gin.Context, preorder **PreorderInfo) error {
+	value := c.PostForm("preorder")
+	if value == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(value), preorder); err != nil {
+		return fmt.Errorf("%w: preorder must be a JSON object", ErrInvalidPreorder)
+	}
+	return nil
+}
+
+// Sets a merchandise item's pre-order window; a window closing in the future is reopened if it had already closed
+func applyPreorder(merch *schema.Merchandise, preorder PreorderInfo) error {
+	if preorder.ClosesAt == nil {
+		merch.PreorderOpensAt = nil
+		merch.PreorderClosesAt = nil
+		merch.PreorderMinimum = 0
+		merch.ShipDate = nil
+		merch.PreorderStatus = ""
+		return nil
+	}
+
+	if preorder.OpensAt != nil && !preorder.OpensAt.Before(*preorder.ClosesAt) {
+		return fmt.Errorf("%w: opens_at must be before closes_at", ErrInvalidPreorder)
+	}
+	if preorder.Minimum < 0 {
+		return fmt.Errorf("%w: minimum can't be negative", ErrInvalidPreorder)
+	}
+	if preorder.ShipDate != nil && preorder.ShipDate.Before(*preorder.ClosesAt) {
+		return fmt.Errorf("%w: ship_date can't be before closes_at", ErrInvalidPreorder)
+	}
+
+	merch.PreorderOpensAt = preorder.OpensAt
+	merch.PreorderClosesAt = preorder.ClosesAt
+	merch.PreorderMinimum = preorder.Minimum
+	merch.ShipDate = preorder.ShipDate
+	if preorder.ClosesAt.After(time.Now()) {
+		merch.PreorderStatus = ""
+	}
+	return nil
+}
+
+// Closes a merchandise item's pre-order window: decides whether it's printed and emails each customer who pre-ordered
+// If the minimum isn't met, each order's pre-orders are called off, and REPLYTO is sent the refunds to issue
+func closePreorder(ctx context.Context, tx bun.Tx, merchID uuid.UUID) error {
+	var merch schema.Merchandise
+	err := tx.NewSelect().
+		Model(&merch).
+		Where("id = ?", merchID).
+		For("UPDATE").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+	// Already closed by another sweep, or reopened since
+	if merch.PreorderStatus != "" || merch.PreorderClosesAt == nil || merch.PreorderClosesAt.After(time.Now()) {
+		return nil
+	}
+
+	// Cancelled and refunded orders don't count towards the minimum
+	var items []schema.OrderItem
+	err = tx.NewSelect().
+		Model(&items).
+		Relation("Order").
+		Where("order_item.merchandise_id = ? AND order_item.preorder", merch.ID).
+		Where(`"order"."status" NOT IN (?)`, bun.In([]string{schema.OrderCancelled, schema.OrderRefunded})).
+		Order("order_item.size").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Items refunded on their own don't count either
+	refundedByOrder := make(map[uuid.UUID]map[uuid.UUID]int)
+	byOrder := make(map[uuid.UUID][]schema.OrderItem)
+	var orders []schema.Order
+	units := 0
+	for _, item := range items {
+		refunded, ok := refundedByOrder[item.OrderID]
+		if !ok {
+			refunded, err = getRefundedQuantities(ctx, tx, item.OrderID)
+			if err != nil {
+				return err
+			}
+			refundedByOrder[item.OrderID] = refunded
+			orders = append(orders, item.Order)
+		}
+		item.Quantity -= refunded[item.ID]
+		if item.Quantity <= 0 {
+			continue
+		}
+		byOrder[item.OrderID] = append(byOrder[item.OrderID], item)
+		units += item.Quantity
+	}
+
+	merch.PreorderStatus = schema.PreorderPrinting
+	if units < merch.PreorderMinimum {
+		merch.PreorderStatus = schema.PreorderMinimumNotMet
+	}
+	_, err = tx.NewUpdate().
+		Model(&merch).
+		Column("preorder_status").
+		WherePK().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	var refunds []PreorderRefund
+	for _, order := range orders {
+		if len(byOrder[order.ID]) == 0 {
+			continue
+		}
+
+		if merch.PreorderStatus == schema.PreorderMinimumNotMet {
+			refund, err := callOffPreorder(ctx, tx, &order, merch.ID)
+			if err != nil {
+				return fmt.Errorf("failed to call off pre-order for order %s: %w", order.ID, err)
+			}
+			if refund != nil {
+				refunds = append(refunds, PreorderRefund{
+					OrderID:   order.ID,
+					Name:      order.Name,
+					Email:     order.Email,
+					PaymentID: order.PaymentID,
+					Amount:    refund.Amount,
+					Currency:  order.Currency,
+				})
+			}
+		}
+
+		if err := queuePreorderEmail(ctx, tx, merch, order, byOrder[order.ID]); err != nil {
+			return err
+		}
+	}
+
+	if len(refunds) > 0 {
+		return queuePreorderRefundsEmail(ctx, tx, merch, refunds)
+	}
+	return nil
+}
+
+// Calls off a merchandise item's pre-orders on an order once the minimum isn't met
+// Unpaid orders are cancelled whole, so they can no longer be paid; paid orders have the pre-ordered items refunded
+// Returns the refund recorded, or nil if the order was cancelled or had nothing left to refund
+func callOffPreorder(ctx context.Context, tx bun.Tx, order *schema.Order, merchID uuid.UUID) (*schema.OrderRefund, error) {
+	// Lock the order so it can't be paid, refunded or handed over meanwhile
+	err := tx.NewSelect().
+		Model(order).
+		WherePK().
+		For("UPDATE").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if order.Status == schema.OrderPending {
+		if err := transitionOrder(ctx, tx, order, schema.OrderCancelled, uuid.Nil); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	if !slices.Contains(orderTransitions[order.Status], schema.OrderRefunded) {
+		return nil, nil
+	}
+
+	var items []schema.OrderItem
+	err = tx.NewSelect().
+		Model(&items).
+		Where("order_id = ?", order.ID).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	refunded, err := getRefundedQuantities(ctx, tx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	// Anything already handed over isn't taken back
+	fulfilled, err := getFulfilledQuantities(ctx, tx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	paid := paidByItem(*order, items)
+
+	refund := schema.OrderRefund{
+		ID:      uuid.New(),
+		OrderID: order.ID,
+		Reason:  "Pre-order minimum not met",
+		Date:    time.Now(),
+	}
+	var amount money.Money
+	for _, item := range items {
+		if !item.Preorder || item.MerchandiseID == nil || *item.MerchandiseID != merchID {
+			continue
+		}
+		quantity := item.Quantity - refunded[item.ID] - fulfilled[item.ID]
+		if quantity <= 0 {
+			continue
+		}
+		refunded[item.ID] += quantity
+
+		amount += money.Money(int64(paid[item.ID]) * int64(quantity) / int64(item.Quantity))
+		refund.Items = append(refund.Items, schema.OrderRefundItem{
+			ID:          uuid.New(),
+			RefundID:    refund.ID,
+			OrderItemID: item.ID,
+			Quantity:    quantity,
+		})
+	}
+	if len(refund.Items) == 0 {
+		return nil, nil
+	}
+	refund.Amount = money.Min(amount, order.Total-order.Refunded)
+
+	if _, err := tx.NewInsert().Model(&refund).Exec(ctx); err != nil {
+		return nil, err
+	}
+	if _, err := tx.NewInsert().Model(&refund.Items).Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	// Nothing left, so the whole order is refunded
+	allRefunded := true
+	for _, item := range items {
+		allRefunded = allRefunded && refunded[item.ID] == item.Quantity
+	}
+	refundedTotal := order.Refunded + refund.Amount
+	if allRefunded {
+		if err := transitionOrder(ctx, tx, order, schema.OrderRefunded, uuid.Nil); err != nil {
+			return nil, err
+		}
+	}
+
+	// Set after the status, since refunding the whole order would otherwise count as refunding all of its total
+	order.Refunded = refundedTotal
+	_, err = tx.NewUpdate().
+		Model(order).
+		Column("refunded_cents").
+		WherePK().
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := queueRefundEmail(ctx, tx, *order, refund); err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+// Queues an email to REPLYTO listing the refunds to issue through the payment provider for a called-off pre-order
+func queuePreorderRefundsEmail(ctx context.Context, tx bun.Tx, merch schema.Merchandise, refunds []PreorderRefund) error {
+	data := PreorderRefundsEmailData{
+		MerchName: merch.Name,
+		Refunds:   refunds,
+	}
+
+	body, err := renderEmailTemplate("preorder_refunds_email.html", nil, data)
+	if err != nil {
+		return err
+	}
+
+	from := os.Getenv("ORDERS_SENDER")
+	subject := fmt.Sprintf("Refunds to issue: %s pre-order called off", merch.Name)
+
+	return queueEmail(ctx, tx, from, os.Getenv("REPLYTO"), subject, body)
+}
+
+// Queues the email telling a customer whether their pre-order is being printed
+func queuePreorderEmail(ctx context.Context, tx bun.Tx, merch schema.Merchandise, order schema.Order, items []schema.OrderItem) error {
+	data := PreorderEmailData{
+		Name:       order.Name,
+		OrderID:    order.ID,
+		PickupCode: order.PickupCode,
+		MerchName:  merch.Name,
+		Printing:   merch.PreorderStatus == schema.PreorderPrinting,
+		Cancelled:  order.Status == schema.OrderCancelled,
+	}
+	if merch.ShipDate != nil {
+		data.ShipDate = merch.ShipDate.Format("Monday, January 2, 2006")
+	}
+	for _, item := range items {
+		data.Items = append(data.Items, PreorderEmailItem{Options: item.Size, Quantity: item.Quantity})
+	}
+
+	body, err := renderEmailTemplate("preorder_email.html", nil, data)
+	if err != nil {
+		return err
+	}
+
+	from := os.Getenv("ORDERS_SENDER")
+	subject := fmt.Sprintf("Your %s pre-order is being printed @ The Golden Arm", merch.Name)
+	if !data.Printing {
+		subject = fmt.Sprintf("Your %s pre-order won't be printed @ The Golden Arm", merch.Name)
+	}
+
+	return queueEmail(ctx, tx, from, order.Email, subject, body)
+}
+
+// Closes every pre-order window that has passed, each in its own transaction
+func closePreorders(ctx context.Context) error {
+	db := schema.GetDBConn()
+
+	var due []uuid.UUID
+	err := db.NewSelect().
+		Model((*schema.Merchandise)(nil)).
+		Column("id").
+		Where("preorder_closes_at <= ? AND preorder_status IS NULL", time.Now()).
+		Scan(ctx, &due)
+	if err != nil {
+		return err
+	}
+
+	for _, merchID := range due {
+		err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			return closePreorder(ctx, tx, merchID)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Periodically closes passed pre-order windows in the background
+func StartPreorderSweeper() {
+	go func() {
+		ticker := time.NewTicker(preorderSweepInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := closePreorders(context.Background()); err != nil {
+				fmt.Printf("Error closing pre-orders: %v\n", err)
+			}
+		}
+	}()
+}
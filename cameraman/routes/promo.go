@@ -0,0 +1,520 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"golden-arm/internal"
+	"golden-arm/money"
+	"golden-arm/schema"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+// Returned for any code a customer can't use; the message says why
+var ErrInvalidPromo = errors.New("invalid promo code")
+
+type PromoCodeRequest struct {
+	Code             string      `json:"code"`
+	Description      string      `json:"description"`
+	PercentOff       int         `json:"percent_off"`
+	AmountOff        money.Money `json:"amount_off"`
+	Scope            string      `json:"scope"`
+	ItemType         string      `json:"item_type"`
+	MerchandiseID    *uuid.UUID  `json:"merchandise_id"`
+	MaxItems         int         `json:"max_items"`
+	RequiresItemType string      `json:"requires_item_type"`
+	MinSubtotal      money.Money `json:"min_subtotal"`
+	ExpiresAt        *time.Time  `json:"expires_at"`
+	MaxUses          int         `json:"max_uses"`
+	MaxUsesPerEmail  int         `json:"max_uses_per_email"`
+}
+
+func isValidItemType(itemType string) bool {
+	return itemType == schema.ItemMerchandise || itemType == schema.ItemPoster
+}
+
+// Kind of thing an order item is
+func orderItemType(item schema.OrderItem) string {
+	if item.MerchandiseID != nil {
+		return schema.ItemMerchandise
+	}
+	return schema.ItemPoster
+}
+
+// Counts a promo code's uses, optionally only by one email address; cancelled orders don't count
+func countPromoUses(ctx context.Context, db bun.IDB, promoID uuid.UUID, email string) (int, error) {
+	query := db.NewSelect().
+		Model((*schema.PromoRedemption)(nil)).
+		Join("JOIN orders AS o ON o.id = promo_redemption.order_id").
+		Where("promo_redemption.promo_code_id = ?", promoID).
+		Where("o.status != ?", schema.OrderCancelled)
+	if email != "" {
+		query = query.Where("lower(promo_redemption.email) = lower(?)", email)
+	}
+	return query.Count(ctx)
+}
+
+// Finds a promo code a customer entered and checks they can still use it
+// The code is locked until the transaction ends, so concurrent orders can't go over its limits
+func lookupPromoCode(ctx context.Context, tx bun.Tx, code string, email string) (*schema.PromoCode, error) {
+	var promo schema.PromoCode
+	err := tx.NewSelect().
+		Model(&promo).
+		Where("upper(code) = upper(?)", strings.TrimSpace(code)).
+		For("UPDATE").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: there's no code %q", ErrInvalidPromo, code)
+	} else if err != nil {
+		return nil, err
+	}
+
+	if promo.DisabledAt != nil {
+		return nil, fmt.Errorf("%w: %s is no longer active", ErrInvalidPromo, promo.Code)
+	}
+	if promo.ExpiresAt != nil && time.Now().After(*promo.ExpiresAt) {
+		return nil, fmt.Errorf("%w: %s has expired", ErrInvalidPromo, promo.Code)
+	}
+
+	if promo.MaxUses > 0 {
+		uses, err := countPromoUses(ctx, tx, promo.ID, "")
+		if err != nil {
+			return nil, err
+		}
+		if uses >= promo.MaxUses {
+			return nil, fmt.Errorf("%w: %s has been used up", ErrInvalidPromo, promo.Code)
+		}
+	}
+	if promo.MaxUsesPerEmail > 0 {
+		uses, err := countPromoUses(ctx, tx, promo.ID, email)
+		if err != nil {
+			return nil, err
+		}
+		if uses >= promo.MaxUsesPerEmail {
+			return nil, fmt.Errorf("%w: you've already used %s", ErrInvalidPromo, promo.Code)
+		}
+	}
+
+	return &promo, nil
+}
+
+// Takes a promo code off an order's items, setting each discounted item's Discount, and returns the order's discount
+// Returns ErrInvalidPromo if the order doesn't meet the code's conditions or nothing in it is discounted
+func applyPromoCode(promo *schema.PromoCode, items []schema.OrderItem, subtotal money.Money) (money.Money, error) {
+	if subtotal < promo.MinSubtotal {
+		return 0, fmt.Errorf("%w: %s needs an order of at least %s", ErrInvalidPromo, promo.Code, promo.MinSubtotal.Format(money.Currency()))
+	}
+	if promo.RequiresItemType != "" && !slices.ContainsFunc(items, func(item schema.OrderItem) bool {
+		return orderItemType(item) == promo.RequiresItemType
+	}) {
+		return 0, fmt.Errorf("%w: %s needs a %s item in the order", ErrInvalidPromo, promo.Code, promo.RequiresItemType)
+	}
+
+	// How much comes off a given amount
+	off := func(amount money.Money) money.Money {
+		if promo.PercentOff > 0 {
+			return amount.Percent(promo.PercentOff)
+		}
+		return money.Min(promo.AmountOff, amount)
+	}
+
+	var discount money.Money
+	switch promo.Scope {
+	case schema.PromoScopeOrder:
+		discount = off(subtotal)
+
+	case schema.PromoScopeItem:
+		remaining := promo.MaxItems
+		for i := range items {
+			item := &items[i]
+			if promo.ItemType != "" && orderItemType(*item) != promo.ItemType {
+				continue
+			}
+			if promo.MerchandiseID != uuid.Nil && (item.MerchandiseID == nil || *item.MerchandiseID != promo.MerchandiseID) {
+				continue
+			}
+
+			units := item.Quantity
+			if promo.MaxItems > 0 {
+				if remaining == 0 {
+					break
+				}
+				units = min(units, remaining)
+				remaining -= units
+			}
+			item.Discount = off(item.Price).Times(units)
+			discount += item.Discount
+		}
+	}
+
+	if discount <= 0 {
+		return 0, fmt.Errorf("%w: %s doesn't apply to anything in this order", ErrInvalidPromo, promo.Code)
+	}
+	return discount, nil
+}
+
+/*
+Adds a promo code; it takes either percent_off or a fixed amount_off
+Order-scoped codes discount the subtotal, item-scoped codes discount each matching item (up to max_items units),
+e.g. a free poster with any shirt:
+
+	curl -X POST http://localhost:8080/api/promo -H "Authorization: Bearer YOUR API KEY" \
+		-H "Content-Type: application/json" -d
+		'{
+			"code": "POSTERPAL",
+			"description": "Free poster with any shirt",
+			"percent_off": 100,
+			"scope": "item",
+			"item_type": "poster",
+			"max_items": 1,
+			"requires_item_type": "merchandise",
+			"expires_at": "2025-06-01T00:00:00Z",
+			"max_uses": 50,
+			"max_uses_per_email": 1
+		}'
+*/
+func AddPromoCode(c *gin.Context) {
+	var request PromoCodeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		fmt.Println(err)
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	request.Code = strings.TrimSpace(request.Code)
+	if request.Scope == "" {
+		request.Scope = schema.PromoScopeOrder
+	}
+	switch {
+	case request.Code == "" || strings.ContainsAny(request.Code, " \t\n"):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Code is required and can't contain spaces"})
+		return
+	case (request.PercentOff > 0) == (request.AmountOff > 0):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Give exactly one of percent_off or amount_off"})
+		return
+	case request.PercentOff < 0 || request.PercentOff > 100 || request.AmountOff < 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid discount"})
+		return
+	case request.Scope != schema.PromoScopeOrder && request.Scope != schema.PromoScopeItem:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Scope must be order or item"})
+		return
+	case request.Scope == schema.PromoScopeOrder && (request.ItemType != "" || request.MerchandiseID != nil || request.MaxItems != 0):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "item_type, merchandise_id, and max_items only apply to item-scoped codes"})
+		return
+	case request.ItemType != "" && !isValidItemType(request.ItemType),
+		request.RequiresItemType != "" && !isValidItemType(request.RequiresItemType):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Item types must be merchandise or poster"})
+		return
+	case request.MaxItems < 0 || request.MaxUses < 0 || request.MaxUsesPerEmail < 0 || request.MinSubtotal < 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Limits can't be negative"})
+		return
+	}
+
+	promo := schema.PromoCode{
+		ID:               uuid.New(),
+		Code:             request.Code,
+		Description:      request.Description,
+		PercentOff:       request.PercentOff,
+		AmountOff:        request.AmountOff,
+		Scope:            request.Scope,
+		ItemType:         request.ItemType,
+		MaxItems:         request.MaxItems,
+		RequiresItemType: request.RequiresItemType,
+		MinSubtotal:      request.MinSubtotal,
+		ExpiresAt:        request.ExpiresAt,
+		MaxUses:          request.MaxUses,
+		MaxUsesPerEmail:  request.MaxUsesPerEmail,
+		CreatedAt:        time.Now(),
+	}
+	if request.MerchandiseID != nil {
+		promo.MerchandiseID = *request.MerchandiseID
+	}
+
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	// Begin transaction
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	// Ensure rollback if error occurs
+	defer tx.Rollback()
+
+	exists, err := tx.NewSelect().
+		Model((*schema.PromoCode)(nil)).
+		Where("upper(code) = upper(?)", promo.Code).
+		Exists(ctx)
+	if err != nil {
+		fmt.Printf("Error checking promo code: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	if exists {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"success": false, "error": "A promo code with this code already exists"})
+		return
+	}
+
+	if _, err := tx.NewInsert().Model(&promo).Exec(ctx); err != nil {
+		fmt.Printf("Error inserting promo code: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := recordAudit(ctx, tx, c, schema.AuditCreate, "promo_code", promo.ID, nil, promo); err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": gin.H{"id": promo.ID}})
+}
+
+/*
+Gets all promo codes with how many times each has been used
+
+	curl -X GET http://localhost:8080/api/promo/all -H "Authorization: Bearer YOUR API KEY"
+*/
+func GetAllPromoCodes(c *gin.Context) {
+	type PromoCodeWithUses struct {
+		schema.PromoCode
+		Uses int
+	}
+
+	var codes []schema.PromoCode
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	err := db.NewSelect().
+		Model(&codes).
+		Order("created_at DESC").
+		Scan(ctx)
+	if err != nil {
+		fmt.Printf("Error fetching promo codes: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	result := make([]PromoCodeWithUses, 0, len(codes))
+	for _, promo := range codes {
+		uses, err := countPromoUses(ctx, db, promo.ID, "")
+		if err != nil {
+			fmt.Printf("Error counting promo code uses: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+		result = append(result, PromoCodeWithUses{promo, uses})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
+
+/*
+Updates a promo code's description, expiry, or usage limits, or disables it
+The discount itself can't change once orders may have used it; add a new code instead
+
+	curl -X PUT http://localhost:8080/api/promo/00000000-0000-0000-0000-000000000000 \
+		-H "Authorization: Bearer YOUR API KEY" \
+		-H "Content-Type: application/json" \
+		-d '{"expires_at":"2025-07-01T00:00:00Z","max_uses":100,"disabled":false}'
+*/
+func UpdatePromoCode(c *gin.Context) {
+	// Ensure promo_id is provided and is a valid UUID
+	param := c.Param("promo_id")
+	if param == "" {
+		fmt.Println("promo_id path parameter is required")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	promoID, err := uuid.Parse(param)
+	if err != nil {
+		fmt.Println("promo_id must be a valid UUID")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	var request struct {
+		Description     *string    `json:"description"`
+		ExpiresAt       *time.Time `json:"expires_at"`
+		MaxUses         *int       `json:"max_uses"`
+		MaxUsesPerEmail *int       `json:"max_uses_per_email"`
+		Disabled        *bool      `json:"disabled"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		fmt.Println(err)
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	if request.Description == nil && request.ExpiresAt == nil && request.MaxUses == nil &&
+		request.MaxUsesPerEmail == nil && request.Disabled == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+		return
+	}
+	if (request.MaxUses != nil && *request.MaxUses < 0) || (request.MaxUsesPerEmail != nil && *request.MaxUsesPerEmail < 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Limits can't be negative"})
+		return
+	}
+
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	// Begin transaction
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	// Ensure rollback if error occurs
+	defer tx.Rollback()
+
+	var existingPromo schema.PromoCode
+	err = tx.NewSelect().
+		Model(&existingPromo).
+		Where("id = ?", promoID).
+		For("UPDATE").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Println("Promo code not found")
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Error fetching promo code: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	var promo schema.PromoCode
+	query := tx.NewUpdate().
+		Model(&promo).
+		Where("id = ?", promoID).
+		Returning("*")
+	if request.Description != nil {
+		query = query.Set("description = ?", *request.Description)
+	}
+	if request.ExpiresAt != nil {
+		query = query.Set("expires_at = ?", *request.ExpiresAt)
+	}
+	if request.MaxUses != nil {
+		query = query.Set("max_uses = ?", *request.MaxUses)
+	}
+	if request.MaxUsesPerEmail != nil {
+		query = query.Set("max_uses_per_email = ?", *request.MaxUsesPerEmail)
+	}
+	if request.Disabled != nil {
+		if *request.Disabled {
+			query = query.Set("disabled_at = COALESCE(disabled_at, ?)", time.Now())
+		} else {
+			query = query.Set("disabled_at = NULL")
+		}
+	}
+	if _, err := query.Exec(ctx); err != nil {
+		fmt.Printf("Error updating promo code: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := recordAudit(ctx, tx, c, schema.AuditUpdate, "promo_code", promoID, existingPromo, promo); err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": promo})
+}
+
+/*
+Deletes a promo code that hasn't been used yet; disable used codes instead so orders keep their history
+
+	curl -X DELETE http://localhost:8080/api/promo/00000000-0000-0000-0000-000000000000 -H "Authorization: Bearer YOUR API KEY"
+*/
+func DeletePromoCode(c *gin.Context) {
+	// Ensure promo_id is provided and is a valid UUID
+	param := c.Param("promo_id")
+	if param == "" {
+		fmt.Println("promo_id path parameter is required")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	promoID, err := uuid.Parse(param)
+	if err != nil {
+		fmt.Println("promo_id must be a valid UUID")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	// Begin transaction
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	// Ensure rollback if error occurs
+	defer tx.Rollback()
+
+	used, err := tx.NewSelect().
+		Model((*schema.PromoRedemption)(nil)).
+		Where("promo_code_id = ?", promoID).
+		Exists(ctx)
+	if err != nil {
+		fmt.Printf("Error checking promo code uses: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	if used {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"success": false, "error": "Promo code has been used; disable it instead"})
+		return
+	}
+
+	// Delete the promo code, keeping what was deleted for the audit log
+	var promo schema.PromoCode
+	result, err := tx.NewDelete().
+		Model(&promo).
+		Where("id = ?", promoID).
+		Returning("*").
+		Exec(ctx)
+	if err != nil {
+		fmt.Printf("Error deleting promo code: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		fmt.Println("Promo code not found")
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	}
+
+	if err := recordAudit(ctx, tx, c, schema.AuditDelete, "promo_code", promoID, promo, nil); err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Promo code deleted successfully"})
+}
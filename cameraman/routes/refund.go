@@ -0,0 +1,370 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golden-arm/internal"
+	"golden-arm/money"
+	"golden-arm/schema"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+var ErrInvalidRefund = errors.New("invalid refund")
+
+type RefundRequest struct {
+	Items   []RefundItemInfo `json:"items"`
+	Amount  *money.Money     `json:"amount,omitempty"` // Defaults to what the customer paid for the items
+	Reason  string           `json:"reason"`
+	Restock *bool            `json:"restock,omitempty"` // Whether the items go back into inventory; defaults to true
+}
+
+type RefundItemInfo struct {
+	OrderItemID uuid.UUID `json:"order_item_id"`
+	Quantity    int       `json:"quantity"`
+}
+
+// A line on an updated receipt
+type ReceiptItem struct {
+	Name             string
+	Quantity         int // As ordered
+	RefundedQuantity int
+	Paid             money.Money // For the whole line, after discounts
+}
+
+// Refund email, with an updated receipt
+type RefundEmailData struct {
+	Name     string
+	OrderID  uuid.UUID
+	Refund   schema.OrderRefund
+	Items    []ReceiptItem
+	Total    money.Money // As ordered
+	Refunded money.Money // Including this refund
+	NetTotal money.Money
+	Currency string
+}
+
+// Sums how much of each of an order's items has been refunded, by order item ID
+func getRefundedQuantities(ctx context.Context, db bun.IDB, orderID uuid.UUID) (map[uuid.UUID]int, error) {
+	var rows []struct {
+		OrderItemID uuid.UUID `bun:"order_item_id"`
+		Quantity    int       `bun:"quantity"`
+	}
+	err := db.NewSelect().
+		Model((*schema.OrderRefundItem)(nil)).
+		ColumnExpr("order_refund_item.order_item_id, sum(order_refund_item.quantity) AS quantity").
+		Join("JOIN order_refunds AS r ON r.id = order_refund_item.refund_id").
+		Where("r.order_id = ?", orderID).
+		GroupExpr("order_refund_item.order_item_id").
+		Scan(ctx, &rows)
+	if err != nil {
+		return nil, err
+	}
+
+	refunded := make(map[uuid.UUID]int, len(rows))
+	for _, row := range rows {
+		refunded[row.OrderItemID] = row.Quantity
+	}
+	return refunded, nil
+}
+
+// What the customer paid for each of an order's items, by order item ID
+// Any discount on the whole order is spread over the items by value
+func paidByItem(order schema.Order, items []schema.OrderItem) map[uuid.UUID]money.Money {
+	paid := make(map[uuid.UUID]money.Money, len(items))
+	var subtotal money.Money
+	for _, item := range items {
+		paid[item.ID] = item.Price.Times(item.Quantity) - item.Discount
+		subtotal += paid[item.ID]
+	}
+
+	// Whatever the items' own discounts don't account for was taken off the whole order
+	orderDiscount := subtotal - order.Total
+	if orderDiscount > 0 && subtotal > 0 {
+		for id, line := range paid {
+			paid[id] = line - money.Money(int64(orderDiscount)*int64(line)/int64(subtotal))
+		}
+	}
+	return paid
+}
+
+// Queues an email telling the customer about a refund, with their updated receipt
+func queueRefundEmail(ctx context.Context, tx bun.Tx, order schema.Order, refund schema.OrderRefund) error {
+	var items []schema.OrderItem
+	err := tx.NewSelect().
+		Model(&items).
+		Relation("Merchandise").
+		Relation("Movie").
+		Where("order_id = ?", order.ID).
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	refunded, err := getRefundedQuantities(ctx, tx, order.ID)
+	if err != nil {
+		return err
+	}
+	paid := paidByItem(order, items)
+
+	data := RefundEmailData{
+		Name:     order.Name,
+		OrderID:  order.ID,
+		Refund:   refund,
+		Total:    order.Total,
+		Refunded: order.Refunded,
+		NetTotal: order.Total - order.Refunded,
+		Currency: order.Currency,
+	}
+	for _, item := range items {
+		data.Items = append(data.Items, ReceiptItem{
+			Name:             orderItemName(item),
+			Quantity:         item.Quantity,
+			RefundedQuantity: refunded[item.ID],
+			Paid:             paid[item.ID],
+		})
+	}
+
+	body, err := renderEmailTemplate("refund_email.html", nil, data)
+	if err != nil {
+		return err
+	}
+
+	from := os.Getenv("ORDERS_SENDER")
+	subject := "Your refund and updated receipt @ The Golden Arm"
+
+	return queueEmail(ctx, tx, from, order.Email, subject, body)
+}
+
+/*
+Refunds some or all of a paid order's items and emails the customer an updated receipt
+The order and its items are kept as ordered; the refund is recorded alongside them and taken off the order's net total
+Refunded items are restocked unless restock is false, e.g. if they came back damaged; refunding everything left moves the
+order to refunded
+Record the refund with the payment provider too; this only keeps the shop's books
+
+	curl -X POST http://localhost:8080/api/order/00000000-0000-0000-0000-000000000000/refund \
+		-H "Authorization: Bearer YOUR API KEY" \
+		-H "Content-Type: application/json" \
+		-d '{
+			"items": [
+				{
+					"order_item_id": "00000000-0000-0000-0000-000000000000",
+					"quantity": 1
+				}
+			],
+			"reason": "Wrong size",
+			"restock": true
+		}'
+*/
+func RefundOrderItems(c *gin.Context) {
+	// Ensure order_id is provided and is a valid UUID
+	param := c.Param("order_id")
+	if param == "" {
+		fmt.Println("order_id path parameter is required")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	orderID, err := uuid.Parse(param)
+	if err != nil {
+		fmt.Println("order_id must be a valid UUID")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	var request RefundRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		fmt.Printf("Error binding JSON: %v", err)
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	if len(request.Items) == 0 || request.Reason == "" || (request.Amount != nil && *request.Amount < 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Items and a reason are required, and the amount can't be negative"})
+		return
+	}
+
+	// Begin transaction
+	ctx := context.Background()
+	tx, err := schema.GetDBConn().BeginTx(ctx, nil)
+	if err != nil {
+		fmt.Printf("Error starting transaction: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	// Ensure rollback if error occurs
+	defer tx.Rollback()
+
+	// Lock the order so refunds can't overlap
+	var order schema.Order
+	err = tx.NewSelect().
+		Model(&order).
+		Where("id = ?", orderID).
+		For("UPDATE").
+		Scan(ctx)
+	if err != nil {
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	}
+	before := order
+
+	// Only paid orders have anything to refund; unpaid ones are cancelled whole
+	if !slices.Contains(orderTransitions[order.Status], schema.OrderRefunded) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   fmt.Sprintf("Can't refund items of a %s order", order.Status),
+		})
+		return
+	}
+
+	var items []schema.OrderItem
+	err = tx.NewSelect().
+		Model(&items).
+		Where("order_id = ?", orderID).
+		Scan(ctx)
+	if err != nil {
+		fmt.Printf("Error fetching order items: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	refunded, err := getRefundedQuantities(ctx, tx, orderID)
+	if err != nil {
+		fmt.Printf("Error fetching refunded quantities: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	paid := paidByItem(order, items)
+
+	refund := schema.OrderRefund{
+		ID:        uuid.New(),
+		OrderID:   orderID,
+		Reason:    request.Reason,
+		Restocked: request.Restock == nil || *request.Restock,
+		Date:      time.Now(),
+	}
+	if operator := internal.GetOperator(c); operator != nil {
+		refund.ActorID = operator.ID
+		refund.ActorName = operator.Name
+	}
+
+	// Check each item has enough left to refund, and work out what the customer paid for them
+	var amount money.Money
+	var restock []schema.OrderItem
+	for _, info := range request.Items {
+		index := slices.IndexFunc(items, func(item schema.OrderItem) bool { return item.ID == info.OrderItemID })
+		if index < 0 || info.Quantity <= 0 || refunded[info.OrderItemID]+info.Quantity > items[index].Quantity {
+			err = fmt.Errorf("%w: can't refund %d of item %s", ErrInvalidRefund, info.Quantity, info.OrderItemID)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		item := items[index]
+		refunded[item.ID] += info.Quantity
+
+		amount += money.Money(int64(paid[item.ID]) * int64(info.Quantity) / int64(item.Quantity))
+		refund.Items = append(refund.Items, schema.OrderRefundItem{
+			ID:          uuid.New(),
+			RefundID:    refund.ID,
+			OrderItemID: item.ID,
+			Quantity:    info.Quantity,
+		})
+
+		item.Quantity = info.Quantity
+		restock = append(restock, item)
+	}
+
+	// Never refund more than is left of what the customer paid
+	remaining := order.Total - order.Refunded
+	if request.Amount != nil {
+		if *request.Amount > remaining {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Only %s is left to refund", remaining.Format(order.Currency))})
+			return
+		}
+		amount = *request.Amount
+	}
+	refund.Amount = money.Min(amount, remaining)
+
+	if _, err := tx.NewInsert().Model(&refund).Exec(ctx); err != nil {
+		fmt.Printf("Error recording refund: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	if _, err := tx.NewInsert().Model(&refund.Items).Exec(ctx); err != nil {
+		fmt.Printf("Error recording refund items: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if refund.Restocked {
+		movement := stockMovement(c, schema.MovementReturn, "Refunded: "+request.Reason)
+		if err := restoreInventory(ctx, tx, restock, movement); err != nil {
+			fmt.Printf("Error restocking refunded items: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+	}
+
+	// Nothing left, so the whole order is refunded; every item's been restocked or written off already
+	allRefunded := true
+	for _, item := range items {
+		allRefunded = allRefunded && refunded[item.ID] == item.Quantity
+	}
+	refundedTotal := order.Refunded + refund.Amount
+	if allRefunded {
+		operatorID := uuid.Nil
+		if operator := internal.GetOperator(c); operator != nil {
+			operatorID = operator.ID
+		}
+		if err := transitionOrder(ctx, tx, &order, schema.OrderRefunded, operatorID); err != nil {
+			fmt.Printf("Error refunding order: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+	}
+
+	// Set after the status, since refunding the whole order would otherwise count as refunding all of its total
+	order.Refunded = refundedTotal
+	_, err = tx.NewUpdate().
+		Model(&order).
+		Column("refunded_cents").
+		WherePK().
+		Exec(ctx)
+	if err != nil {
+		fmt.Printf("Error updating order: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := queueRefundEmail(ctx, tx, order, refund); err != nil {
+		fmt.Printf("Error queueing refund email: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := recordAudit(ctx, tx, c, "refund", "order", orderID, before, order); err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		fmt.Printf("Error committing transaction: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"refund":    refund,
+		"net_total": order.Total - order.Refunded,
+		"status":    order.Status,
+	})
+}
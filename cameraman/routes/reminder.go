@@ -0,0 +1,198 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"golden-arm/schema"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+// How often screenings are checked for reminders that are due
+const reminderInterval = time.Minute
+
+// Default for REMINDER_OFFSETS
+var defaultReminderOffsets = []time.Duration{24 * time.Hour, 2 * time.Hour}
+
+// Returns how long before a screening reminders are sent, shortest first, e.g. REMINDER_OFFSETS=24h,2h
+func reminderOffsets() []time.Duration {
+	var offsets []time.Duration
+	for _, value := range strings.Split(os.Getenv("REMINDER_OFFSETS"), ",") {
+		offset, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || offset < time.Minute {
+			continue
+		}
+		offsets = append(offsets, offset.Truncate(time.Minute))
+	}
+	if len(offsets) == 0 {
+		offsets = slices.Clone(defaultReminderOffsets)
+	}
+
+	slices.Sort(offsets)
+	return slices.Compact(offsets)
+}
+
+// Seats one movie-goer booked for a screening, reminded about together in one email
+type reminderGroup struct {
+	ScreeningID    uuid.UUID
+	Email          string // In lower case
+	ReservationIDs []uuid.UUID
+}
+
+// Finds reservations due the reminder sent the given time before their screening, grouped by who booked them
+// Seats booked after the reminder time are skipped, since their confirmation email has only just been sent
+func getDueReminders(ctx context.Context, db bun.IDB, offset time.Duration) ([]reminderGroup, error) {
+	now := time.Now()
+	minutes := int(offset / time.Minute)
+
+	var reservations []schema.Reservation
+	err := db.NewSelect().
+		Model(&reservations).
+		Relation("Screening").
+		Where("screening.date > ? AND screening.date <= ?", now, now.Add(offset)).
+		Where("reservation.date < screening.date - make_interval(mins => ?)", minutes).
+		Where("NOT EXISTS (SELECT 1 FROM reservation_reminders AS rr WHERE rr.reservation_id = reservation.id AND rr.before_minutes = ?)", minutes).
+		Order("reservation.screening_id", "reservation.seat_number").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	type groupKey struct {
+		ScreeningID uuid.UUID
+		Email       string
+	}
+	var groups []reminderGroup
+	index := make(map[groupKey]int)
+	for _, res := range reservations {
+		key := groupKey{ScreeningID: res.ScreeningID, Email: strings.ToLower(res.Email)}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, reminderGroup{ScreeningID: key.ScreeningID, Email: key.Email})
+		}
+		groups[i].ReservationIDs = append(groups[i].ReservationIDs, res.ID)
+	}
+	return groups, nil
+}
+
+// Claims the reminder for each reservation in a group and queues one email for the seats claimed
+// Reminders for longer offsets are recorded as sent too, so a late reminder isn't followed by an earlier one
+func sendReminder(ctx context.Context, tx bun.Tx, group reminderGroup, offset time.Duration, offsets []time.Duration) error {
+	// Seats cancelled since the sweep started are left out
+	var reservations []schema.Reservation
+	err := tx.NewSelect().
+		Model(&reservations).
+		Where("id IN (?)", bun.In(group.ReservationIDs)).
+		Order("seat_number").
+		For("UPDATE").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var claimed []schema.Reservation
+	for _, res := range reservations {
+		for _, other := range offsets {
+			if other < offset {
+				continue
+			}
+			reminder := schema.ReservationReminder{
+				ID:            uuid.New(),
+				ReservationID: res.ID,
+				BeforeMinutes: int(other / time.Minute),
+				SentAt:        now,
+			}
+			result, err := tx.NewInsert().
+				Model(&reminder).
+				On("CONFLICT (reservation_id, before_minutes) DO NOTHING").
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+
+			// Nothing is inserted if another instance already sent this reminder
+			if rowsAffected, _ := result.RowsAffected(); other == offset && rowsAffected > 0 {
+				claimed = append(claimed, res)
+			}
+		}
+	}
+	if len(claimed) == 0 {
+		return nil
+	}
+
+	var screening schema.Screening
+	err = tx.NewSelect().
+		Model(&screening).
+		Relation("Movie").
+		Where("screening.id = ?", group.ScreeningID).
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := newResEmailData(claimed[0].Name, claimed[0].Email, claimed, screening)
+	if err != nil {
+		return err
+	}
+	return queueReminderEmail(ctx, tx, data)
+}
+
+// Queues a reminder about a movie-goer's upcoming reservation, with links to cancel it
+func queueReminderEmail(ctx context.Context, db bun.IDB, data ResEmailData) error {
+	body, err := renderEmailTemplate("reminder_email.html", nil, data)
+	if err != nil {
+		return err
+	}
+
+	from := os.Getenv("RESERVATIONS_SENDER")
+	subject := fmt.Sprintf("Reminder: \"%s\" @ The Golden Arm, %s", data.MovieTitle, data.MovieDate)
+
+	return queueEmail(ctx, db, from, data.To, subject, body)
+}
+
+// Queues every reminder that is due, each movie-goer's in its own transaction
+// Shorter offsets go first, so someone due more than one reminder only gets the one closest to the screening
+func sendDueReminders(ctx context.Context) error {
+	db := schema.GetDBConn()
+	offsets := reminderOffsets()
+
+	for _, offset := range offsets {
+		groups, err := getDueReminders(ctx, db, offset)
+		if err != nil {
+			return fmt.Errorf("failed to fetch due reminders: %w", err)
+		}
+
+		for _, group := range groups {
+			err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+				return sendReminder(ctx, tx, group, offset, offsets)
+			})
+			if err != nil {
+				fmt.Printf("Error sending reminder to %s: %v\n", group.Email, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Periodically sends reminders before screenings in the background
+func StartReminderScheduler() {
+	go func() {
+		ticker := time.NewTicker(reminderInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := sendDueReminders(context.Background()); err != nil {
+				fmt.Printf("Error sending reminders: %v\n", err)
+			}
+		}
+	}()
+}
@@ -1,62 +1,79 @@
 package routes
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
-	"embed"
 	"errors"
 	"fmt"
 	"golden-arm/internal"
+	"golden-arm/mailer"
 	"golden-arm/schema"
-	"html/template"
 	"net/http"
 	"os"
+	"slices"
+	"strconv"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/sesv2"
-	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/uptrace/bun"
 )
 
+// Default for MAX_SEATS_PER_EMAIL
+const defaultMaxSeatsPerEmail = 4
+
+// How long an emailed cancel link works for; screenings moved to a later date stay cancellable,
+// and whether the screening has passed is checked when the link is used
+const cancelLinkLifetime = 365 * 24 * time.Hour
+
+// Returned when a movie-goer tries to cancel a seat at a screening that has already started
+var ErrScreeningPassed = errors.New("screening has already passed")
+
 type ReservationRequest struct {
-	MovieID    uuid.UUID `json:"movie_id" binding:"required"`
-	SeatNumber string    `json:"seat_number" binding:"required"`
-	Name       string    `json:"name" binding:"required"`
-	Email      string    `json:"email" binding:"required,email"`
+	ScreeningID uuid.UUID `json:"screening_id" binding:"required"`
+	SeatNumbers []string  `json:"seat_numbers" binding:"required,min=1,dive,required"`
+	GuestNames  []string  `json:"guest_names"` // Optional; one per seat, in the same order
+	Name        string    `json:"name" binding:"required"`
+	Email       string    `json:"email" binding:"required,email"`
 }
 
 // Reservation confirmation email
 type ResEmailData struct {
 	To           string
 	Name         string
-	ResID        string
 	MovieTitle   string
 	MovieDate    string
 	MovieRuntime string
-	SeatNumber   string
+	Seats        []ResEmailSeat
 	PosterURL    string
+
+	Calendar mailer.Attachment // The screening as a calendar event, attached to the email
 }
 
-// Theater seat layout (must match frontend seating map)
-var Seats = []string{
-	"A1", "A2", "A3", "A4",
-	"B1", "B2", "B3", "B4",
-	"C1", "C2", "C3", "C4", "C5",
-	"D1", "D2", "D3", "D4", "D5",
-	"E1", "E2", "E3", "E4", "E5", "E6", "E7",
+// A reserved seat listed in the confirmation email
+type ResEmailSeat struct {
+	CancelToken string // Signed reservation ID for the public cancel link
+	SeatNumber  string
+	GuestName   string
 }
 
-func contains(slice []string, item string) bool {
-	for _, element := range slice {
-		if element == item {
-			return true
-		}
+// Reservation cancellation email
+type CancelEmailData struct {
+	To         string
+	Name       string
+	MovieTitle string
+	MovieDate  string
+	SeatNumber string
+	PosterURL  string
+}
+
+// Returns how many seats one email can hold for a single screening, e.g. MAX_SEATS_PER_EMAIL=6
+func maxSeatsPerEmail() int {
+	max, err := strconv.Atoi(os.Getenv("MAX_SEATS_PER_EMAIL"))
+	if err != nil || max <= 0 {
+		return defaultMaxSeatsPerEmail
 	}
-	return false
+	return max
 }
 
 // Formats a movie runtime in minutes into a string like "1h 30m" or "30m"
@@ -74,15 +91,66 @@ func formatRuntime(runtime int) (string, error) {
 	return fmt.Sprintf("%dm", minutes), nil
 }
 
+// Formats a screening date in the theater's time zone, e.g. "Friday, January 10 8:00 PM"
+func formatScreeningDate(date time.Time) (string, error) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		return "", fmt.Errorf("failed to load time zone: %w", err)
+	}
+	return date.In(loc).Format("Monday, January 2 3:04 PM"), nil
+}
+
+// Signs the token in a reservation's cancel link
+func cancelToken(resID uuid.UUID) string {
+	return internal.SignToken(internal.TokenCancelReservation, resID.String(), time.Now().Add(cancelLinkLifetime))
+}
+
+// Builds one confirmation email covering every seat booked together; the screening must have its Movie loaded
+func newResEmailData(name string, email string, reservations []schema.Reservation, screening schema.Screening) (ResEmailData, error) {
+	var data ResEmailData
+	var err error
+
+	data.To = email
+	data.Name = name
+	data.MovieTitle = screening.Movie.Title
+
+	data.MovieDate, err = formatScreeningDate(screening.Date)
+	if err != nil {
+		return data, err
+	}
+
+	data.MovieRuntime, err = formatRuntime(screening.Movie.Runtime)
+	if err != nil {
+		return data, fmt.Errorf("failed to format movie runtime: %w", err)
+	}
+
+	var seats []string
+	for _, res := range reservations {
+		data.Seats = append(data.Seats, ResEmailSeat{
+			CancelToken: cancelToken(res.ID),
+			SeatNumber:  res.SeatNumber,
+			GuestName:   res.GuestName,
+		})
+		seats = append(seats, res.SeatNumber)
+	}
+	data.PosterURL = screening.Movie.PosterURL
+	data.Calendar = reservationCalendarAttachment(screening, seats)
+
+	return data, nil
+}
+
 /*
-Reserves a seat and sends email confirmation
-Raises error for invalid seat or conflicting reservation
-Cancels reservation if email confirmation fails
+Reserves one or more seats and sends a single email confirmation
+Seats are booked all or none; raises error for any invalid seat or conflicting reservation
+Seats must exist in the screening's seat map; blocked seats can't be reserved, and staff seats can only be reserved by admins and programmers
+Each email can hold at most MAX_SEATS_PER_EMAIL seats per screening, unless reserved by an operator
+The confirmation is queued in the email outbox along with the reservations
 
 	curl -X POST http://localhost:8080/api/reserve -H "Content-Type: application/json" -d
 	'{
-		"movie_id": "00000000-0000-0000-0000-000000000000",
-		"seat_number": "A1",
+		"screening_id": "00000000-0000-0000-0000-000000000000",
+		"seat_numbers": ["A1", "A2"],
+		"guest_names": ["Joey B", "Jill B"],
 		"name": "Joey B",
 		"email": "jb@example.com"
 	}'
@@ -94,13 +162,19 @@ func Reserve(c *gin.Context) {
 		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
 		return
 	}
-
-	// Validate that the requested seat exists
-	if !contains(Seats, newRes.SeatNumber) {
-		fmt.Println("Invalid seat number")
+	if len(newRes.GuestNames) > 0 && len(newRes.GuestNames) != len(newRes.SeatNumbers) {
+		fmt.Println("guest_names must have one name per seat")
 		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
 		return
 	}
+	for i, seatNumber := range newRes.SeatNumbers {
+		if slices.Contains(newRes.SeatNumbers[:i], seatNumber) {
+			fmt.Printf("Seat %s requested more than once", seatNumber)
+			c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+			return
+		}
+	}
+	isOperator := internal.HasRole(c)
 
 	db := schema.GetDBConn()
 	ctx := context.Background()
@@ -114,181 +188,190 @@ func Reserve(c *gin.Context) {
 	// Ensure rollback if error occurs
 	defer tx.Rollback()
 
-	// Check for conflicting reservation (same seat in same movie)
-	var conflictingRes schema.Reservation
+	// Load screening and movie details first to ensure they exist
+	// The screening is locked so its seat map can't change until the seats are booked
+	var screening schema.Screening
 	err = tx.NewSelect().
-		Model(&conflictingRes).
-		Where("movie_id = ? AND seat_number = ?", newRes.MovieID, newRes.SeatNumber).
+		Model(&screening).
+		Relation("Movie").
+		Where("screening.id = ?", newRes.ScreeningID).
+		For("SHARE OF screening").
 		Scan(ctx)
-
-	if err == nil {
-		// Conflicting reservation found
-		fmt.Printf("Seat %s already reserved", newRes.SeatNumber)
-		c.AbortWithError(http.StatusConflict, errors.New("seat already reserved"))
+	if err != nil {
+		fmt.Println("Error loading screening details: ", err)
+		c.AbortWithError(http.StatusNotFound, errors.New("screening not found"))
 		return
-	} else if !errors.Is(err, sql.ErrNoRows) {
-		// Handle unexpected errors
+	}
+
+	// Validate that every requested seat exists in the screening's seat map and can be reserved
+	for _, seatNumber := range newRes.SeatNumbers {
+		seat, err := getSeat(ctx, tx, screening.SeatMapID, seatNumber)
+		if errors.Is(err, sql.ErrNoRows) {
+			fmt.Printf("Invalid seat number %s", seatNumber)
+			c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+			return
+		} else if err != nil {
+			fmt.Printf("Error loading seat: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+		if seat.Type == schema.SeatBlocked || (seat.Type == schema.SeatStaff && !internal.HasRole(c, schema.RoleProgrammer)) {
+			fmt.Printf("Seat %s cannot be reserved", seat.Label)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"success": false, "error": fmt.Sprintf("Seat %s cannot be reserved", seat.Label)})
+			return
+		}
+	}
+
+	// Enforce the per-email seat cap, counting seats this email already holds
+	if !isOperator {
+		// Hold a lock on this email's bookings for the screening until the transaction ends, so concurrent
+		// requests count one after the other instead of both slipping under the cap
+		_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext(?), hashtext(lower(?)))", newRes.ScreeningID.String(), newRes.Email)
+		if err != nil {
+			fmt.Printf("Error locking reservations: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+
+		reservedCount, err := tx.NewSelect().
+			Model((*schema.Reservation)(nil)).
+			Where("screening_id = ? AND lower(email) = lower(?)", newRes.ScreeningID, newRes.Email).
+			Count(ctx)
+		if err != nil {
+			fmt.Printf("Error counting reservations: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+		if max := maxSeatsPerEmail(); reservedCount+len(newRes.SeatNumbers) > max {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error":   fmt.Sprintf("At most %d seats can be reserved per email for a screening", max),
+			})
+			return
+		}
+	}
+
+	// Check for conflicting reservations (same seats in same screening)
+	var takenSeats []string
+	err = tx.NewSelect().
+		Model((*schema.Reservation)(nil)).
+		Column("seat_number").
+		Where("screening_id = ? AND seat_number IN (?)", newRes.ScreeningID, bun.In(newRes.SeatNumbers)).
+		Scan(ctx, &takenSeats)
+	if err != nil {
 		fmt.Printf("Error checking seat availability: %v", err)
 		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
 		return
 	}
 
-	// Load movie details first to ensure it exists
-	var movie schema.Movie
-	err = tx.NewSelect().
-		Model(&movie).
-		Where("id = ?", newRes.MovieID).
-		Scan(ctx)
+	// Seats offered to the waitlist are held until the offer is claimed or expires
+	heldSeats, err := getHeldSeats(ctx, tx, newRes.ScreeningID)
 	if err != nil {
-		fmt.Println("Error loading movie details: ", err)
-		c.AbortWithError(http.StatusNotFound, errors.New("movie not found"))
+		fmt.Printf("Error checking held seats: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	for _, seatNumber := range newRes.SeatNumbers {
+		if slices.Contains(heldSeats, seatNumber) {
+			takenSeats = append(takenSeats, seatNumber)
+		}
+	}
+
+	if len(takenSeats) > 0 {
+		fmt.Printf("Seats %v already reserved", takenSeats)
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"success": false, "error": "Seats already reserved", "seats": takenSeats})
 		return
 	}
 
-	// Create new reservation
-	res := schema.Reservation{
-		ID:         uuid.New(),
-		MovieID:    newRes.MovieID,
-		SeatNumber: newRes.SeatNumber,
-		Date:       time.Now(),
-		Name:       newRes.Name,
-		Email:      newRes.Email,
+	// Create new reservations, one per seat
+	groupID := uuid.New()
+	reservations := make([]schema.Reservation, len(newRes.SeatNumbers))
+	for i, seatNumber := range newRes.SeatNumbers {
+		reservations[i] = schema.Reservation{
+			ID:          uuid.New(),
+			ScreeningID: newRes.ScreeningID,
+			SeatNumber:  seatNumber,
+			Date:        time.Now(),
+			Name:        newRes.Name,
+			Email:       newRes.Email,
+			GroupID:     groupID,
+		}
+		if len(newRes.GuestNames) > 0 {
+			reservations[i].GuestName = newRes.GuestNames[i]
+		}
 	}
 
-	// Save reservation in transaction
+	// Save reservations in transaction
 	_, err = tx.NewInsert().
-		Model(&res).
+		Model(&reservations).
 		Exec(ctx)
 
-	if err != nil {
-		fmt.Printf("Error saving reservation: %v", err)
+	if schema.IsUniqueViolation(err) {
+		// Someone else booked one of the seats since we checked
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"success": false, "error": "Seats already reserved"})
+		return
+	} else if err != nil {
+		fmt.Printf("Error saving reservations: %v", err)
 		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
 		return
 	}
 	// Prepare email data
-	var data ResEmailData
-	data.To = res.Email
-	data.Name = res.Name
-	data.MovieTitle = movie.Title
-	data.ResID = res.ID.String()
-
-	loc, err := time.LoadLocation("America/New_York")
+	data, err := newResEmailData(newRes.Name, newRes.Email, reservations, screening)
 	if err != nil {
-		fmt.Println("Error loading time zone:", err)
+		fmt.Printf("Error preparing confirmation email: %v", err)
 		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
 		return
 	}
 
-	data.MovieDate = movie.Date.In(loc).Format("Monday, January 2 3:04 PM")
-
-	data.MovieRuntime, err = formatRuntime(movie.Runtime)
-	if err != nil {
-		fmt.Printf("Error formatting movie runtime: %v", err)
+	// Queue confirmation email; it's only sent if the reservations commit
+	if err := queueResConfirmationEmail(ctx, tx, data); err != nil {
+		fmt.Printf("Error queueing confirmation email: %v", err)
 		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
 		return
 	}
-	data.SeatNumber = res.SeatNumber
-	data.PosterURL = movie.PosterURL
 
-	// Send confirmation email
-	if err := sendResConfirmationEmail(data); err != nil {
-		fmt.Printf("Error sending confirmation email: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to send confirmation email: %v", err)})
-		return
-	}
-
-	// Only commit if email was sent successfully
 	if err := tx.Commit(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"success": true, "data": res})
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": reservations})
 }
 
-//go:embed templates/*
-var resEmailTemplate embed.FS
-
-func sendResConfirmationEmail(data ResEmailData) error {
-	// Load AWS config
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+// Queues the reservation confirmation email in the outbox
+func queueResConfirmationEmail(ctx context.Context, db bun.IDB, data ResEmailData) error {
+	body, err := renderEmailTemplate("res_email.html", nil, data)
 	if err != nil {
-		return fmt.Errorf("failed to load AWS config: %w", err)
+		return err
 	}
 
-	// Create SESv2 client
-	client := sesv2.NewFromConfig(cfg)
-
-	// Parse and fill the HTML email template
-	tmpl, err := template.ParseFS(resEmailTemplate, "templates/res_email.html")
-	if err != nil {
-		return fmt.Errorf("failed to parse email template: %w", err)
-	}
-
-	var body bytes.Buffer
-	if err := tmpl.Execute(&body, data); err != nil {
-		return fmt.Errorf("failed to execute email template: %w", err)
-	}
-
-	// Compose email
 	from := os.Getenv("RESERVATIONS_SENDER")
-	replyTo := os.Getenv("REPLYTO")
-	to := data.To
-	cc := replyTo // Optional: admin copy
 	subject := fmt.Sprintf("You're set to watch \"%s\" @ The Golden Arm: %s", data.MovieTitle, data.MovieDate)
 
-	// Compose the SES email input
-	input := &sesv2.SendEmailInput{
-		FromEmailAddress: aws.String(from),
-		Destination: &types.Destination{
-			ToAddresses: []string{to},
-			CcAddresses: []string{cc},
-		},
-		ReplyToAddresses: []string{replyTo},
-		Content: &types.EmailContent{
-			Simple: &types.Message{
-				Subject: &types.Content{
-					Data: aws.String(subject),
-				},
-				Body: &types.Body{
-					Html: &types.Content{
-						Data: aws.String(body.String()),
-					},
-				},
-			},
-		},
-	}
-
-	out, err := client.SendEmail(context.TODO(), input)
-	if err != nil {
-		return fmt.Errorf("failed to send reservation confirmation email: %w", err)
-	}
-
-	fmt.Printf("Reservation confirmation email sent to %s (SES Message ID: %s)\n", to, aws.ToString(out.MessageId))
-	return nil
+	return queueEmail(ctx, db, from, data.To, subject, body, data.Calendar)
 }
 
 /*
-Gets the seats that have been reserved for a movie
+Gets the seats that have been reserved for a screening
 
 	curl -X GET http://localhost:8080/api/reserved/00000000-0000-0000-0000-000000000000
 */
 func GetReservedSeats(c *gin.Context) {
-	// Ensure movie_id is provided and is a valid UUID
-	param := c.Param("movie_id")
+	// Ensure screening_id is provided and is a valid UUID
+	param := c.Param("screening_id")
 	if param == "" {
-		fmt.Println("movie_id path parameter is required")
+		fmt.Println("screening_id path parameter is required")
 		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
 		return
 	}
-	movieID, err := uuid.Parse(param)
+	screeningID, err := uuid.Parse(param)
 	if err != nil {
-		fmt.Println("movie_id must be a valid UUID")
+		fmt.Println("screening_id must be a valid UUID")
 		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
 		return
 	}
 
-	reservations, err := getReservations(movieID)
+	reservations, err := getReservations(screeningID)
 	if err != nil {
 		fmt.Printf("Error fetching reservations: %v", err)
 		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
@@ -300,42 +383,46 @@ func GetReservedSeats(c *gin.Context) {
 		reservedSeats = append(reservedSeats, reservation.SeatNumber)
 	}
 
+	// Seats held for waitlist offers can't be reserved either
+	heldSeats, err := getHeldSeats(context.Background(), schema.GetDBConn(), screeningID)
+	if err != nil {
+		fmt.Printf("Error fetching held seats: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	reservedSeats = append(reservedSeats, heldSeats...)
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data": gin.H{
-			"movie_id":       movieID,
+			"screening_id":   screeningID,
 			"reserved_seats": reservedSeats,
 		},
 	})
 }
 
 /*
-Gets full reservation data for a movie including names and emails
+Gets full reservation data for a screening including names and emails
 
 	curl -X GET http://localhost:8080/api/reservations/00000000-0000-0000-0000-000000000000 \
 	-H "Authorization: Bearer YOUR API KEY"
 */
 func GetReservations(c *gin.Context) {
-	if !internal.CheckAuthorization(c) {
-		c.AbortWithError(http.StatusUnauthorized, internal.ErrUnauthorized)
-		return
-	}
-
-	// Ensure movie_id is provided and is a valid UUID
-	param := c.Param("movie_id")
+	// Ensure screening_id is provided and is a valid UUID
+	param := c.Param("screening_id")
 	if param == "" {
-		fmt.Println("movie_id path parameter is required")
+		fmt.Println("screening_id path parameter is required")
 		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
 		return
 	}
-	movieID, err := uuid.Parse(param)
+	screeningID, err := uuid.Parse(param)
 	if err != nil {
-		fmt.Println("movie_id must be a valid UUID")
+		fmt.Println("screening_id must be a valid UUID")
 		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
 		return
 	}
 
-	reservations, err := getReservations(movieID)
+	reservations, err := getReservations(screeningID)
 	if err != nil {
 		fmt.Printf("Error fetching reservations: %v", err)
 		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
@@ -348,35 +435,36 @@ func GetReservations(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": reservations})
 }
 
-// Helper function returning all reservation data for a movie
-// Returns error if movie does not exist
-func getReservations(movieID uuid.UUID) ([]schema.Reservation, error) {
+// Helper function returning all reservation data for a screening
+// Returns error if screening does not exist
+func getReservations(screeningID uuid.UUID) ([]schema.Reservation, error) {
 	db := schema.GetDBConn()
 	ctx := context.Background()
 
-	// Validate if movie exists in the database
-	var movieExists uuid.UUID
+	// Validate if screening exists in the database
+	var screeningExists uuid.UUID
 	err := db.NewSelect().
-		Model((*schema.Movie)(nil)).
-		Where("id = ?", movieID).
+		Model((*schema.Screening)(nil)).
+		Where("id = ?", screeningID).
 		Column("id").
-		Scan(ctx, &movieExists)
+		Scan(ctx, &screeningExists)
 
 	if err != nil {
-		fmt.Printf("Error checking movie existence: %v", err)
+		fmt.Printf("Error checking screening existence: %v", err)
 		return nil, internal.ErrInternalServer
 	}
-	if movieExists == uuid.Nil {
-		fmt.Printf("Movie not found: %v", err)
+	if screeningExists == uuid.Nil {
+		fmt.Printf("Screening not found: %v", err)
 		return nil, internal.ErrNotFound
 	}
 
-	// Fetch reservations for the movie
+	// Fetch reservations for the screening
 	var reservations []schema.Reservation
 	err = db.NewSelect().
 		Model(&reservations).
-		Relation("Movie").
-		Where("movie_id = ?", movieID).
+		Relation("Screening").
+		Relation("Screening.Movie").
+		Where("screening_id = ?", screeningID).
 		Scan(ctx)
 
 	if err != nil {
@@ -388,9 +476,11 @@ func getReservations(movieID uuid.UUID) ([]schema.Reservation, error) {
 }
 
 /*
-Deletes reservation from database
+Deletes reservation from database and emails the movie-goer that it was cancelled
+If the screening has a waitlist, the freed seat is offered to the first person on it
 
-	curl -X DELETE http://localhost:8080/api/reservation/00000000-0000-0000-0000-000000000000
+	curl -X DELETE http://localhost:8080/api/reservation/00000000-0000-0000-0000-000000000000 \
+	-H "Authorization: Bearer YOUR API KEY"
 */
 func DeleteReservation(c *gin.Context) {
 	// Ensure reservation_id is provided and is a valid UUID
@@ -407,26 +497,150 @@ func DeleteReservation(c *gin.Context) {
 		return
 	}
 
-	db := schema.GetDBConn()
-	ctx := context.Background()
+	_, err = cancelReservation(context.Background(), c, resID)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Println("Reservation not found")
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Error deleting reservation: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
 
-	// Delete the reservation from the database
-	result, err := db.NewDelete().
-		Model((*schema.Reservation)(nil)).
-		Where("id = ?", resID).
-		Exec(ctx)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Reservation deleted successfully"})
+}
+
+/*
+Cancels a reservation using the signed token from its confirmation email
+Raises error if the token is invalid, the screening has passed, or the reservation was already cancelled
+
+	curl -X POST http://localhost:8080/api/reservation/cancel/CANCEL_TOKEN
+*/
+func CancelReservation(c *gin.Context) {
+	token := c.Param("token")
+	if token == "" {
+		fmt.Println("token path parameter is required")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
 
+	subject, err := internal.VerifyToken(internal.TokenCancelReservation, token)
+	if errors.Is(err, internal.ErrExpiredToken) {
+		c.AbortWithStatusJSON(http.StatusGone, gin.H{"success": false, "error": "This link has expired"})
+		return
+	} else if err != nil {
+		fmt.Printf("Error verifying cancel token: %v", err)
+		c.AbortWithError(http.StatusUnauthorized, internal.ErrUnauthorized)
+		return
+	}
+	resID, err := uuid.Parse(subject)
 	if err != nil {
-		fmt.Printf("Error deleting reservation: %v", err)
-		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		fmt.Println("Cancel token does not contain a valid reservation ID")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
 		return
 	}
 
-	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+	res, err := cancelReservation(context.Background(), nil, resID)
+	if errors.Is(err, sql.ErrNoRows) {
 		fmt.Println("Reservation not found")
 		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
 		return
+	} else if errors.Is(err, ErrScreeningPassed) {
+		c.AbortWithStatusJSON(http.StatusGone, gin.H{"success": false, "error": "Screening has already passed"})
+		return
+	} else if err != nil {
+		fmt.Printf("Error cancelling reservation: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Reservation deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"screening_id": res.ScreeningID,
+			"seat_number":  res.SeatNumber,
+		},
+	})
+}
+
+// Deletes a reservation, queues the cancellation email, and offers its seat to the screening's waitlist
+// c is the operator's request when an operator deletes it, or nil when the movie-goer cancels
+// Returns sql.ErrNoRows if the reservation doesn't exist, or ErrScreeningPassed if a movie-goer cancels too late
+func cancelReservation(ctx context.Context, c *gin.Context, resID uuid.UUID) (*schema.Reservation, error) {
+	db := schema.GetDBConn()
+
+	var res schema.Reservation
+	err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// Load the reservation first to know which seat is freed
+		err := tx.NewSelect().
+			Model(&res).
+			Relation("Screening").
+			Relation("Screening.Movie").
+			Where("reservation.id = ?", resID).
+			Scan(ctx)
+		if err != nil {
+			return err
+		}
+
+		// Operators can still clear out seats afterwards
+		if c == nil && !res.Screening.Date.After(time.Now()) {
+			return ErrScreeningPassed
+		}
+
+		_, err = tx.NewDelete().
+			Model((*schema.Reservation)(nil)).
+			Where("id = ?", resID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		// Operator deletions are audited; the movie-goer cancelling their own seat isn't
+		if c != nil {
+			before := res
+			before.Screening = nil
+			if err := recordAudit(ctx, tx, c, schema.AuditDelete, "reservation", resID, before, nil); err != nil {
+				return err
+			}
+		}
+
+		if err := queueResCancellationEmail(ctx, tx, res, *res.Screening); err != nil {
+			return err
+		}
+
+		// Offer the freed seat to the waitlist
+		return offerSeat(ctx, tx, *res.Screening, res.SeatNumber)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// Queues an email telling a movie-goer their reservation was cancelled; the screening must have its Movie loaded
+func queueResCancellationEmail(ctx context.Context, db bun.IDB, res schema.Reservation, screening schema.Screening) error {
+	var err error
+	data := CancelEmailData{
+		To:         res.Email,
+		Name:       res.Name,
+		MovieTitle: screening.Movie.Title,
+		SeatNumber: res.SeatNumber,
+		PosterURL:  screening.Movie.PosterURL,
+	}
+	data.MovieDate, err = formatScreeningDate(screening.Date)
+	if err != nil {
+		return err
+	}
+
+	body, err := renderEmailTemplate("cancel_email.html", nil, data)
+	if err != nil {
+		return err
+	}
+
+	from := os.Getenv("RESERVATIONS_SENDER")
+	subject := fmt.Sprintf("Your reservation for \"%s\" @ The Golden Arm was cancelled", data.MovieTitle)
+
+	return queueEmail(ctx, db, from, data.To, subject, body)
 }
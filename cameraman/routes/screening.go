@@ -0,0 +1,406 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"golden-arm/internal"
+	"golden-arm/schema"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type ScreeningRequest struct {
+	MovieID   uuid.UUID  `json:"movie_id" binding:"required"`
+	Date      time.Time  `json:"date" binding:"required"`
+	SeatMapID *uuid.UUID `json:"seat_map_id"` // Optional; defaults to the default seat map
+}
+
+/*
+Schedules a new screening of an existing movie
+
+	curl -X POST http://localhost:8080/api/screening -H "Authorization: Bearer YOUR API KEY" \
+	-H "Content-Type: application/json" -d
+	'{
+		"movie_id": "00000000-0000-0000-0000-000000000000",
+		"date": "2025-01-10T20:00:00Z",
+		"seat_map_id": "00000000-0000-0000-0000-000000000000"
+	}'
+*/
+func AddScreening(c *gin.Context) {
+	var newScreening ScreeningRequest
+	if err := c.ShouldBindJSON(&newScreening); err != nil {
+		fmt.Println(err)
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	// Ensure the movie being screened exists
+	exists, err := db.NewSelect().
+		Model((*schema.Movie)(nil)).
+		Where("id = ?", newScreening.MovieID).
+		Exists(ctx)
+	if err != nil {
+		fmt.Printf("Error checking if movie exists: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	if !exists {
+		fmt.Println("Movie not found")
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	}
+
+	// Use the default seat map unless one was given
+	var seatMapID uuid.UUID
+	if newScreening.SeatMapID != nil {
+		seatMapID = *newScreening.SeatMapID
+
+		exists, err := seatMapExists(ctx, db, seatMapID)
+		if err != nil {
+			fmt.Printf("Error checking if seat map exists: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+		if !exists {
+			fmt.Println("Seat map not found")
+			c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+			return
+		}
+	} else {
+		seatMapID, err = getDefaultSeatMapID(ctx, db)
+		if err != nil {
+			fmt.Printf("Error finding default seat map: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+	}
+
+	screening := schema.Screening{
+		ID:        uuid.New(),
+		MovieID:   newScreening.MovieID,
+		SeatMapID: seatMapID,
+		Date:      newScreening.Date,
+	}
+
+	// Begin transaction
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	// Ensure rollback if error occurs
+	defer tx.Rollback()
+
+	_, err = tx.NewInsert().
+		Model(&screening).
+		Exec(ctx)
+	if err != nil {
+		fmt.Printf("Error adding screening to database: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := recordAudit(ctx, tx, c, schema.AuditCreate, "screening", screening.ID, nil, screening); err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": screening})
+}
+
+/*
+Moves an existing screening to a new date and/or seat map
+
+	curl -X PUT http://localhost:8080/api/screening/00000000-0000-0000-0000-000000000000 \
+		-H "Authorization: Bearer YOUR API KEY" \
+		-H "Content-Type: application/json" \
+		-d '{"date":"2025-04-15T20:00:00Z","seat_map_id":"00000000-0000-0000-0000-000000000000"}'
+*/
+func UpdateScreening(c *gin.Context) {
+	// Ensure screening_id is provided and is a valid UUID
+	param := c.Param("screening_id")
+	if param == "" {
+		fmt.Println("screening_id path parameter is required")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	screeningID, err := uuid.Parse(param)
+	if err != nil {
+		fmt.Println("screening_id must be a valid UUID")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	var request struct {
+		Date      *time.Time `json:"date"`
+		SeatMapID *uuid.UUID `json:"seat_map_id"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		fmt.Println(err)
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	if request.Date == nil && request.SeatMapID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+		return
+	}
+
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	// Begin transaction
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	// Ensure rollback if error occurs
+	defer tx.Rollback()
+
+	var existingScreening schema.Screening
+	err = tx.NewSelect().
+		Model(&existingScreening).
+		Where("id = ?", screeningID).
+		For("UPDATE").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Println("Screening not found")
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Error fetching screening: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if request.SeatMapID != nil && *request.SeatMapID != existingScreening.SeatMapID {
+		exists, err := seatMapExists(ctx, tx, *request.SeatMapID)
+		if err != nil {
+			fmt.Printf("Error checking if seat map exists: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+		if !exists {
+			fmt.Println("Seat map not found")
+			c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+			return
+		}
+
+		staffSeats, err := getStaffSeats(ctx, tx, existingScreening.SeatMapID)
+		if err != nil {
+			fmt.Printf("Error fetching staff seats: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+
+		// Every seat already reserved must still be there to sit in
+		missing, err := getSeatsMissingFrom(ctx, tx, screeningID, *request.SeatMapID, staffSeats)
+		if err != nil {
+			fmt.Printf("Error checking reserved seats: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+		if len(missing) > 0 {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error":   fmt.Sprintf("Reserved seats not in the new seat map: %s", strings.Join(missing, ", ")),
+			})
+			return
+		}
+	}
+
+	var screening schema.Screening
+	query := tx.NewUpdate().
+		Model(&screening).
+		Where("id = ?", screeningID).
+		Returning("*")
+	if request.Date != nil {
+		query = query.Set("date = ?", *request.Date)
+	}
+	if request.SeatMapID != nil {
+		query = query.Set("seat_map_id = ?", *request.SeatMapID)
+	}
+	if _, err := query.Exec(ctx); err != nil {
+		fmt.Printf("Error updating screening: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := recordAudit(ctx, tx, c, schema.AuditUpdate, "screening", screeningID, existingScreening, screening); err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Screening updated successfully"})
+}
+
+/*
+Gets a screening by ID along with its movie
+
+	curl -X GET http://localhost:8080/api/screening/00000000-0000-0000-0000-000000000000
+*/
+func GetScreening(c *gin.Context) {
+	// Ensure screening_id is provided and is a valid UUID
+	param := c.Param("screening_id")
+	if param == "" {
+		fmt.Println("screening_id path parameter is required")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	screeningID, err := uuid.Parse(param)
+	if err != nil {
+		fmt.Println("screening_id must be a valid UUID")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	var screening schema.Screening
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	err = db.NewSelect().
+		Model(&screening).
+		Relation("Movie").
+		Where("screening.id = ?", screeningID).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Println("Screening not found")
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Error fetching screening: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": screening})
+}
+
+/*
+Gets all screenings of a movie, earliest first
+
+	curl -X GET http://localhost:8080/api/screenings/00000000-0000-0000-0000-000000000000
+*/
+func GetScreenings(c *gin.Context) {
+	// Ensure movie_id is provided and is a valid UUID
+	param := c.Param("movie_id")
+	if param == "" {
+		fmt.Println("movie_id path parameter is required")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	movieID, err := uuid.Parse(param)
+	if err != nil {
+		fmt.Println("movie_id must be a valid UUID")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	var screenings []schema.Screening
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	err = db.NewSelect().
+		Model(&screenings).
+		Where("movie_id = ?", movieID).
+		Order("date ASC").
+		Scan(ctx)
+	if err != nil {
+		fmt.Printf("Error fetching screenings: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	if screenings == nil {
+		screenings = []schema.Screening{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": screenings})
+}
+
+/*
+Deletes screening from database along with its reservations
+
+	curl -X DELETE http://localhost:8080/api/screening/00000000-0000-0000-0000-000000000000 \
+	-H "Authorization: Bearer YOUR API KEY"
+*/
+func DeleteScreening(c *gin.Context) {
+	// Ensure screening_id is provided and is a valid UUID
+	param := c.Param("screening_id")
+	if param == "" {
+		fmt.Println("screening_id path parameter is required")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	screeningID, err := uuid.Parse(param)
+	if err != nil {
+		fmt.Println("screening_id must be a valid UUID")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	// Begin transaction
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	// Ensure rollback if error occurs
+	defer tx.Rollback()
+
+	// Delete the screening from the database, keeping what was deleted for the audit log
+	var screening schema.Screening
+	result, err := tx.NewDelete().
+		Model(&screening).
+		Where("id = ?", screeningID).
+		Returning("*").
+		Exec(ctx)
+
+	if err != nil {
+		fmt.Printf("Error deleting screening: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		fmt.Println("Screening not found")
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	}
+
+	if err := recordAudit(ctx, tx, c, schema.AuditDelete, "screening", screeningID, screening, nil); err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Screening deleted successfully"})
+}
@@ -0,0 +1,708 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"golden-arm/internal"
+	"golden-arm/schema"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+type SeatMapRequest struct {
+	Name      string     `json:"name"`
+	IsDefault bool       `json:"is_default"`
+	Seats     []SeatInfo `json:"seats"`
+}
+
+type SeatInfo struct {
+	Row   string `json:"row"`
+	Label string `json:"label"`
+	Type  string `json:"type"` // Defaults to standard
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+}
+
+// A seat in a screening's layout along with whether it can still be booked
+type SeatLayout struct {
+	Row      string `json:"row"`
+	Label    string `json:"label"`
+	Type     string `json:"type"`
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+	Reserved bool   `json:"reserved"`
+}
+
+func isValidSeatType(seatType string) bool {
+	switch seatType {
+	case schema.SeatStandard, schema.SeatAccessible, schema.SeatBlocked, schema.SeatStaff:
+		return true
+	}
+	return false
+}
+
+// Checks that every seat has a label and valid type, and that no label is repeated
+// Fills in the standard seat type for seats that don't specify one
+func validateSeats(seats []SeatInfo) error {
+	labels := make(map[string]bool)
+	for i := range seats {
+		if seats[i].Label == "" || seats[i].Row == "" {
+			return errors.New("every seat needs a row and a label")
+		}
+		if labels[seats[i].Label] {
+			return fmt.Errorf("seat %s appears more than once", seats[i].Label)
+		}
+		labels[seats[i].Label] = true
+
+		if seats[i].Type == "" {
+			seats[i].Type = schema.SeatStandard
+		}
+		if !isValidSeatType(seats[i].Type) {
+			return fmt.Errorf("invalid type %q for seat %s", seats[i].Type, seats[i].Label)
+		}
+	}
+	return nil
+}
+
+// Inserts the seats of a seat map and returns them
+func insertSeats(ctx context.Context, tx bun.Tx, seatMapID uuid.UUID, seats []SeatInfo) ([]*schema.Seat, error) {
+	if len(seats) == 0 {
+		return nil, nil
+	}
+
+	rows := make([]*schema.Seat, len(seats))
+	for i, seat := range seats {
+		rows[i] = &schema.Seat{
+			ID:        uuid.New(),
+			SeatMapID: seatMapID,
+			Row:       seat.Row,
+			Label:     seat.Label,
+			Type:      seat.Type,
+			X:         seat.X,
+			Y:         seat.Y,
+		}
+	}
+
+	if _, err := tx.NewInsert().Model(&rows).Exec(ctx); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// Clears the default flag from every seat map so another can become the default
+func clearDefaultSeatMap(ctx context.Context, tx bun.Tx) error {
+	_, err := tx.NewUpdate().
+		Model((*schema.SeatMap)(nil)).
+		Set("is_default = false").
+		Where("is_default").
+		Exec(ctx)
+	return err
+}
+
+// Returns the ID of the seat map used for screenings that don't specify one
+func getDefaultSeatMapID(ctx context.Context, db bun.IDB) (uuid.UUID, error) {
+	var seatMapID uuid.UUID
+	err := db.NewSelect().
+		Model((*schema.SeatMap)(nil)).
+		Column("id").
+		Where("is_default").
+		Scan(ctx, &seatMapID)
+	return seatMapID, err
+}
+
+// Reports whether a seat map exists
+func seatMapExists(ctx context.Context, db bun.IDB, seatMapID uuid.UUID) (bool, error) {
+	return db.NewSelect().
+		Model((*schema.SeatMap)(nil)).
+		Where("id = ?", seatMapID).
+		Exists(ctx)
+}
+
+// Returns the labels of a seat map's staff seats
+func getStaffSeats(ctx context.Context, db bun.IDB, seatMapID uuid.UUID) ([]string, error) {
+	var labels []string
+	err := db.NewSelect().
+		Model((*schema.Seat)(nil)).
+		Column("label").
+		Where("seat_map_id = ? AND type = ?", seatMapID, schema.SeatStaff).
+		Scan(ctx, &labels)
+	return labels, err
+}
+
+// Returns the seats reserved at a screening that a seat map would take away: seats it has no seat for,
+// seats it blocks, and seats it makes staff-only
+// staffSeats are the seats that were staff seats before, which only operators could have reserved and can stay staff seats
+func getSeatsMissingFrom(ctx context.Context, db bun.IDB, screeningID uuid.UUID, seatMapID uuid.UUID, staffSeats []string) ([]string, error) {
+	var rows []struct {
+		SeatNumber string `bun:"seat_number"`
+		Type       string `bun:"type"`
+	}
+	err := db.NewSelect().
+		TableExpr("reservations AS r").
+		ColumnExpr("r.seat_number, coalesce(s.type, '') AS type").
+		Join("LEFT JOIN seats AS s ON s.seat_map_id = ? AND s.label = r.seat_number", seatMapID).
+		Where("r.screening_id = ?", screeningID).
+		Where("s.type IS NULL OR s.type NOT IN (?)", bun.In([]string{schema.SeatStandard, schema.SeatAccessible})).
+		OrderExpr("r.seat_number").
+		Scan(ctx, &rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, row := range rows {
+		if row.Type == schema.SeatStaff && slices.Contains(staffSeats, row.SeatNumber) {
+			continue
+		}
+		missing = append(missing, row.SeatNumber)
+	}
+	return missing, nil
+}
+
+// Looks up a seat by label in a seat map
+// Returns sql.ErrNoRows if the seat map has no such seat
+func getSeat(ctx context.Context, db bun.IDB, seatMapID uuid.UUID, label string) (*schema.Seat, error) {
+	seat := new(schema.Seat)
+	err := db.NewSelect().
+		Model(seat).
+		Where("seat_map_id = ? AND label = ?", seatMapID, label).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return seat, nil
+}
+
+/*
+Adds a new seat map
+
+	curl -X POST http://localhost:8080/api/seatmap -H "Authorization: Bearer YOUR API KEY" \
+	-H "Content-Type: application/json" -d
+	'{
+		"name": "Courtyard",
+		"is_default": false,
+		"seats": [
+			{"row": "A", "label": "A1", "type": "accessible", "x": 0, "y": 0},
+			{"row": "A", "label": "A2", "x": 1, "y": 0},
+			{"row": "B", "label": "B1", "type": "staff", "x": 0, "y": 1},
+			{"row": "B", "label": "B2", "type": "blocked", "x": 1, "y": 1}
+		]
+	}'
+*/
+func AddSeatMap(c *gin.Context) {
+	var newSeatMap SeatMapRequest
+	if err := c.ShouldBindJSON(&newSeatMap); err != nil {
+		fmt.Println(err)
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	if newSeatMap.Name == "" || len(newSeatMap.Seats) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name and seats are required"})
+		return
+	}
+	if err := validateSeats(newSeatMap.Seats); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	seatMap := schema.SeatMap{
+		ID:        uuid.New(),
+		Name:      newSeatMap.Name,
+		IsDefault: newSeatMap.IsDefault,
+	}
+
+	ctx := context.Background()
+	tx, err := schema.GetDBConn().BeginTx(ctx, nil)
+	if err != nil {
+		fmt.Printf("Error starting transaction: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	defer tx.Rollback()
+
+	if seatMap.IsDefault {
+		if err := clearDefaultSeatMap(ctx, tx); err != nil {
+			fmt.Printf("Error clearing default seat map: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+	}
+
+	if _, err := tx.NewInsert().Model(&seatMap).Exec(ctx); err != nil {
+		fmt.Printf("Error adding seat map: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	seatMap.Seats, err = insertSeats(ctx, tx, seatMap.ID, newSeatMap.Seats)
+	if err != nil {
+		fmt.Printf("Error adding seats: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := recordAudit(ctx, tx, c, schema.AuditCreate, "seat_map", seatMap.ID, nil, seatMap); err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Printf("Error committing transaction: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "message": "Seat map added successfully", "id": seatMap.ID})
+}
+
+/*
+Updates a seat map; if seats are given they replace the existing layout
+Existing reservations keep their seat labels, so seats reserved for upcoming screenings must stay in the layout
+
+	curl -X PUT http://localhost:8080/api/seatmap/00000000-0000-0000-0000-000000000000 \
+		-H "Authorization: Bearer YOUR API KEY" \
+		-H "Content-Type: application/json" \
+		-d '{"name": "Courtyard (winter)", "is_default": true}'
+*/
+func UpdateSeatMap(c *gin.Context) {
+	// Ensure seat_map_id is provided and is a valid UUID
+	param := c.Param("seat_map_id")
+	if param == "" {
+		fmt.Println("seat_map_id path parameter is required")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	seatMapID, err := uuid.Parse(param)
+	if err != nil {
+		fmt.Println("seat_map_id must be a valid UUID")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	var updateReq struct {
+		Name      string     `json:"name"`
+		IsDefault *bool      `json:"is_default"`
+		Seats     []SeatInfo `json:"seats"`
+	}
+	if err := c.ShouldBindJSON(&updateReq); err != nil {
+		fmt.Println(err)
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	if err := validateSeats(updateReq.Seats); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := schema.GetDBConn().BeginTx(ctx, nil)
+	if err != nil {
+		fmt.Printf("Error starting transaction: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	defer tx.Rollback()
+
+	seatMap := new(schema.SeatMap)
+	err = tx.NewSelect().
+		Model(seatMap).
+		Relation("Seats").
+		Where("id = ?", seatMapID).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Println("Seat map not found")
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Error finding seat map: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	existingSeatMap := *seatMap
+
+	if updateReq.Name != "" {
+		seatMap.Name = updateReq.Name
+	}
+	if updateReq.IsDefault != nil {
+		// There must always be a default seat map; it changes by making another one the default
+		if !*updateReq.IsDefault && seatMap.IsDefault {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"success": false, "error": "Make another seat map the default instead"})
+			return
+		}
+		if *updateReq.IsDefault && !seatMap.IsDefault {
+			if err := clearDefaultSeatMap(ctx, tx); err != nil {
+				fmt.Printf("Error clearing default seat map: %v", err)
+				c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+				return
+			}
+		}
+		seatMap.IsDefault = *updateReq.IsDefault
+	}
+
+	if _, err := tx.NewUpdate().Model(seatMap).WherePK().Exec(ctx); err != nil {
+		fmt.Printf("Error updating seat map: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	// Replace the layout
+	if len(updateReq.Seats) > 0 {
+		_, err := tx.NewDelete().
+			Model((*schema.Seat)(nil)).
+			Where("seat_map_id = ?", seatMapID).
+			Exec(ctx)
+		if err != nil {
+			fmt.Printf("Error deleting seats: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+
+		seatMap.Seats, err = insertSeats(ctx, tx, seatMapID, updateReq.Seats)
+		if err != nil {
+			fmt.Printf("Error adding seats: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+
+		var staffSeats []string
+		for _, seat := range existingSeatMap.Seats {
+			if seat.Type == schema.SeatStaff {
+				staffSeats = append(staffSeats, seat.Label)
+			}
+		}
+
+		// Locking the screenings keeps seats from being reserved until the new layout commits
+		var screenings []schema.Screening
+		err = tx.NewSelect().
+			Model(&screenings).
+			Where("seat_map_id = ? AND date > ?", seatMapID, time.Now()).
+			Order("date ASC").
+			For("UPDATE").
+			Scan(ctx)
+		if err != nil {
+			fmt.Printf("Error fetching screenings: %v", err)
+			c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+			return
+		}
+
+		// Every seat already reserved must still be there to sit in
+		conflicts := make(map[uuid.UUID][]string)
+		for _, screening := range screenings {
+			missing, err := getSeatsMissingFrom(ctx, tx, screening.ID, seatMapID, staffSeats)
+			if err != nil {
+				fmt.Printf("Error checking reserved seats: %v", err)
+				c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+				return
+			}
+			if len(missing) > 0 {
+				conflicts[screening.ID] = missing
+			}
+		}
+		if len(conflicts) > 0 {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"success":    false,
+				"error":      "Seats reserved for upcoming screenings are not in the new layout",
+				"screenings": conflicts,
+			})
+			return
+		}
+	}
+
+	if err := recordAudit(ctx, tx, c, schema.AuditUpdate, "seat_map", seatMapID, existingSeatMap, seatMap); err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Printf("Error committing transaction: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Seat map updated successfully"})
+}
+
+/*
+Gets a seat map and its seats
+
+	curl -X GET http://localhost:8080/api/seatmap/00000000-0000-0000-0000-000000000000
+*/
+func GetSeatMap(c *gin.Context) {
+	// Ensure seat_map_id is provided and is a valid UUID
+	param := c.Param("seat_map_id")
+	if param == "" {
+		fmt.Println("seat_map_id path parameter is required")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	seatMapID, err := uuid.Parse(param)
+	if err != nil {
+		fmt.Println("seat_map_id must be a valid UUID")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	var seatMap schema.SeatMap
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	err = db.NewSelect().
+		Model(&seatMap).
+		Relation("Seats", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Order("seat.y ASC", "seat.x ASC")
+		}).
+		Where("seat_map.id = ?", seatMapID).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Println("Seat map not found")
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Error fetching seat map: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": seatMap})
+}
+
+/*
+Gets all seat maps with their seats
+
+	curl -X GET http://localhost:8080/api/seatmap/all -H "Authorization: Bearer YOUR API KEY"
+*/
+func GetAllSeatMaps(c *gin.Context) {
+	var seatMaps []schema.SeatMap
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	err := db.NewSelect().
+		Model(&seatMaps).
+		Relation("Seats", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Order("seat.y ASC", "seat.x ASC")
+		}).
+		Order("name ASC").
+		Scan(ctx)
+	if err != nil {
+		fmt.Printf("Error fetching seat maps: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": seatMaps})
+}
+
+/*
+Gets the seat layout for a screening, marking which seats are already reserved
+
+	curl -X GET http://localhost:8080/api/screening/00000000-0000-0000-0000-000000000000/seats
+*/
+func GetScreeningSeats(c *gin.Context) {
+	// Ensure screening_id is provided and is a valid UUID
+	param := c.Param("screening_id")
+	if param == "" {
+		fmt.Println("screening_id path parameter is required")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	screeningID, err := uuid.Parse(param)
+	if err != nil {
+		fmt.Println("screening_id must be a valid UUID")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	var screening schema.Screening
+	err = db.NewSelect().
+		Model(&screening).
+		Relation("SeatMap").
+		Where("screening.id = ?", screeningID).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Println("Screening not found")
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Error fetching screening: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	var seats []schema.Seat
+	err = db.NewSelect().
+		Model(&seats).
+		Where("seat_map_id = ?", screening.SeatMapID).
+		Order("y ASC", "x ASC").
+		Scan(ctx)
+	if err != nil {
+		fmt.Printf("Error fetching seats: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	var reservedSeats []string
+	err = db.NewSelect().
+		Model((*schema.Reservation)(nil)).
+		Column("seat_number").
+		Where("screening_id = ?", screeningID).
+		Scan(ctx, &reservedSeats)
+	if err != nil {
+		fmt.Printf("Error fetching reservations: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	// Seats held for waitlist offers show as reserved
+	heldSeats, err := getHeldSeats(ctx, db, screeningID)
+	if err != nil {
+		fmt.Printf("Error fetching held seats: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	reserved := make(map[string]bool)
+	for _, label := range append(reservedSeats, heldSeats...) {
+		reserved[label] = true
+	}
+
+	layout := make([]SeatLayout, len(seats))
+	for i, seat := range seats {
+		layout[i] = SeatLayout{
+			Row:      seat.Row,
+			Label:    seat.Label,
+			Type:     seat.Type,
+			X:        seat.X,
+			Y:        seat.Y,
+			Reserved: reserved[seat.Label],
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"screening_id": screeningID,
+			"seat_map_id":  screening.SeatMapID,
+			"name":         screening.SeatMap.Name,
+			"seats":        layout,
+		},
+	})
+}
+
+/*
+Deletes a seat map that no screening uses
+
+	curl -X DELETE http://localhost:8080/api/seatmap/00000000-0000-0000-0000-000000000000 \
+	-H "Authorization: Bearer YOUR API KEY"
+*/
+func DeleteSeatMap(c *gin.Context) {
+	// Ensure seat_map_id is provided and is a valid UUID
+	param := c.Param("seat_map_id")
+	if param == "" {
+		fmt.Println("seat_map_id path parameter is required")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	seatMapID, err := uuid.Parse(param)
+	if err != nil {
+		fmt.Println("seat_map_id must be a valid UUID")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	// Screenings must be moved to another seat map first
+	inUse, err := db.NewSelect().
+		Model((*schema.Screening)(nil)).
+		Where("seat_map_id = ?", seatMapID).
+		Exists(ctx)
+	if err != nil {
+		fmt.Printf("Error checking seat map usage: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	if inUse {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"success": false, "error": "Seat map is used by a screening"})
+		return
+	}
+
+	// New screenings fall back to the default seat map, so another must be made default first
+	isDefault, err := db.NewSelect().
+		Model((*schema.SeatMap)(nil)).
+		Where("id = ? AND is_default", seatMapID).
+		Exists(ctx)
+	if err != nil {
+		fmt.Printf("Error checking default seat map: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	if isDefault {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"success": false, "error": "Cannot delete the default seat map"})
+		return
+	}
+
+	// Begin transaction
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	// Ensure rollback if error occurs
+	defer tx.Rollback()
+
+	// Keep the layout for the audit log, since the seats are deleted with the seat map
+	var seatMap schema.SeatMap
+	err = tx.NewSelect().
+		Model(&seatMap).
+		Relation("Seats").
+		Where("id = ?", seatMapID).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Println("Seat map not found")
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Error finding seat map: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	// Delete the seat map and its seats from the database
+	_, err = tx.NewDelete().
+		Model((*schema.SeatMap)(nil)).
+		Where("id = ?", seatMapID).
+		Exec(ctx)
+
+	if err != nil {
+		fmt.Printf("Error deleting seat map: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := recordAudit(ctx, tx, c, schema.AuditDelete, "seat_map", seatMapID, seatMap, nil); err != nil {
+		fmt.Printf("Error recording audit entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Seat map deleted successfully"})
+}
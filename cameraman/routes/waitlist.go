@@ -0,0 +1,491 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"golden-arm/internal"
+	"golden-arm/schema"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+// How long a waitlist offer is held when WAITLIST_CLAIM_WINDOW is unset or invalid
+const defaultClaimWindow = 2 * time.Hour
+
+// How often expired waitlist offers are passed on to the next person
+const waitlistSweepInterval = time.Minute
+
+type WaitlistRequest struct {
+	ScreeningID uuid.UUID `json:"screening_id" binding:"required"`
+	Name        string    `json:"name" binding:"required"`
+	Email       string    `json:"email" binding:"required,email"`
+}
+
+// Waitlist offer email
+type WaitlistEmailData struct {
+	To         string
+	Name       string
+	MovieTitle string
+	MovieDate  string
+	SeatNumber string
+	ClaimToken string
+	ExpiresAt  string
+	PosterURL  string
+}
+
+// Returns how long a freed seat is held for the person it's offered to, e.g. WAITLIST_CLAIM_WINDOW=30m
+func waitlistClaimWindow() time.Duration {
+	window, err := time.ParseDuration(os.Getenv("WAITLIST_CLAIM_WINDOW"))
+	if err != nil || window <= 0 {
+		return defaultClaimWindow
+	}
+	return window
+}
+
+// Returns the seats of a screening held for waitlist offers that haven't expired
+func getHeldSeats(ctx context.Context, db bun.IDB, screeningID uuid.UUID) ([]string, error) {
+	var heldSeats []string
+	err := db.NewSelect().
+		Model((*schema.WaitlistEntry)(nil)).
+		Column("offered_seat").
+		Where("screening_id = ? AND status = ? AND offer_expires_at > ?", screeningID, schema.WaitlistOffered, time.Now()).
+		Scan(ctx, &heldSeats)
+	return heldSeats, err
+}
+
+// Counts the seats of a screening that can still be reserved by the public
+func countAvailableSeats(ctx context.Context, db bun.IDB, screening schema.Screening) (int, error) {
+	return db.NewSelect().
+		Model((*schema.Seat)(nil)).
+		Where("seat_map_id = ?", screening.SeatMapID).
+		Where("type IN (?)", bun.In([]string{schema.SeatStandard, schema.SeatAccessible})).
+		Where("label NOT IN (SELECT seat_number FROM reservations WHERE screening_id = ?)", screening.ID).
+		Where("label NOT IN (SELECT offered_seat FROM waitlist_entries WHERE screening_id = ? AND status = ? AND offer_expires_at > ?)",
+			screening.ID, schema.WaitlistOffered, time.Now()).
+		Count(ctx)
+}
+
+// Offers a freed seat to the first person waiting for the screening, if any, and queues their offer email
+// The screening must have its Movie loaded
+func offerSeat(ctx context.Context, tx bun.Tx, screening schema.Screening, label string) error {
+	// No point offering seats for screenings that already started
+	if !screening.Date.After(time.Now()) {
+		return nil
+	}
+
+	// Only seats the public could have reserved are offered
+	seat, err := getSeat(ctx, tx, screening.SeatMapID, label)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if seat.Type != schema.SeatStandard && seat.Type != schema.SeatAccessible {
+		return nil
+	}
+
+	var entry schema.WaitlistEntry
+	err = tx.NewSelect().
+		Model(&entry).
+		Where("screening_id = ? AND status = ?", screening.ID, schema.WaitlistWaiting).
+		Order("date ASC").
+		Limit(1).
+		For("UPDATE SKIP LOCKED").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	token, err := generateSecureToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate claim token: %w", err)
+	}
+
+	// Offers never outlast the screening itself
+	expiresAt := time.Now().Add(waitlistClaimWindow())
+	if expiresAt.After(screening.Date) {
+		expiresAt = screening.Date
+	}
+
+	entry.Status = schema.WaitlistOffered
+	entry.OfferedSeat = label
+	entry.ClaimTokenHash = internal.HashToken(token)
+	entry.OfferExpiresAt = &expiresAt
+	_, err = tx.NewUpdate().
+		Model(&entry).
+		Column("status", "offered_seat", "claim_token_hash", "offer_expires_at").
+		WherePK().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	return queueWaitlistOfferEmail(ctx, tx, entry, screening, token)
+}
+
+// Queues the email offering a seat along with its claim link; the screening must have its Movie loaded
+// Only the token's hash is stored, so the token itself is passed in
+func queueWaitlistOfferEmail(ctx context.Context, db bun.IDB, entry schema.WaitlistEntry, screening schema.Screening, token string) error {
+	var err error
+	data := WaitlistEmailData{
+		To:         entry.Email,
+		Name:       entry.Name,
+		MovieTitle: screening.Movie.Title,
+		SeatNumber: entry.OfferedSeat,
+		ClaimToken: token,
+		PosterURL:  screening.Movie.PosterURL,
+	}
+	data.MovieDate, err = formatScreeningDate(screening.Date)
+	if err != nil {
+		return err
+	}
+	data.ExpiresAt, err = formatScreeningDate(*entry.OfferExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	body, err := renderEmailTemplate("waitlist_email.html", nil, data)
+	if err != nil {
+		return err
+	}
+
+	from := os.Getenv("RESERVATIONS_SENDER")
+	subject := fmt.Sprintf("A seat opened up for \"%s\" @ The Golden Arm", data.MovieTitle)
+
+	return queueEmail(ctx, db, from, data.To, subject, body)
+}
+
+/*
+Adds a person to the waitlist of a sold-out screening
+Raises error if seats are still available or the email is already on the waitlist
+
+	curl -X POST http://localhost:8080/api/waitlist -H "Content-Type: application/json" -d
+	'{
+		"screening_id": "00000000-0000-0000-0000-000000000000",
+		"name": "Joey B",
+		"email": "jb@example.com"
+	}'
+*/
+func JoinWaitlist(c *gin.Context) {
+	var request WaitlistRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		fmt.Println(err)
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	var screening schema.Screening
+	err := db.NewSelect().
+		Model(&screening).
+		Where("id = ?", request.ScreeningID).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Println("Screening not found")
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Error fetching screening: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	if !screening.Date.After(time.Now()) {
+		fmt.Println("Screening has already started")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	// The waitlist is only for sold-out screenings
+	available, err := countAvailableSeats(ctx, db, screening)
+	if err != nil {
+		fmt.Printf("Error counting available seats: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	if available > 0 {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"success": false, "error": "Seats are still available for this screening"})
+		return
+	}
+
+	// One entry per email per screening while it's waiting or offered a seat; expired and claimed entries can join again
+	exists, err := db.NewSelect().
+		Model((*schema.WaitlistEntry)(nil)).
+		Where("screening_id = ? AND lower(email) = lower(?)", request.ScreeningID, request.Email).
+		Where("status IN (?)", bun.In([]string{schema.WaitlistWaiting, schema.WaitlistOffered})).
+		Exists(ctx)
+	if err != nil {
+		fmt.Printf("Error checking waitlist: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	if exists {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"success": false, "error": "Email is already on the waitlist"})
+		return
+	}
+
+	entry := schema.WaitlistEntry{
+		ID:          uuid.New(),
+		ScreeningID: request.ScreeningID,
+		Name:        request.Name,
+		Email:       request.Email,
+		Date:        time.Now(),
+		Status:      schema.WaitlistWaiting,
+	}
+
+	_, err = db.NewInsert().
+		Model(&entry).
+		Exec(ctx)
+	if schema.IsUniqueViolation(err) {
+		// Joined from another request since we checked
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"success": false, "error": "Email is already on the waitlist"})
+		return
+	} else if err != nil {
+		fmt.Printf("Error adding waitlist entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	// Position counts everyone still waiting, including this entry
+	position, err := db.NewSelect().
+		Model((*schema.WaitlistEntry)(nil)).
+		Where("screening_id = ? AND status = ? AND date <= ?", entry.ScreeningID, schema.WaitlistWaiting, entry.Date).
+		Count(ctx)
+	if err != nil {
+		fmt.Printf("Error fetching waitlist position: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data": gin.H{
+			"id":       entry.ID,
+			"position": position,
+		},
+	})
+}
+
+/*
+Claims the seat offered to a waitlisted person and sends the usual reservation confirmation
+Raises error if the offer has expired or was already claimed
+
+	curl -X POST http://localhost:8080/api/waitlist/claim/CLAIM_TOKEN
+*/
+func ClaimWaitlistOffer(c *gin.Context) {
+	token := c.Param("token")
+	if token == "" {
+		fmt.Println("token path parameter is required")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	// Begin transaction
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	// Ensure rollback if error occurs
+	defer tx.Rollback()
+
+	var entry schema.WaitlistEntry
+	err = tx.NewSelect().
+		Model(&entry).
+		Where("claim_token_hash = ?", internal.HashToken(token)).
+		For("UPDATE").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Println("Waitlist offer not found")
+		c.AbortWithError(http.StatusNotFound, internal.ErrNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Error fetching waitlist offer: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	if entry.Status != schema.WaitlistOffered || !entry.OfferExpiresAt.After(time.Now()) {
+		c.AbortWithStatusJSON(http.StatusGone, gin.H{"success": false, "error": "Offer is no longer available"})
+		return
+	}
+
+	var screening schema.Screening
+	err = tx.NewSelect().
+		Model(&screening).
+		Relation("Movie").
+		Where("screening.id = ?", entry.ScreeningID).
+		Scan(ctx)
+	if err != nil {
+		fmt.Printf("Error loading screening details: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	res := schema.Reservation{
+		ID:          uuid.New(),
+		ScreeningID: entry.ScreeningID,
+		SeatNumber:  entry.OfferedSeat,
+		Date:        time.Now(),
+		Name:        entry.Name,
+		Email:       entry.Email,
+	}
+
+	_, err = tx.NewInsert().
+		Model(&res).
+		Exec(ctx)
+	if err != nil {
+		fmt.Printf("Error saving reservation: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	_, err = tx.NewUpdate().
+		Model((*schema.WaitlistEntry)(nil)).
+		Set("status = ?", schema.WaitlistClaimed).
+		Where("id = ?", entry.ID).
+		Exec(ctx)
+	if err != nil {
+		fmt.Printf("Error updating waitlist entry: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	data, err := newResEmailData(entry.Name, entry.Email, []schema.Reservation{res}, screening)
+	if err != nil {
+		fmt.Printf("Error preparing confirmation email: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	// Queue confirmation email; it's only sent if the reservation commits
+	if err := queueResConfirmationEmail(ctx, tx, data); err != nil {
+		fmt.Printf("Error queueing confirmation email: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": res})
+}
+
+/*
+Gets the waitlist for every screening of a movie, in the order seats will be offered
+
+	curl -X GET http://localhost:8080/api/waitlist/00000000-0000-0000-0000-000000000000 \
+	-H "Authorization: Bearer YOUR API KEY"
+*/
+func GetWaitlist(c *gin.Context) {
+	// Ensure movie_id is provided and is a valid UUID
+	param := c.Param("movie_id")
+	if param == "" {
+		fmt.Println("movie_id path parameter is required")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+	movieID, err := uuid.Parse(param)
+	if err != nil {
+		fmt.Println("movie_id must be a valid UUID")
+		c.AbortWithError(http.StatusBadRequest, internal.ErrBadRequest)
+		return
+	}
+
+	var entries []schema.WaitlistEntry
+	db := schema.GetDBConn()
+	ctx := context.Background()
+
+	err = db.NewSelect().
+		Model(&entries).
+		Relation("Screening").
+		Where("screening.movie_id = ?", movieID).
+		Order("screening.date ASC", "waitlist_entry.date ASC").
+		Scan(ctx)
+	if err != nil {
+		fmt.Printf("Error fetching waitlist: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, internal.ErrInternalServer)
+		return
+	}
+	if entries == nil {
+		entries = []schema.WaitlistEntry{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": entries})
+}
+
+// Expires lapsed waitlist offers and passes each seat on to the next person waiting
+func expireWaitlistOffers(ctx context.Context) error {
+	db := schema.GetDBConn()
+
+	var expired []schema.WaitlistEntry
+	err := db.NewSelect().
+		Model(&expired).
+		Where("status = ? AND offer_expires_at <= ?", schema.WaitlistOffered, time.Now()).
+		Scan(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch expired offers: %w", err)
+	}
+
+	for _, entry := range expired {
+		err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			// Skip offers another sweep or a late claim already handled
+			result, err := tx.NewUpdate().
+				Model((*schema.WaitlistEntry)(nil)).
+				Set("status = ?", schema.WaitlistExpired).
+				Where("id = ? AND status = ?", entry.ID, schema.WaitlistOffered).
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+			if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+				return nil
+			}
+
+			var screening schema.Screening
+			err = tx.NewSelect().
+				Model(&screening).
+				Relation("Movie").
+				Where("screening.id = ?", entry.ScreeningID).
+				Scan(ctx)
+			if err != nil {
+				return err
+			}
+
+			return offerSeat(ctx, tx, screening, entry.OfferedSeat)
+		})
+		if err != nil {
+			fmt.Printf("Error expiring waitlist offer %s: %v\n", entry.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// Periodically expires lapsed waitlist offers in the background
+func StartWaitlistSweeper() {
+	go func() {
+		ticker := time.NewTicker(waitlistSweepInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := expireWaitlistOffers(context.Background()); err != nil {
+				fmt.Printf("Error sweeping waitlist: %v\n", err)
+			}
+		}
+	}()
+}
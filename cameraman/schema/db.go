@@ -1,8 +1,8 @@
 package schema
 
 import (
-	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -49,78 +49,8 @@ func GetDBConn() *bun.DB {
 	return db
 }
 
-func CreateTables() {
-	db := GetDBConn()
-	ctx := context.Background()
-
-	// Create the Movie table
-	if _, err := db.NewCreateTable().
-		Model(&Movie{}).
-		IfNotExists().
-		Exec(ctx); err != nil {
-		log.Fatalf("Failed to create movie table: %v", err)
-	}
-
-	// Create the Reservation table with a foreign key to the Movie table
-	if _, err := db.NewCreateTable().
-		Model(&Reservation{}).
-		IfNotExists().
-		ForeignKey(`("movie_id") REFERENCES "movies"("id") ON DELETE CASCADE`).
-		Exec(ctx); err != nil {
-		log.Fatalf("Failed to create reservation table: %v", err)
-	}
-
-	// Create the Comment table
-	if _, err := db.NewCreateTable().
-		Model(&Comment{}).
-		IfNotExists().
-		Exec(ctx); err != nil {
-		log.Fatalf("Failed to create comment table: %v", err)
-	}
-
-	// Create the Calendar table
-	if _, err := db.NewCreateTable().
-		Model(&Calendar{}).
-		IfNotExists().
-		Exec(ctx); err != nil {
-		log.Fatalf("Failed to create comment table: %v", err)
-	}
-
-	// Create the Merchandise table
-	if _, err := db.NewCreateTable().
-		Model(&Merchandise{}).
-		IfNotExists().
-		Exec(ctx); err != nil {
-		log.Fatalf("Failed to create merchandise table: %v", err)
-	}
-
-	// Create the MerchandiseSize table
-	if _, err := db.NewCreateTable().
-		Model(&MerchandiseSize{}).
-		IfNotExists().
-		ForeignKey(`("merchandise_id") REFERENCES "merchandises"("id") ON DELETE CASCADE`).
-		Exec(ctx); err != nil {
-		log.Fatalf("Failed to create merchandise size table: %v", err)
-	}
-
-	// Create the Order table
-	if _, err := db.NewCreateTable().
-		Model(&Order{}).
-		IfNotExists().
-		Exec(ctx); err != nil {
-		log.Fatalf("Failed to create order table: %v", err)
-	}
-
-	// Create the OrderItem table with nullable foreign keys
-	if _, err := db.NewCreateTable().
-		Model(&OrderItem{}).
-		IfNotExists().
-		ForeignKey(`("order_id") REFERENCES "orders"("id") ON DELETE CASCADE`).
-		ForeignKey(`("merchandise_id") REFERENCES "merchandises"("id") ON DELETE SET NULL`).
-		ForeignKey(`("movie_id") REFERENCES "movies"("id") ON DELETE SET NULL`).
-		Exec(ctx); err != nil {
-		log.Fatalf("Failed to create order item table: %v", err)
-	}
-
-	log.Println("✅ Tables created successfully.")
+// Reports whether err was caused by a unique constraint, e.g. two reservations for the same seat
+func IsUniqueViolation(err error) bool {
+	var pgErr pgdriver.Error
+	return errors.As(err, &pgErr) && pgErr.Field('C') == "23505"
 }
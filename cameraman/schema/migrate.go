@@ -0,0 +1,107 @@
+package schema
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"log"
+
+	"github.com/uptrace/bun/migrate"
+)
+
+// Versioned SQL migrations, applied in order of their numeric prefix
+// Each migration has an up file and a down file, e.g. 0002_screenings.tx.up.sql and 0002_screenings.tx.down.sql
+// Files ending in .tx.up.sql / .tx.down.sql run inside a transaction
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+func newMigrator() (*migrate.Migrator, error) {
+	migrations := migrate.NewMigrations()
+	if err := migrations.Discover(migrationFiles); err != nil {
+		return nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	// Only record a migration as applied once it has run successfully
+	migrator := migrate.NewMigrator(GetDBConn(), migrations, migrate.WithMarkAppliedOnSuccess(true))
+	if err := migrator.Init(context.Background()); err != nil {
+		return nil, fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	return migrator, nil
+}
+
+// Applies each pending migration in its own group, so `migrate down` only ever rolls back one migration
+// Returns the groups that were applied, oldest first; empty if the database was already up to date
+func MigrateUp(ctx context.Context) ([]*migrate.MigrationGroup, error) {
+	migrator, err := newMigrator()
+	if err != nil {
+		return nil, err
+	}
+
+	// Prevent two instances from migrating at the same time
+	if err := migrator.Lock(ctx); err != nil {
+		return nil, err
+	}
+	defer migrator.Unlock(ctx)
+
+	migrations, err := migrator.MigrationsWithStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []*migrate.MigrationGroup
+	for _, pending := range migrations.Unapplied() {
+		single := migrate.NewMigrations()
+		single.Add(pending)
+
+		group, err := migrate.NewMigrator(GetDBConn(), single, migrate.WithMarkAppliedOnSuccess(true)).Migrate(ctx)
+		if err != nil {
+			return groups, fmt.Errorf("failed to apply %s: %w", pending, err)
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
+
+// Rolls back the most recently applied group of migrations
+// Returns the group that was rolled back; empty if there was nothing to roll back
+func MigrateDown(ctx context.Context) (*migrate.MigrationGroup, error) {
+	migrator, err := newMigrator()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrator.Lock(ctx); err != nil {
+		return nil, err
+	}
+	defer migrator.Unlock(ctx)
+
+	return migrator.Rollback(ctx)
+}
+
+// Returns every known migration; applied migrations have a non-zero ID and group
+func MigrationStatus(ctx context.Context) (migrate.MigrationSlice, error) {
+	migrator, err := newMigrator()
+	if err != nil {
+		return nil, err
+	}
+
+	return migrator.MigrationsWithStatus(ctx)
+}
+
+// Exits if the database has migrations that have not been applied yet
+// Called on startup so the server never runs against an outdated schema
+func CheckMigrations() {
+	migrations, err := MigrationStatus(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to check migrations: %v", err)
+	}
+
+	if pending := migrations.Unapplied(); len(pending) > 0 {
+		log.Fatalf("Database has %d pending migration(s) (%s); run `go run . migrate up` first", len(pending), pending)
+	}
+
+	log.Println("✅ Database schema is up to date.")
+}
@@ -0,0 +1,8 @@
+-- Rolling back the initial schema would drop every table along with all of
+-- the theater's data, so refuse; drop the tables by hand if that's really meant
+
+DO $$
+BEGIN
+	RAISE EXCEPTION 'refusing to roll back the initial schema: it would drop every table';
+END
+$$;
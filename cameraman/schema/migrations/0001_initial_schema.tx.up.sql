@@ -0,0 +1,98 @@
+-- Tables as they were created by CreateTables before migrations were versioned
+-- Every statement is idempotent so existing databases can adopt migrations in place
+
+CREATE TABLE IF NOT EXISTS "movies" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"title" VARCHAR NOT NULL,
+	"date" TIMESTAMPTZ NOT NULL,
+	"runtime" BIGINT NOT NULL,
+	"poster_url" VARCHAR,
+	"menu_url" VARCHAR,
+	PRIMARY KEY ("id"),
+	UNIQUE ("date")
+);
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "reservations" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"movie_id" uuid NOT NULL,
+	"seat_number" VARCHAR NOT NULL,
+	"date" TIMESTAMPTZ NOT NULL,
+	"name" VARCHAR NOT NULL,
+	"email" VARCHAR NOT NULL,
+	PRIMARY KEY ("id"),
+	FOREIGN KEY ("movie_id") REFERENCES "movies"("id") ON DELETE CASCADE
+);
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "comments" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"name" VARCHAR NOT NULL,
+	"email" VARCHAR NOT NULL,
+	"comment" VARCHAR NOT NULL,
+	"date" TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY ("id")
+);
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "calendars" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"start_date" TIMESTAMPTZ NOT NULL,
+	"end_date" TIMESTAMPTZ NOT NULL,
+	"image_url" VARCHAR NOT NULL,
+	"date" TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY ("id")
+);
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "merchandises" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"name" VARCHAR NOT NULL,
+	"description" VARCHAR,
+	"price" DOUBLE PRECISION NOT NULL,
+	"image_url" VARCHAR,
+	PRIMARY KEY ("id")
+);
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "merchandise_sizes" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"merchandise_id" uuid NOT NULL,
+	"size" VARCHAR NOT NULL,
+	"quantity" BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY ("id"),
+	FOREIGN KEY ("merchandise_id") REFERENCES "merchandises"("id") ON DELETE CASCADE
+);
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "orders" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"name" VARCHAR NOT NULL,
+	"email" VARCHAR NOT NULL,
+	"date" TIMESTAMPTZ NOT NULL,
+	"total" DOUBLE PRECISION NOT NULL,
+	"paid" BOOLEAN NOT NULL DEFAULT false,
+	PRIMARY KEY ("id")
+);
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "order_items" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"order_id" uuid NOT NULL,
+	"merchandise_id" uuid,
+	"movie_id" uuid,
+	"quantity" BIGINT NOT NULL,
+	"size" VARCHAR,
+	"price" DOUBLE PRECISION NOT NULL,
+	PRIMARY KEY ("id"),
+	FOREIGN KEY ("order_id") REFERENCES "orders"("id") ON DELETE CASCADE,
+	FOREIGN KEY ("merchandise_id") REFERENCES "merchandises"("id") ON DELETE SET NULL,
+	FOREIGN KEY ("movie_id") REFERENCES "movies"("id") ON DELETE SET NULL
+);
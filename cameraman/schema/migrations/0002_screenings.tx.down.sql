@@ -0,0 +1,62 @@
+-- Lossy: each movie keeps only its earliest screening, and reservations for
+-- any later screenings are dropped along with them. movies.date isn't made
+-- unique again, since two movies' first screenings may share a date
+
+-- Movies need a date again, so refuse while any movie has no screening
+-- rather than deleting it along with its posters and orders
+
+DO $$
+BEGIN
+	IF EXISTS (
+		SELECT 1 FROM "movies" AS m
+		WHERE NOT EXISTS (SELECT 1 FROM "screenings" AS s WHERE s."movie_id" = m."id")
+	) THEN
+		RAISE EXCEPTION 'refusing to roll back screenings: some movies have no screening to take their date from; schedule or delete them first';
+	END IF;
+END
+$$;
+
+--bun:split
+
+ALTER TABLE "movies" ADD COLUMN "date" TIMESTAMPTZ;
+
+--bun:split
+
+UPDATE "movies" AS m SET "date" = (
+	SELECT MIN(s."date") FROM "screenings" AS s WHERE s."movie_id" = m."id"
+);
+
+--bun:split
+
+ALTER TABLE "movies" ALTER COLUMN "date" SET NOT NULL;
+
+--bun:split
+
+ALTER TABLE "reservations" ADD COLUMN "movie_id" uuid;
+
+--bun:split
+
+UPDATE "reservations" AS r SET "movie_id" = s."movie_id"
+	FROM "screenings" AS s
+	JOIN "movies" AS m ON m."id" = s."movie_id" AND m."date" = s."date"
+	WHERE s."id" = r."screening_id";
+
+--bun:split
+
+DELETE FROM "reservations" WHERE "movie_id" IS NULL;
+
+--bun:split
+
+ALTER TABLE "reservations" ALTER COLUMN "movie_id" SET NOT NULL;
+
+--bun:split
+
+ALTER TABLE "reservations" DROP COLUMN "screening_id";
+
+--bun:split
+
+ALTER TABLE "reservations" ADD FOREIGN KEY ("movie_id") REFERENCES "movies"("id") ON DELETE CASCADE;
+
+--bun:split
+
+DROP TABLE "screenings";
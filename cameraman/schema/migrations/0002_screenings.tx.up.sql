@@ -0,0 +1,33 @@
+-- Splits screening dates off of movies so a movie can be screened more than once
+-- Each existing movie becomes a screening, and its reservations are moved onto that screening
+
+CREATE TABLE IF NOT EXISTS "screenings" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"movie_id" uuid NOT NULL,
+	"date" TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY ("id"),
+	FOREIGN KEY ("movie_id") REFERENCES "movies"("id") ON DELETE CASCADE
+);
+
+--bun:split
+
+-- Skipped on databases that were already split before migrations were versioned
+DO $$
+BEGIN
+	IF EXISTS (
+		SELECT 1 FROM information_schema.columns
+		WHERE table_name = 'movies' AND column_name = 'date'
+	) THEN
+		INSERT INTO "screenings" ("id", "movie_id", "date")
+			SELECT gen_random_uuid(), "id", "date" FROM "movies";
+
+		ALTER TABLE "reservations" ADD COLUMN "screening_id" uuid;
+		UPDATE "reservations" AS r SET "screening_id" = s."id"
+			FROM "screenings" AS s WHERE s."movie_id" = r."movie_id";
+		ALTER TABLE "reservations" ALTER COLUMN "screening_id" SET NOT NULL;
+		ALTER TABLE "reservations" DROP COLUMN "movie_id";
+		ALTER TABLE "reservations" ADD FOREIGN KEY ("screening_id") REFERENCES "screenings"("id") ON DELETE CASCADE;
+
+		ALTER TABLE "movies" DROP COLUMN "date";
+	END IF;
+END $$;
@@ -0,0 +1,9 @@
+ALTER TABLE "screenings" DROP COLUMN "seat_map_id";
+
+--bun:split
+
+DROP TABLE IF EXISTS "seats";
+
+--bun:split
+
+DROP TABLE IF EXISTS "seat_maps";
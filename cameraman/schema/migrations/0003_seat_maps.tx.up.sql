@@ -0,0 +1,61 @@
+-- Configurable seat maps replacing the hard-coded seat list
+-- The existing 25-seat theater layout becomes the default seat map for every screening
+
+CREATE TABLE IF NOT EXISTS "seat_maps" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"name" VARCHAR NOT NULL,
+	"is_default" BOOLEAN NOT NULL DEFAULT false,
+	PRIMARY KEY ("id"),
+	UNIQUE ("name")
+);
+
+--bun:split
+
+-- At most one default seat map
+CREATE UNIQUE INDEX IF NOT EXISTS "seat_maps_is_default_idx" ON "seat_maps" ("is_default") WHERE "is_default";
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "seats" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"seat_map_id" uuid NOT NULL,
+	"row" VARCHAR NOT NULL,
+	"label" VARCHAR NOT NULL,
+	"type" VARCHAR NOT NULL DEFAULT 'standard',
+	"x" BIGINT NOT NULL DEFAULT 0,
+	"y" BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY ("id"),
+	UNIQUE ("seat_map_id", "label"),
+	CHECK ("type" IN ('standard', 'accessible', 'blocked', 'staff')),
+	FOREIGN KEY ("seat_map_id") REFERENCES "seat_maps"("id") ON DELETE CASCADE
+);
+
+--bun:split
+
+INSERT INTO "seat_maps" ("name", "is_default") VALUES ('Golden Arm', true);
+
+--bun:split
+
+-- Rows A (front, 4 seats) through E (back, 7 seats)
+INSERT INTO "seats" ("seat_map_id", "row", "label", "x", "y")
+	SELECT m."id", r."row", r."row" || i, i - 1, r."y"
+	FROM "seat_maps" AS m
+	CROSS JOIN (VALUES ('A', 4, 0), ('B', 4, 1), ('C', 5, 2), ('D', 5, 3), ('E', 7, 4)) AS r("row", "count", "y")
+	CROSS JOIN LATERAL generate_series(1, r."count") AS i
+	WHERE m."is_default";
+
+--bun:split
+
+ALTER TABLE "screenings" ADD COLUMN "seat_map_id" uuid;
+
+--bun:split
+
+UPDATE "screenings" SET "seat_map_id" = (SELECT "id" FROM "seat_maps" WHERE "is_default");
+
+--bun:split
+
+ALTER TABLE "screenings" ALTER COLUMN "seat_map_id" SET NOT NULL;
+
+--bun:split
+
+ALTER TABLE "screenings" ADD FOREIGN KEY ("seat_map_id") REFERENCES "seat_maps"("id") ON DELETE RESTRICT;
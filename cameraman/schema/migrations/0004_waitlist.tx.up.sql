@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS "waitlist_entries" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"screening_id" uuid NOT NULL,
+	"name" VARCHAR NOT NULL,
+	"email" VARCHAR NOT NULL,
+	"date" TIMESTAMPTZ NOT NULL,
+	"status" VARCHAR NOT NULL DEFAULT 'waiting',
+	"offered_seat" VARCHAR,
+	"claim_token" VARCHAR,
+	"offer_expires_at" TIMESTAMPTZ,
+	PRIMARY KEY ("id"),
+	UNIQUE ("screening_id", "email"),
+	UNIQUE ("claim_token"),
+	CHECK ("status" IN ('waiting', 'offered', 'claimed', 'expired')),
+	FOREIGN KEY ("screening_id") REFERENCES "screenings"("id") ON DELETE CASCADE
+);
+
+--bun:split
+
+CREATE INDEX IF NOT EXISTS "waitlist_entries_screening_status_idx" ON "waitlist_entries" ("screening_id", "status", "date");
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS "reservations_screening_email_idx";
+DROP INDEX IF EXISTS "reservations_screening_seat_idx";
+
+--bun:split
+
+ALTER TABLE "reservations" DROP COLUMN IF EXISTS "guest_name";
+ALTER TABLE "reservations" DROP COLUMN IF EXISTS "group_id";
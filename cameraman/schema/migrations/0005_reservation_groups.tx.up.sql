@@ -0,0 +1,11 @@
+ALTER TABLE "reservations" ADD COLUMN IF NOT EXISTS "group_id" uuid;
+ALTER TABLE "reservations" ADD COLUMN IF NOT EXISTS "guest_name" VARCHAR;
+
+--bun:split
+
+-- Two requests can no longer book the same seat at the same time
+CREATE UNIQUE INDEX IF NOT EXISTS "reservations_screening_seat_idx" ON "reservations" ("screening_id", "seat_number");
+
+--bun:split
+
+CREATE INDEX IF NOT EXISTS "reservations_screening_email_idx" ON "reservations" ("screening_id", lower("email"));
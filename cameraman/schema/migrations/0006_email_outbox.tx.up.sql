@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS "outbox_emails" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"sender" VARCHAR NOT NULL,
+	"recipient" VARCHAR NOT NULL,
+	"subject" VARCHAR NOT NULL,
+	"body" TEXT NOT NULL,
+	"status" VARCHAR NOT NULL DEFAULT 'pending',
+	"attempts" BIGINT NOT NULL DEFAULT 0,
+	"next_attempt_at" TIMESTAMPTZ NOT NULL,
+	"last_error" VARCHAR,
+	"message_id" VARCHAR,
+	"created_at" TIMESTAMPTZ NOT NULL,
+	"sent_at" TIMESTAMPTZ,
+	PRIMARY KEY ("id"),
+	CHECK ("status" IN ('pending', 'sent', 'failed'))
+);
+
+--bun:split
+
+-- The worker only ever looks for pending emails that are due
+CREATE INDEX IF NOT EXISTS "outbox_emails_pending_idx" ON "outbox_emails" ("next_attempt_at") WHERE "status" = 'pending';
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS "sessions" (
+	"token_hash" VARCHAR NOT NULL,
+	"username" VARCHAR NOT NULL,
+	"created_at" TIMESTAMPTZ NOT NULL,
+	"expires_at" TIMESTAMPTZ NOT NULL,
+	"idle_timeout" BIGINT NOT NULL,
+	PRIMARY KEY ("token_hash")
+);
+
+--bun:split
+
+CREATE INDEX IF NOT EXISTS "sessions_username_idx" ON "sessions" ("username");
+
+--bun:split
+
+CREATE INDEX IF NOT EXISTS "sessions_expires_at_idx" ON "sessions" ("expires_at");
@@ -0,0 +1,6 @@
+-- Operator sessions mean nothing without operators
+DELETE FROM "sessions";
+
+--bun:split
+
+DROP TABLE IF EXISTS "operators";
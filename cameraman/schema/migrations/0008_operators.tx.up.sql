@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS "operators" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"email" VARCHAR NOT NULL,
+	"name" VARCHAR NOT NULL,
+	"role" VARCHAR NOT NULL,
+	"password_hash" VARCHAR,
+	"invite_token_hash" VARCHAR,
+	"invite_expires_at" TIMESTAMPTZ,
+	"created_at" TIMESTAMPTZ NOT NULL,
+	"disabled_at" TIMESTAMPTZ,
+	PRIMARY KEY ("id"),
+	UNIQUE ("invite_token_hash"),
+	CHECK ("role" IN ('admin', 'programmer', 'shop_manager'))
+);
+
+--bun:split
+
+-- Emails are compared case-insensitively when logging in
+CREATE UNIQUE INDEX IF NOT EXISTS "operators_email_idx" ON "operators" (lower("email"));
+
+--bun:split
+
+-- Sessions from the shared passkey belong to no operator
+DELETE FROM "sessions";
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS "audit_entries" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"actor_id" uuid,
+	"actor_name" VARCHAR NOT NULL,
+	"action" VARCHAR NOT NULL,
+	"entity_type" VARCHAR NOT NULL,
+	"entity_id" VARCHAR NOT NULL,
+	"before" jsonb,
+	"after" jsonb,
+	"ip" VARCHAR NOT NULL,
+	"date" TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY ("id")
+);
+
+--bun:split
+
+CREATE INDEX IF NOT EXISTS "audit_entries_date_idx" ON "audit_entries" ("date");
+
+--bun:split
+
+CREATE INDEX IF NOT EXISTS "audit_entries_entity_idx" ON "audit_entries" ("entity_type", "entity_id");
+
+--bun:split
+
+CREATE INDEX IF NOT EXISTS "audit_entries_actor_idx" ON "audit_entries" ("actor_id");
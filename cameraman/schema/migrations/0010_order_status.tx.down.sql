@@ -0,0 +1,18 @@
+DROP TABLE IF EXISTS "order_status_changes";
+
+--bun:split
+
+ALTER TABLE "orders" ADD COLUMN IF NOT EXISTS "paid" BOOLEAN NOT NULL DEFAULT false;
+
+--bun:split
+
+-- Cancelled orders were never paid; refunded ones were
+UPDATE "orders" SET "paid" = true WHERE "status" IN ('paid', 'ready', 'picked_up', 'refunded');
+
+--bun:split
+
+DROP INDEX IF EXISTS "orders_status_idx";
+
+--bun:split
+
+ALTER TABLE "orders" DROP COLUMN IF EXISTS "status";
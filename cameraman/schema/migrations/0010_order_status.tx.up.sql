@@ -0,0 +1,32 @@
+ALTER TABLE "orders" ADD COLUMN IF NOT EXISTS "status" VARCHAR NOT NULL DEFAULT 'pending'
+	CHECK ("status" IN ('pending', 'paid', 'ready', 'picked_up', 'cancelled', 'refunded'));
+
+--bun:split
+
+UPDATE "orders" SET "status" = 'paid' WHERE "paid";
+
+--bun:split
+
+ALTER TABLE "orders" DROP COLUMN IF EXISTS "paid";
+
+--bun:split
+
+CREATE INDEX IF NOT EXISTS "orders_status_idx" ON "orders" ("status", "date");
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "order_status_changes" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"order_id" uuid NOT NULL,
+	"from_status" VARCHAR NOT NULL,
+	"to_status" VARCHAR NOT NULL,
+	"actor_id" uuid,
+	"date" TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY ("id"),
+	FOREIGN KEY ("order_id") REFERENCES "orders"("id") ON DELETE CASCADE,
+	FOREIGN KEY ("actor_id") REFERENCES "operators"("id") ON DELETE SET NULL
+);
+
+--bun:split
+
+CREATE INDEX IF NOT EXISTS "order_status_changes_order_idx" ON "order_status_changes" ("order_id", "date");
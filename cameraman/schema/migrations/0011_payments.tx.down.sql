@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS "payment_events";
+
+--bun:split
+
+ALTER TABLE "orders" DROP COLUMN IF EXISTS "payment_id";
@@ -0,0 +1,12 @@
+ALTER TABLE "orders" ADD COLUMN IF NOT EXISTS "payment_id" VARCHAR UNIQUE;
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "payment_events" (
+	"id" VARCHAR NOT NULL,
+	"type" VARCHAR NOT NULL,
+	"order_id" uuid,
+	"date" TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY ("id"),
+	FOREIGN KEY ("order_id") REFERENCES "orders"("id") ON DELETE SET NULL
+);
@@ -0,0 +1,16 @@
+ALTER TABLE "orders" DROP COLUMN IF EXISTS "currency";
+
+--bun:split
+
+ALTER TABLE "orders" RENAME COLUMN "total_cents" TO "total";
+ALTER TABLE "orders" ALTER COLUMN "total" TYPE DOUBLE PRECISION USING "total" / 100.0;
+
+--bun:split
+
+ALTER TABLE "order_items" RENAME COLUMN "price_cents" TO "price";
+ALTER TABLE "order_items" ALTER COLUMN "price" TYPE DOUBLE PRECISION USING "price" / 100.0;
+
+--bun:split
+
+ALTER TABLE "merchandises" RENAME COLUMN "price_cents" TO "price";
+ALTER TABLE "merchandises" ALTER COLUMN "price" TYPE DOUBLE PRECISION USING "price" / 100.0;
@@ -0,0 +1,18 @@
+-- Prices were stored as floating-point dollars
+ALTER TABLE "merchandises" ALTER COLUMN "price" TYPE BIGINT USING round("price" * 100)::BIGINT;
+ALTER TABLE "merchandises" RENAME COLUMN "price" TO "price_cents";
+
+--bun:split
+
+ALTER TABLE "order_items" ALTER COLUMN "price" TYPE BIGINT USING round("price" * 100)::BIGINT;
+ALTER TABLE "order_items" RENAME COLUMN "price" TO "price_cents";
+
+--bun:split
+
+ALTER TABLE "orders" ALTER COLUMN "total" TYPE BIGINT USING round("total" * 100)::BIGINT;
+ALTER TABLE "orders" RENAME COLUMN "total" TO "total_cents";
+
+--bun:split
+
+-- Every existing order was in dollars
+ALTER TABLE "orders" ADD COLUMN IF NOT EXISTS "currency" VARCHAR NOT NULL DEFAULT 'USD';
@@ -0,0 +1,14 @@
+ALTER TABLE "order_items" DROP COLUMN IF EXISTS "discount_cents";
+
+--bun:split
+
+ALTER TABLE "orders" DROP COLUMN IF EXISTS "discount_cents";
+ALTER TABLE "orders" DROP COLUMN IF EXISTS "promo_code";
+
+--bun:split
+
+DROP TABLE IF EXISTS "promo_redemptions";
+
+--bun:split
+
+DROP TABLE IF EXISTS "promo_codes";
@@ -0,0 +1,58 @@
+CREATE TABLE IF NOT EXISTS "promo_codes" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"code" VARCHAR NOT NULL,
+	"description" VARCHAR,
+	"percent_off" BIGINT NOT NULL DEFAULT 0,
+	"amount_off_cents" BIGINT NOT NULL DEFAULT 0,
+	"scope" VARCHAR NOT NULL DEFAULT 'order',
+	"item_type" VARCHAR,
+	"merchandise_id" uuid,
+	"max_items" BIGINT NOT NULL DEFAULT 0,
+	"requires_item_type" VARCHAR,
+	"min_subtotal_cents" BIGINT NOT NULL DEFAULT 0,
+	"expires_at" TIMESTAMPTZ,
+	"max_uses" BIGINT NOT NULL DEFAULT 0,
+	"max_uses_per_email" BIGINT NOT NULL DEFAULT 0,
+	"created_at" TIMESTAMPTZ NOT NULL,
+	"disabled_at" TIMESTAMPTZ,
+	PRIMARY KEY ("id"),
+	CHECK ("scope" IN ('order', 'item')),
+	CHECK ("item_type" IN ('merchandise', 'poster')),
+	CHECK ("requires_item_type" IN ('merchandise', 'poster')),
+	-- Exactly one kind of discount
+	CHECK (("percent_off" BETWEEN 1 AND 100) <> ("amount_off_cents" > 0)),
+	FOREIGN KEY ("merchandise_id") REFERENCES "merchandises"("id") ON DELETE CASCADE
+);
+
+--bun:split
+
+-- Codes are entered case-insensitively
+CREATE UNIQUE INDEX IF NOT EXISTS "promo_codes_code_idx" ON "promo_codes" (upper("code"));
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "promo_redemptions" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"promo_code_id" uuid NOT NULL,
+	"order_id" uuid NOT NULL,
+	"email" VARCHAR NOT NULL,
+	"discount_cents" BIGINT NOT NULL,
+	"date" TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY ("id"),
+	UNIQUE ("order_id"),
+	FOREIGN KEY ("promo_code_id") REFERENCES "promo_codes"("id") ON DELETE CASCADE,
+	FOREIGN KEY ("order_id") REFERENCES "orders"("id") ON DELETE CASCADE
+);
+
+--bun:split
+
+CREATE INDEX IF NOT EXISTS "promo_redemptions_code_email_idx" ON "promo_redemptions" ("promo_code_id", lower("email"));
+
+--bun:split
+
+ALTER TABLE "orders" ADD COLUMN IF NOT EXISTS "promo_code" VARCHAR;
+ALTER TABLE "orders" ADD COLUMN IF NOT EXISTS "discount_cents" BIGINT NOT NULL DEFAULT 0;
+
+--bun:split
+
+ALTER TABLE "order_items" ADD COLUMN IF NOT EXISTS "discount_cents" BIGINT NOT NULL DEFAULT 0;
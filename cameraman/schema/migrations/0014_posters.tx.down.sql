@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS "poster_sizes";
+
+--bun:split
+
+DROP TABLE IF EXISTS "posters";
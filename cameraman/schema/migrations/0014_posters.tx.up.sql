@@ -0,0 +1,24 @@
+-- Posters used to be sold for every movie at a fixed price; now only posters we've printed are for sale
+
+CREATE TABLE IF NOT EXISTS "posters" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"movie_id" uuid NOT NULL,
+	"available" BOOLEAN NOT NULL DEFAULT true,
+	PRIMARY KEY ("id"),
+	UNIQUE ("movie_id"),
+	FOREIGN KEY ("movie_id") REFERENCES "movies"("id") ON DELETE CASCADE
+);
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "poster_sizes" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"poster_id" uuid NOT NULL,
+	"size" VARCHAR NOT NULL,
+	"price_cents" BIGINT NOT NULL,
+	"quantity" BIGINT NOT NULL DEFAULT 0,
+	"available" BOOLEAN NOT NULL DEFAULT true,
+	PRIMARY KEY ("id"),
+	UNIQUE ("poster_id", "size"),
+	FOREIGN KEY ("poster_id") REFERENCES "posters"("id") ON DELETE CASCADE
+);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS "stock_hold_items";
+
+--bun:split
+
+DROP TABLE IF EXISTS "stock_holds";
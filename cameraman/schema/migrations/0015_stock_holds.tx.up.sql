@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS "stock_holds" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"status" VARCHAR NOT NULL DEFAULT 'active',
+	"created_at" TIMESTAMPTZ NOT NULL,
+	"expires_at" TIMESTAMPTZ NOT NULL,
+	"order_id" uuid,
+	PRIMARY KEY ("id"),
+	FOREIGN KEY ("order_id") REFERENCES "orders"("id") ON DELETE SET NULL
+);
+
+--bun:split
+
+-- Availability only ever looks at active holds
+CREATE INDEX IF NOT EXISTS "stock_holds_active_idx" ON "stock_holds" ("expires_at") WHERE "status" = 'active';
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "stock_hold_items" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"hold_id" uuid NOT NULL,
+	"merchandise_id" uuid,
+	"movie_id" uuid,
+	"size" VARCHAR NOT NULL,
+	"quantity" BIGINT NOT NULL,
+	PRIMARY KEY ("id"),
+	CHECK (("merchandise_id" IS NULL) <> ("movie_id" IS NULL)),
+	FOREIGN KEY ("hold_id") REFERENCES "stock_holds"("id") ON DELETE CASCADE,
+	FOREIGN KEY ("merchandise_id") REFERENCES "merchandises"("id") ON DELETE CASCADE,
+	FOREIGN KEY ("movie_id") REFERENCES "movies"("id") ON DELETE CASCADE
+);
+
+--bun:split
+
+CREATE INDEX IF NOT EXISTS "stock_hold_items_hold_id_idx" ON "stock_hold_items" ("hold_id");
@@ -0,0 +1,52 @@
+-- Only variants of a lone "Size" option can go back to being sizes; other variants are lost
+
+CREATE TABLE IF NOT EXISTS "merchandise_sizes" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"merchandise_id" uuid NOT NULL,
+	"size" VARCHAR NOT NULL,
+	"quantity" BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY ("id"),
+	FOREIGN KEY ("merchandise_id") REFERENCES "merchandises"("id") ON DELETE CASCADE
+);
+
+--bun:split
+
+INSERT INTO "merchandise_sizes" ("merchandise_id", "size", "quantity")
+SELECT "merchandise_id", "options"->>'Size', "quantity"
+FROM "merchandise_variants"
+WHERE "options" ? 'Size' AND (SELECT count(*) FROM jsonb_object_keys("options")) = 1;
+
+--bun:split
+
+ALTER TABLE "stock_hold_items" DROP CONSTRAINT IF EXISTS "stock_hold_items_item_check";
+
+--bun:split
+
+ALTER TABLE "stock_hold_items" ADD COLUMN IF NOT EXISTS "merchandise_id" uuid REFERENCES "merchandises"("id") ON DELETE CASCADE;
+
+--bun:split
+
+UPDATE "stock_hold_items" AS h
+SET "merchandise_id" = v."merchandise_id"
+FROM "merchandise_variants" AS v
+WHERE v."id" = h."variant_id";
+
+--bun:split
+
+ALTER TABLE "stock_hold_items" DROP COLUMN IF EXISTS "variant_id";
+
+--bun:split
+
+ALTER TABLE "stock_hold_items" ADD CHECK (("merchandise_id" IS NULL) <> ("movie_id" IS NULL));
+
+--bun:split
+
+ALTER TABLE "order_items" DROP COLUMN IF EXISTS "variant_id";
+
+--bun:split
+
+DROP TABLE IF EXISTS "merchandise_variants";
+
+--bun:split
+
+DROP TABLE IF EXISTS "merchandise_options";
@@ -0,0 +1,92 @@
+-- Merchandise sizes become variants of a "Size" option, so items can vary by colour, style, and so on
+
+CREATE TABLE IF NOT EXISTS "merchandise_options" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"merchandise_id" uuid NOT NULL,
+	"name" VARCHAR NOT NULL,
+	"values" VARCHAR[] NOT NULL,
+	"position" BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY ("id"),
+	UNIQUE ("merchandise_id", "name"),
+	FOREIGN KEY ("merchandise_id") REFERENCES "merchandises"("id") ON DELETE CASCADE
+);
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "merchandise_variants" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"merchandise_id" uuid NOT NULL,
+	"sku" VARCHAR NOT NULL,
+	"options" JSONB NOT NULL DEFAULT '{}',
+	"price_cents" BIGINT,
+	"quantity" BIGINT NOT NULL DEFAULT 0,
+	"image_url" VARCHAR,
+	PRIMARY KEY ("id"),
+	UNIQUE ("sku"),
+	UNIQUE ("merchandise_id", "options"),
+	FOREIGN KEY ("merchandise_id") REFERENCES "merchandises"("id") ON DELETE CASCADE
+);
+
+--bun:split
+
+INSERT INTO "merchandise_options" ("merchandise_id", "name", "values")
+SELECT "merchandise_id", 'Size', array_agg("size" ORDER BY "size")
+FROM "merchandise_sizes"
+GROUP BY "merchandise_id";
+
+--bun:split
+
+INSERT INTO "merchandise_variants" ("merchandise_id", "sku", "options", "quantity")
+SELECT "merchandise_id", upper(left("merchandise_id"::text, 8) || '-' || "size"), jsonb_build_object('Size', "size"), "quantity"
+FROM "merchandise_sizes";
+
+--bun:split
+
+-- Items without sizes weren't stock-tracked; they get a single variant that's out of stock until its quantity is set
+INSERT INTO "merchandise_variants" ("merchandise_id", "sku", "options", "quantity")
+SELECT "id", upper(left("id"::text, 8)), '{}', 0
+FROM "merchandises" AS m
+WHERE NOT EXISTS (SELECT 1 FROM "merchandise_sizes" AS s WHERE s."merchandise_id" = m."id");
+
+--bun:split
+
+ALTER TABLE "order_items" ADD COLUMN IF NOT EXISTS "variant_id" uuid REFERENCES "merchandise_variants"("id") ON DELETE SET NULL;
+
+--bun:split
+
+-- Only sized items came out of inventory, so only they can be matched back to it
+UPDATE "order_items" AS oi
+SET "variant_id" = v."id"
+FROM "merchandise_variants" AS v
+WHERE v."merchandise_id" = oi."merchandise_id"
+	AND oi."size" <> ''
+	AND v."options" = jsonb_build_object('Size', oi."size");
+
+--bun:split
+
+ALTER TABLE "stock_hold_items" ADD COLUMN IF NOT EXISTS "variant_id" uuid REFERENCES "merchandise_variants"("id") ON DELETE CASCADE;
+
+--bun:split
+
+UPDATE "stock_hold_items" AS h
+SET "variant_id" = v."id"
+FROM "merchandise_variants" AS v
+WHERE v."merchandise_id" = h."merchandise_id"
+	AND v."options" = jsonb_build_object('Size', h."size");
+
+--bun:split
+
+-- Also drops the check that each item is either merchandise or a poster
+ALTER TABLE "stock_hold_items" DROP COLUMN IF EXISTS "merchandise_id";
+
+--bun:split
+
+DELETE FROM "stock_hold_items" WHERE "variant_id" IS NULL AND "movie_id" IS NULL;
+
+--bun:split
+
+ALTER TABLE "stock_hold_items" ADD CONSTRAINT "stock_hold_items_item_check" CHECK (("variant_id" IS NULL) <> ("movie_id" IS NULL));
+
+--bun:split
+
+DROP TABLE IF EXISTS "merchandise_sizes";
@@ -0,0 +1,9 @@
+ALTER TABLE "merchandise_variants" DROP COLUMN IF EXISTS "low_stock_threshold";
+
+--bun:split
+
+DROP TABLE IF EXISTS "inventory_movements";
+
+--bun:split
+
+DROP FUNCTION IF EXISTS "inventory_movements_append_only"();
@@ -0,0 +1,57 @@
+CREATE TABLE IF NOT EXISTS "inventory_movements" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"variant_id" uuid,
+	"poster_size_id" uuid,
+	"kind" VARCHAR NOT NULL,
+	"change" BIGINT NOT NULL,
+	"quantity_after" BIGINT NOT NULL,
+	"order_id" uuid,
+	"actor_id" uuid,
+	"actor_name" VARCHAR NOT NULL DEFAULT '',
+	"reason" VARCHAR NOT NULL DEFAULT '',
+	"date" TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY ("id"),
+	CHECK (("variant_id" IS NULL) <> ("poster_size_id" IS NULL))
+);
+
+--bun:split
+
+CREATE INDEX IF NOT EXISTS "inventory_movements_variant_idx" ON "inventory_movements" ("variant_id", "date") WHERE "variant_id" IS NOT NULL;
+
+--bun:split
+
+CREATE INDEX IF NOT EXISTS "inventory_movements_poster_size_idx" ON "inventory_movements" ("poster_size_id", "date") WHERE "poster_size_id" IS NOT NULL;
+
+--bun:split
+
+-- Movements outlive the variants and sizes they moved, so there are no foreign keys, and they can't be changed
+CREATE OR REPLACE FUNCTION "inventory_movements_append_only"() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'inventory movements are append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+--bun:split
+
+CREATE TRIGGER "inventory_movements_append_only"
+BEFORE UPDATE OR DELETE ON "inventory_movements"
+FOR EACH ROW EXECUTE FUNCTION "inventory_movements_append_only"();
+
+--bun:split
+
+-- Start the ledger from today's counts
+INSERT INTO "inventory_movements" ("variant_id", "kind", "change", "quantity_after", "reason", "date")
+SELECT "id", 'adjustment', "quantity", "quantity", 'Opening balance', now()
+FROM "merchandise_variants"
+WHERE "quantity" <> 0;
+
+--bun:split
+
+INSERT INTO "inventory_movements" ("poster_size_id", "kind", "change", "quantity_after", "reason", "date")
+SELECT "id", 'adjustment', "quantity", "quantity", 'Opening balance', now()
+FROM "poster_sizes"
+WHERE "quantity" <> 0;
+
+--bun:split
+
+ALTER TABLE "merchandise_variants" ADD COLUMN IF NOT EXISTS "low_stock_threshold" BIGINT NOT NULL DEFAULT 0;
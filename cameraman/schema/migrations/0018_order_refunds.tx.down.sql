@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS "order_refund_items";
+
+--bun:split
+
+DROP TABLE IF EXISTS "order_refunds";
+
+--bun:split
+
+ALTER TABLE "orders" DROP COLUMN IF EXISTS "refunded_cents";
@@ -0,0 +1,34 @@
+ALTER TABLE "orders" ADD COLUMN IF NOT EXISTS "refunded_cents" BIGINT NOT NULL DEFAULT 0;
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "order_refunds" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"order_id" uuid NOT NULL,
+	"amount_cents" BIGINT NOT NULL,
+	"reason" VARCHAR NOT NULL,
+	"restocked" BOOLEAN NOT NULL DEFAULT TRUE,
+	"actor_id" uuid,
+	"actor_name" VARCHAR NOT NULL DEFAULT '',
+	"date" TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY ("id"),
+	CHECK ("amount_cents" >= 0),
+	FOREIGN KEY ("order_id") REFERENCES "orders"("id") ON DELETE CASCADE
+);
+
+--bun:split
+
+CREATE INDEX IF NOT EXISTS "order_refunds_order_id_idx" ON "order_refunds" ("order_id");
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "order_refund_items" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"refund_id" uuid NOT NULL,
+	"order_item_id" uuid NOT NULL,
+	"quantity" BIGINT NOT NULL,
+	PRIMARY KEY ("id"),
+	CHECK ("quantity" > 0),
+	FOREIGN KEY ("refund_id") REFERENCES "order_refunds"("id") ON DELETE CASCADE,
+	FOREIGN KEY ("order_item_id") REFERENCES "order_items"("id") ON DELETE CASCADE
+);
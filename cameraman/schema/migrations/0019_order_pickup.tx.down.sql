@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS "order_fulfilments";
+
+--bun:split
+
+ALTER TABLE "orders" DROP COLUMN IF EXISTS "pickup_code";
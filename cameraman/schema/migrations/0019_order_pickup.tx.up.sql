@@ -0,0 +1,34 @@
+-- Existing orders get a code from their ID; new ones get a shorter random code
+ALTER TABLE "orders" ADD COLUMN IF NOT EXISTS "pickup_code" VARCHAR;
+
+--bun:split
+
+UPDATE "orders" SET "pickup_code" = upper(left(replace("id"::text, '-', ''), 8)) WHERE "pickup_code" IS NULL;
+
+--bun:split
+
+ALTER TABLE "orders" ALTER COLUMN "pickup_code" SET NOT NULL;
+
+--bun:split
+
+ALTER TABLE "orders" ADD CONSTRAINT "orders_pickup_code_key" UNIQUE ("pickup_code");
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS "order_fulfilments" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"order_id" uuid NOT NULL,
+	"order_item_id" uuid NOT NULL,
+	"quantity" BIGINT NOT NULL,
+	"actor_id" uuid,
+	"actor_name" VARCHAR NOT NULL DEFAULT '',
+	"date" TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY ("id"),
+	CHECK ("quantity" > 0),
+	FOREIGN KEY ("order_id") REFERENCES "orders"("id") ON DELETE CASCADE,
+	FOREIGN KEY ("order_item_id") REFERENCES "order_items"("id") ON DELETE CASCADE
+);
+
+--bun:split
+
+CREATE INDEX IF NOT EXISTS "order_fulfilments_order_id_idx" ON "order_fulfilments" ("order_id");
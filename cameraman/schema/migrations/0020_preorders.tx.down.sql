@@ -0,0 +1,21 @@
+ALTER TABLE "order_items" DROP COLUMN IF EXISTS "preorder";
+
+--bun:split
+
+ALTER TABLE "merchandises" DROP COLUMN IF EXISTS "preorder_status";
+
+--bun:split
+
+ALTER TABLE "merchandises" DROP COLUMN IF EXISTS "ship_date";
+
+--bun:split
+
+ALTER TABLE "merchandises" DROP COLUMN IF EXISTS "preorder_minimum";
+
+--bun:split
+
+ALTER TABLE "merchandises" DROP COLUMN IF EXISTS "preorder_closes_at";
+
+--bun:split
+
+ALTER TABLE "merchandises" DROP COLUMN IF EXISTS "preorder_opens_at";
@@ -0,0 +1,21 @@
+ALTER TABLE "merchandises" ADD COLUMN IF NOT EXISTS "preorder_opens_at" TIMESTAMPTZ;
+
+--bun:split
+
+ALTER TABLE "merchandises" ADD COLUMN IF NOT EXISTS "preorder_closes_at" TIMESTAMPTZ;
+
+--bun:split
+
+ALTER TABLE "merchandises" ADD COLUMN IF NOT EXISTS "preorder_minimum" BIGINT NOT NULL DEFAULT 0;
+
+--bun:split
+
+ALTER TABLE "merchandises" ADD COLUMN IF NOT EXISTS "ship_date" TIMESTAMPTZ;
+
+--bun:split
+
+ALTER TABLE "merchandises" ADD COLUMN IF NOT EXISTS "preorder_status" VARCHAR;
+
+--bun:split
+
+ALTER TABLE "order_items" ADD COLUMN IF NOT EXISTS "preorder" BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1 @@
+ALTER TABLE "outbox_emails" DROP COLUMN IF EXISTS "attachments";
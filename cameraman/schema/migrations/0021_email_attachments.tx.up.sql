@@ -0,0 +1 @@
+ALTER TABLE "outbox_emails" ADD COLUMN IF NOT EXISTS "attachments" JSONB;
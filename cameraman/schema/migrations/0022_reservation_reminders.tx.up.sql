@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS "reservation_reminders" (
+	"id" uuid NOT NULL DEFAULT gen_random_uuid(),
+	"reservation_id" uuid NOT NULL,
+	"before_minutes" BIGINT NOT NULL,
+	"sent_at" TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY ("id"),
+	UNIQUE ("reservation_id", "before_minutes"),
+	FOREIGN KEY ("reservation_id") REFERENCES "reservations"("id") ON DELETE CASCADE
+);
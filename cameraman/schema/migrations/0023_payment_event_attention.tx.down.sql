@@ -0,0 +1,9 @@
+ALTER TABLE "payment_events" DROP COLUMN IF EXISTS "attention";
+
+--bun:split
+
+ALTER TABLE "payment_events" DROP COLUMN IF EXISTS "amount_cents";
+
+--bun:split
+
+ALTER TABLE "payment_events" DROP COLUMN IF EXISTS "payment_id";
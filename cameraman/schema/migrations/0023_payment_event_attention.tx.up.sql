@@ -0,0 +1,9 @@
+ALTER TABLE "payment_events" ADD COLUMN IF NOT EXISTS "payment_id" VARCHAR;
+
+--bun:split
+
+ALTER TABLE "payment_events" ADD COLUMN IF NOT EXISTS "amount_cents" BIGINT;
+
+--bun:split
+
+ALTER TABLE "payment_events" ADD COLUMN IF NOT EXISTS "attention" VARCHAR;
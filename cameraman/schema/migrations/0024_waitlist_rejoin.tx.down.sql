@@ -0,0 +1,14 @@
+-- Lossy: only each email's latest entry per screening is kept
+
+DROP INDEX IF EXISTS "waitlist_entries_active_email_idx";
+
+--bun:split
+
+DELETE FROM "waitlist_entries" AS w WHERE EXISTS (
+	SELECT 1 FROM "waitlist_entries" AS o
+	WHERE o."screening_id" = w."screening_id" AND o."email" = w."email" AND (o."date", o."id") > (w."date", w."id")
+);
+
+--bun:split
+
+ALTER TABLE "waitlist_entries" ADD UNIQUE ("screening_id", "email");
@@ -0,0 +1,9 @@
+-- Someone whose offer expired, or who claimed a seat and cancelled it, can join the waitlist again;
+-- only one waiting or offered entry per email (in any case) per screening
+
+ALTER TABLE "waitlist_entries" DROP CONSTRAINT IF EXISTS "waitlist_entries_screening_id_email_key";
+
+--bun:split
+
+CREATE UNIQUE INDEX IF NOT EXISTS "waitlist_entries_active_email_idx" ON "waitlist_entries" ("screening_id", lower("email"))
+	WHERE "status" IN ('waiting', 'offered');
@@ -0,0 +1,4 @@
+-- Hashes can't be turned back into tokens, so claim links already emailed stop working;
+-- their offers pass to the next person once they expire
+
+ALTER TABLE "waitlist_entries" RENAME COLUMN "claim_token_hash" TO "claim_token";
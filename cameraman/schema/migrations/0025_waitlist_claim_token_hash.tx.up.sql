@@ -0,0 +1,8 @@
+-- Claim tokens are stored hashed, like operator invite tokens, so the table can't be used to claim seats
+
+ALTER TABLE "waitlist_entries" RENAME COLUMN "claim_token" TO "claim_token_hash";
+
+--bun:split
+
+UPDATE "waitlist_entries" SET "claim_token_hash" = encode(sha256(convert_to("claim_token_hash", 'UTF8')), 'hex')
+WHERE "claim_token_hash" IS NOT NULL;
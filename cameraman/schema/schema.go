@@ -1,32 +1,113 @@
 package schema
 
 import (
+	"golden-arm/mailer"
+	"golden-arm/money"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// Film metadata; when the film is shown is tracked by its screenings
 type Movie struct {
 	ID      uuid.UUID `bun:"type:uuid,pk,default:gen_random_uuid()"`
 	Title   string    `bun:"title,notnull"`
-	Date    time.Time `bun:"date,notnull,unique"` // Date of movie screening
-	Runtime int       `bun:"runtime,notnull"`     // Movie runtime in minutes
+	Runtime int       `bun:"runtime,notnull"` // Movie runtime in minutes
 	// Public URLs to images stored in AWS S3
 	PosterURL string `bun:"poster_url"`
 	MenuURL   string `bun:"menu_url"`
+
+	Screenings []*Screening `bun:"rel:has-many,join:id=movie_id"`
+}
+
+// A single showing of a movie; a movie can be screened any number of times
+type Screening struct {
+	ID        uuid.UUID `bun:"type:uuid,pk,default:gen_random_uuid()"`
+	MovieID   uuid.UUID `bun:"type:uuid,notnull"`
+	SeatMapID uuid.UUID `bun:"type:uuid,notnull"` // Seating layout used for this screening
+	Date      time.Time `bun:"date,notnull"`      // Date and time of the screening
+
+	// Foreign key relations
+	Movie   *Movie   `bun:"rel:belongs-to,join:movie_id=id"`
+	SeatMap *SeatMap `bun:"rel:belongs-to,join:seat_map_id=id"`
+}
+
+// Seat types
+const (
+	SeatStandard   = "standard"
+	SeatAccessible = "accessible"
+	SeatBlocked    = "blocked" // Cannot be reserved, e.g. where the projector sits
+	SeatStaff      = "staff"   // Can only be reserved by admins and programmers
+)
+
+// A seating layout, e.g. the usual theater arrangement or an outdoor screening
+type SeatMap struct {
+	ID        uuid.UUID `bun:"type:uuid,pk,default:gen_random_uuid()"`
+	Name      string    `bun:"name,notnull,unique"`
+	IsDefault bool      `bun:"is_default,notnull,default:false"` // Used for new screenings that don't specify a seat map
+
+	Seats []*Seat `bun:"rel:has-many,join:id=seat_map_id"`
+}
+
+// A seat in a seat map
+type Seat struct {
+	ID        uuid.UUID `bun:"type:uuid,pk,default:gen_random_uuid()"`
+	SeatMapID uuid.UUID `bun:"type:uuid,notnull"`
+	Row       string    `bun:"row,notnull"`                     // e.g. A, B, ...
+	Label     string    `bun:"label,notnull"`                   // e.g. A1, A2, ...; unique within a seat map
+	Type      string    `bun:"type,notnull,default:'standard'"` // One of the seat types above
+	// Layout coordinates in seat-sized grid units; x increases left to right, y increases away from the screen
+	X int `bun:"x,notnull,default:0"`
+	Y int `bun:"y,notnull,default:0"`
 }
 
 type Reservation struct {
-	ID         uuid.UUID `bun:"type:uuid,pk,default:gen_random_uuid()"`
-	MovieID    uuid.UUID `bun:"type:uuid,notnull"`
-	SeatNumber string    `bun:"seat_number,notnull"` // e.g. A1, A2, ...
-	Date       time.Time `bun:"date,notnull"`        // When the reservation was made
+	ID          uuid.UUID `bun:"type:uuid,pk,default:gen_random_uuid()"`
+	ScreeningID uuid.UUID `bun:"type:uuid,notnull"`
+	SeatNumber  string    `bun:"seat_number,notnull"` // e.g. A1, A2, ...
+	Date        time.Time `bun:"date,notnull"`        // When the reservation was made
 	// Movie-goer information
 	Name  string `bun:"name,notnull"`
 	Email string `bun:"email,notnull"`
+	// Seats booked together share a group; e.g. a party of four
+	GroupID   uuid.UUID `bun:"type:uuid,nullzero"`
+	GuestName string    `bun:"guest_name,nullzero"` // Who sits in the seat, if not the person who booked it
+
+	// Foreign key relation to Screening
+	Screening *Screening `bun:"rel:belongs-to,join:screening_id=id"`
+}
+
+// A reminder sent for a reservation ahead of its screening; one per reservation for each reminder time
+type ReservationReminder struct {
+	ID            uuid.UUID `bun:"type:uuid,pk,default:gen_random_uuid()"`
+	ReservationID uuid.UUID `bun:"type:uuid,notnull"`
+	BeforeMinutes int       `bun:"before_minutes,notnull"` // How long before the screening, e.g. 120; unique per reservation
+	SentAt        time.Time `bun:"sent_at,notnull"`        // When it was queued; skipped reminders are recorded too
+}
+
+// Waitlist entry statuses
+const (
+	WaitlistWaiting = "waiting"
+	WaitlistOffered = "offered" // A freed seat is held for this person until the offer expires
+	WaitlistClaimed = "claimed" // The offered seat was reserved
+	WaitlistExpired = "expired" // The offer lapsed without being claimed
+)
+
+// A person waiting for a seat at a sold-out screening; served first come, first served
+type WaitlistEntry struct {
+	ID          uuid.UUID `bun:"type:uuid,pk,default:gen_random_uuid()"`
+	ScreeningID uuid.UUID `bun:"type:uuid,notnull"`
+	Name        string    `bun:"name,notnull"`
+	Email       string    `bun:"email,notnull"` // One waiting or offered entry per email per screening
+	Date        time.Time `bun:"date,notnull"`  // When the person joined the waitlist
+	Status      string    `bun:"status,notnull,default:'waiting'"`
+	// Set once a seat has been offered
+	OfferedSeat    string     `bun:"offered_seat,nullzero"`
+	ClaimTokenHash string     `bun:"claim_token_hash,nullzero,unique" json:"-"` // Of the secret in the emailed claim link
+	OfferExpiresAt *time.Time `bun:"offer_expires_at"`
 
-	// Foreign key relation to Movie
-	Movie Movie `bun:"rel:belongs-to,join:movie_id=id"`
+	// Foreign key relation to Screening
+	Screening *Screening `bun:"rel:belongs-to,join:screening_id=id"`
 }
 
 // Feedback from movie-goers; e.g. suggestion for future screening
@@ -49,46 +130,351 @@ type Calendar struct {
 
 // A merchandise item available for purchase (e.g. t-shirts)
 type Merchandise struct {
-	ID          uuid.UUID `bun:"type:uuid,pk,default:gen_random_uuid()"`
-	Name        string    `bun:"name,notnull"`
-	Description string    `bun:"description"`
-	Price       float64   `bun:"price,notnull"`
-	ImageURL    string    `bun:"image_url"`
+	ID          uuid.UUID   `bun:"type:uuid,pk,default:gen_random_uuid()"`
+	Name        string      `bun:"name,notnull"`
+	Description string      `bun:"description"`
+	Price       money.Money `bun:"price_cents,notnull"` // In the shop's currency
+	ImageURL    string      `bun:"image_url"`
+
+	// Pre-order mode: while the window is open, orders are taken beyond stock and printed once it closes
+	PreorderOpensAt  *time.Time `bun:"preorder_opens_at"`                  // Open straight away if not set
+	PreorderClosesAt *time.Time `bun:"preorder_closes_at"`                 // Not a pre-order item if not set
+	PreorderMinimum  int        `bun:"preorder_minimum,notnull,default:0"` // Units needed to go ahead with printing; 0 for no minimum
+	ShipDate         *time.Time `bun:"ship_date"`                          // Estimated date pre-orders are ready
+	PreorderStatus   string     `bun:"preorder_status,nullzero"`           // Set once the window closes
 }
 
-// An available size for a merchandise item
-type MerchandiseSize struct {
+// What happens to a merchandise item's pre-orders once its window closes
+const (
+	PreorderPrinting      = "printing"
+	PreorderMinimumNotMet = "minimum_not_met" // Pre-orders are refunded, or cancelled if unpaid
+)
+
+// A way a merchandise item varies, e.g. "Colour" with values "Red" and "Blue"
+type MerchandiseOption struct {
 	ID            uuid.UUID `bun:"type:uuid,pk,default:gen_random_uuid()"`
 	MerchandiseID uuid.UUID `bun:"type:uuid,notnull"`
-	Size          string    `bun:"size,notnull"`               // e.g. "S", "M", "L", "XL"
-	Quantity      int       `bun:"quantity,notnull,default:0"` // To track inventory count
+	Name          string    `bun:"name,notnull"`         // e.g. "Size", "Colour", "Style"
+	Values        []string  `bun:"values,array,notnull"` // In the order they're shown
+	Position      int       `bun:"position,notnull,default:0"`
+}
+
+// A purchasable combination of a merchandise item's options, e.g. a red shirt in M, with its own stock
+// An item without options has a single variant with no options
+type MerchandiseVariant struct {
+	ID            uuid.UUID         `bun:"type:uuid,pk,default:gen_random_uuid()"`
+	MerchandiseID uuid.UUID         `bun:"type:uuid,notnull"`
+	SKU           string            `bun:"sku,notnull,unique"`
+	Options       map[string]string `bun:"options,type:jsonb,notnull"` // Option name to value, one for each of the item's options
+	Price         money.Money       `bun:"price_cents,nullzero"`       // Overrides the item's price if set
+	Quantity      int               `bun:"quantity,notnull,default:0"` // To track inventory count; only changed through the inventory ledger
+	ImageURL      string            `bun:"image_url,nullzero"`         // Overrides the item's image if set
+
+	LowStockThreshold int `bun:"low_stock_threshold,notnull,default:0"` // Emails REPLYTO when stock falls to this; 0 for no alert
+
+	// Foreign key relation
+	Merchandise *Merchandise `bun:"rel:belongs-to,join:merchandise_id=id"`
+}
+
+// A movie's poster, sold in the shop while it's available
+type Poster struct {
+	ID        uuid.UUID `bun:"type:uuid,pk,default:gen_random_uuid()"`
+	MovieID   uuid.UUID `bun:"type:uuid,notnull,unique"` // One poster per movie
+	Available bool      `bun:"available,notnull"`
+
+	// Foreign key relations
+	Movie *Movie       `bun:"rel:belongs-to,join:movie_id=id"`
+	Sizes []PosterSize `bun:"rel:has-many,join:id=poster_id"`
+}
+
+// A printed size of a poster, with its own price and inventory
+type PosterSize struct {
+	ID        uuid.UUID   `bun:"type:uuid,pk,default:gen_random_uuid()"`
+	PosterID  uuid.UUID   `bun:"type:uuid,notnull"`
+	Size      string      `bun:"size,notnull"`        // e.g. "11x17", "24x36"
+	Price     money.Money `bun:"price_cents,notnull"` // In the shop's currency
+	Quantity  int         `bun:"quantity,notnull,default:0"`
+	Available bool        `bun:"available,notnull"`
+}
+
+// Stock hold statuses
+const (
+	HoldActive    = "active"    // The items are held until the hold expires
+	HoldConverted = "converted" // The items were ordered
+	HoldReleased  = "released"  // The shopper emptied their cart
+	HoldExpired   = "expired"   // The hold lapsed and the items went back on sale
+)
+
+// Stock set aside for a shopper's cart for a few minutes while they check out
+// Held items are never taken out of inventory; they're subtracted from what's shown as available
+type StockHold struct {
+	ID        uuid.UUID `bun:"type:uuid,pk,default:gen_random_uuid()"`
+	Status    string    `bun:"status,notnull,default:'active'"`
+	CreatedAt time.Time `bun:"created_at,notnull"`
+	ExpiresAt time.Time `bun:"expires_at,notnull"`
+	OrderID   uuid.UUID `bun:"type:uuid,nullzero"` // Set once converted
 
 	// Foreign key relation
-	Merchandise Merchandise `bun:"rel:belongs-to,join:merchandise_id=id"`
+	Items []StockHoldItem `bun:"rel:has-many,join:id=hold_id"`
+}
+
+// Inventory movement kinds
+const (
+	MovementSale       = "sale"
+	MovementRestock    = "restock"
+	MovementAdjustment = "adjustment" // e.g. a stock count, or damaged stock
+	MovementReturn     = "return"     // Stock back from a cancelled, refunded, or deleted order
+)
+
+// A change to a merchandise variant's or poster size's stock; the ledger is append-only, so the sum of a
+// variant's or size's changes should always equal its quantity
+type InventoryMovement struct {
+	ID            uuid.UUID  `bun:"type:uuid,pk,default:gen_random_uuid()"`
+	VariantID     *uuid.UUID `bun:"type:uuid"`
+	PosterSizeID  *uuid.UUID `bun:"type:uuid"`
+	Kind          string     `bun:"kind,notnull"`
+	Change        int        `bun:"change,notnull"`         // Negative when stock goes out
+	QuantityAfter int        `bun:"quantity_after,notnull"` // The variant's or size's quantity once changed
+	OrderID       uuid.UUID  `bun:"type:uuid,nullzero"`     // For sales and returns
+	ActorID       uuid.UUID  `bun:"type:uuid,nullzero"`     // Unset for the API key, customers, and automatic changes
+	ActorName     string     `bun:"actor_name,notnull"`
+	Reason        string     `bun:"reason,notnull"`
+	Date          time.Time  `bun:"date,notnull"`
+}
+
+// A held quantity of a merchandise variant or poster size
+type StockHoldItem struct {
+	ID        uuid.UUID  `bun:"type:uuid,pk,default:gen_random_uuid()"`
+	HoldID    uuid.UUID  `bun:"type:uuid,notnull"`
+	VariantID *uuid.UUID `bun:"type:uuid"`
+	MovieID   *uuid.UUID `bun:"type:uuid"` // For the movie's poster
+	Size      string     `bun:"size,notnull"`
+	Quantity  int        `bun:"quantity,notnull"`
 }
 
 // An individual item in a customer's order
 type OrderItem struct {
-	ID            uuid.UUID  `bun:"type:uuid,pk,default:gen_random_uuid()"`
-	OrderID       uuid.UUID  `bun:"type:uuid,notnull"`
-	MerchandiseID *uuid.UUID `bun:"type:uuid"` // Can be null for movie posters
-	MovieID       *uuid.UUID `bun:"type:uuid"` // Can be null for regular merchandise
-	Quantity      int        `bun:"quantity,notnull"`
-	Size          string     `bun:"size"`          // Can be null for non-apparel items
-	Price         float64    `bun:"price,notnull"` // Price at time of purchase
+	ID            uuid.UUID   `bun:"type:uuid,pk,default:gen_random_uuid()"`
+	OrderID       uuid.UUID   `bun:"type:uuid,notnull"`
+	MerchandiseID *uuid.UUID  `bun:"type:uuid"` // Can be null for movie posters
+	VariantID     *uuid.UUID  `bun:"type:uuid"` // Which variant of the merchandise
+	MovieID       *uuid.UUID  `bun:"type:uuid"` // Can be null for regular merchandise
+	Quantity      int         `bun:"quantity,notnull"`
+	Size          string      `bun:"size"`                             // Poster size, or the merchandise variant's options, e.g. "Red / M"
+	Price         money.Money `bun:"price_cents,notnull"`              // Price at time of purchase, in the order's currency
+	Discount      money.Money `bun:"discount_cents,notnull,default:0"` // Taken off the whole line by an item promo code
+	Preorder      bool        `bun:"preorder,notnull"`                 // Ordered beyond stock while the item was on pre-order
 
 	// Foreign key relations
-	Order       Order        `bun:"rel:belongs-to,join:order_id=id"`
-	Merchandise *Merchandise `bun:"rel:belongs-to,join:merchandise_id=id"`
-	Movie       *Movie       `bun:"rel:belongs-to,join:movie_id=id"`
+	Order       Order               `bun:"rel:belongs-to,join:order_id=id"`
+	Merchandise *Merchandise        `bun:"rel:belongs-to,join:merchandise_id=id"`
+	Variant     *MerchandiseVariant `bun:"rel:belongs-to,join:variant_id=id"`
+	Movie       *Movie              `bun:"rel:belongs-to,join:movie_id=id"`
 }
 
+// Order statuses; an order moves pending -> paid -> ready -> picked_up, and can be cancelled before payment
+// or refunded after it
+const (
+	OrderPending   = "pending" // Waiting for payment
+	OrderPaid      = "paid"
+	OrderReady     = "ready" // Packed and waiting at the next screening
+	OrderPickedUp  = "picked_up"
+	OrderCancelled = "cancelled"
+	OrderRefunded  = "refunded"
+)
+
 // A customer's order
 type Order struct {
-	ID    uuid.UUID `bun:"type:uuid,pk,default:gen_random_uuid()"`
-	Name  string    `bun:"name,notnull"`
-	Email string    `bun:"email,notnull"`
-	Date  time.Time `bun:"date,notnull"`
-	Total float64   `bun:"total,notnull"`              // Total cost of the order
-	Paid  bool      `bun:"paid,notnull,default:false"` // True if order is complete and payment has been received
+	ID       uuid.UUID   `bun:"type:uuid,pk,default:gen_random_uuid()"`
+	Name     string      `bun:"name,notnull"`
+	Email    string      `bun:"email,notnull"`
+	Date     time.Time   `bun:"date,notnull"`
+	Total    money.Money `bun:"total_cents,notnull"` // Total cost of the order, after any discount
+	Currency string      `bun:"currency,notnull,default:'USD'"`
+	Status   string      `bun:"status,notnull,default:'pending'"`
+	// Promo code used, and how much it took off the order in total
+	PromoCode string      `bun:"promo_code,nullzero"`
+	Discount  money.Money `bun:"discount_cents,notnull,default:0"`
+	// Payment provider's ID for the payment, set once paid online; used to match refunds to the order
+	PaymentID string `bun:"payment_id,nullzero,unique"`
+	// Refunded so far for individual items; Total stays as ordered, so what the customer paid in the end is Total - Refunded
+	Refunded money.Money `bun:"refunded_cents,notnull,default:0"`
+	// Short code the customer shows at pickup, e.g. "K7PX3M"
+	PickupCode string `bun:"pickup_code,notnull,unique"`
+}
+
+// What a promo code discounts
+const (
+	PromoScopeOrder = "order" // The order's subtotal
+	PromoScopeItem  = "item"  // Each matching item, e.g. "free poster with any shirt"
+)
+
+// Kinds of order item, for targeting promo codes
+const (
+	ItemMerchandise = "merchandise"
+	ItemPoster      = "poster"
+)
+
+// A code customers enter at checkout for a discount; takes either a percentage or a fixed amount off
+type PromoCode struct {
+	ID          uuid.UUID   `bun:"type:uuid,pk,default:gen_random_uuid()"`
+	Code        string      `bun:"code,notnull"` // Case-insensitive, e.g. ELIOT10
+	Description string      `bun:"description"`
+	PercentOff  int         `bun:"percent_off,notnull,default:0"`
+	AmountOff   money.Money `bun:"amount_off_cents,notnull,default:0"`
+	Scope       string      `bun:"scope,notnull,default:'order'"`
+	// Item scope: which items are discounted; unset matches every item
+	ItemType      string    `bun:"item_type,nullzero"` // ItemMerchandise or ItemPoster
+	MerchandiseID uuid.UUID `bun:"type:uuid,nullzero"`
+	MaxItems      int       `bun:"max_items,notnull,default:0"` // Most units discounted per order; 0 for no limit
+	// Conditions the order must meet
+	RequiresItemType string      `bun:"requires_item_type,nullzero"` // e.g. a shirt must be ordered to get the poster free
+	MinSubtotal      money.Money `bun:"min_subtotal_cents,notnull,default:0"`
+	// Limits; 0 for no limit
+	ExpiresAt       *time.Time `bun:"expires_at"`
+	MaxUses         int        `bun:"max_uses,notnull,default:0"`
+	MaxUsesPerEmail int        `bun:"max_uses_per_email,notnull,default:0"`
+	CreatedAt       time.Time  `bun:"created_at,notnull"`
+	DisabledAt      *time.Time `bun:"disabled_at"`
+}
+
+// A use of a promo code by an order; uses by cancelled orders don't count towards limits
+type PromoRedemption struct {
+	ID          uuid.UUID   `bun:"type:uuid,pk,default:gen_random_uuid()"`
+	PromoCodeID uuid.UUID   `bun:"type:uuid,notnull"`
+	OrderID     uuid.UUID   `bun:"type:uuid,notnull,unique"`
+	Email       string      `bun:"email,notnull"`
+	Discount    money.Money `bun:"discount_cents,notnull"`
+	Date        time.Time   `bun:"date,notnull"`
+}
+
+// A payment provider webhook event that has been handled; providers may deliver the same event more than once
+type PaymentEvent struct {
+	ID      string    `bun:"id,pk"` // Provider's event ID
+	Type    string    `bun:"type,notnull"`
+	OrderID uuid.UUID `bun:"type:uuid,nullzero"`
+	Date    time.Time `bun:"date,notnull"` // When the event was received
+
+	PaymentID string      `bun:"payment_id,nullzero"`
+	Amount    money.Money `bun:"amount_cents,nullzero"` // Paid or refunded
+	Attention string      `bun:"attention,nullzero"`    // Why an operator needs to sort the event out by hand, e.g. an order paid after it was cancelled
+}
+
+// A change in an order's status; together these are the order's history
+type OrderStatusChange struct {
+	ID         uuid.UUID `bun:"type:uuid,pk,default:gen_random_uuid()"`
+	OrderID    uuid.UUID `bun:"type:uuid,notnull"`
+	FromStatus string    `bun:"from_status,notnull"`
+	ToStatus   string    `bun:"to_status,notnull"`
+	ActorID    uuid.UUID `bun:"type:uuid,nullzero"` // Operator who made the change; null when it was automatic
+	Date       time.Time `bun:"date,notnull"`
+}
+
+// A refund of some of an order's items; the order and its items are left as they were ordered
+type OrderRefund struct {
+	ID        uuid.UUID   `bun:"type:uuid,pk,default:gen_random_uuid()"`
+	OrderID   uuid.UUID   `bun:"type:uuid,notnull"`
+	Amount    money.Money `bun:"amount_cents,notnull"`
+	Reason    string      `bun:"reason,notnull"`
+	Restocked bool        `bun:"restocked,notnull"`  // Whether the items went back into inventory
+	ActorID   uuid.UUID   `bun:"type:uuid,nullzero"` // Unset for the API key
+	ActorName string      `bun:"actor_name,notnull"`
+	Date      time.Time   `bun:"date,notnull"`
+
+	Items []OrderRefundItem `bun:"rel:has-many,join:id=refund_id"`
+}
+
+// A quantity of one order item that was refunded
+type OrderRefundItem struct {
+	ID          uuid.UUID `bun:"type:uuid,pk,default:gen_random_uuid()"`
+	RefundID    uuid.UUID `bun:"type:uuid,notnull"`
+	OrderItemID uuid.UUID `bun:"type:uuid,notnull"`
+	Quantity    int       `bun:"quantity,notnull"`
+}
+
+// A quantity of one order item handed to the customer at pickup
+type OrderFulfilment struct {
+	ID          uuid.UUID `bun:"type:uuid,pk,default:gen_random_uuid()"`
+	OrderID     uuid.UUID `bun:"type:uuid,notnull"`
+	OrderItemID uuid.UUID `bun:"type:uuid,notnull"`
+	Quantity    int       `bun:"quantity,notnull"`
+	ActorID     uuid.UUID `bun:"type:uuid,nullzero"` // Unset for the API key
+	ActorName   string    `bun:"actor_name,notnull"`
+	Date        time.Time `bun:"date,notnull"`
+}
+
+// Outbox email statuses
+const (
+	EmailPending = "pending" // Waiting to be sent, possibly after a failed attempt
+	EmailSent    = "sent"
+	EmailFailed  = "failed" // Dead-lettered after too many attempts; admins can re-send it
+)
+
+// An email written in the same transaction as the change it announces, then sent by a background worker
+type OutboxEmail struct {
+	ID            uuid.UUID  `bun:"type:uuid,pk,default:gen_random_uuid()"`
+	Sender        string     `bun:"sender,notnull"`
+	Recipient     string     `bun:"recipient,notnull"`
+	Subject       string     `bun:"subject,notnull"`
+	Body          string     `bun:"body,notnull"` // Rendered HTML
+	Status        string     `bun:"status,notnull,default:'pending'"`
+	Attempts      int        `bun:"attempts,notnull,default:0"`
+	NextAttemptAt time.Time  `bun:"next_attempt_at,notnull"`
+	LastError     string     `bun:"last_error,nullzero"`
+	MessageID     string     `bun:"message_id,nullzero"` // ID from the mail backend once sent
+	CreatedAt     time.Time  `bun:"created_at,notnull"`
+	SentAt        *time.Time `bun:"sent_at"`
+
+	Attachments []mailer.Attachment `bun:"attachments,type:jsonb,nullzero"` // Sent along with the body, e.g. a calendar event
+}
+
+// A logged-in admin session; only a hash of the session token is stored
+type Session struct {
+	TokenHash   string    `bun:"token_hash,pk"`
+	User        string    `bun:"username,notnull"`
+	CreatedAt   time.Time `bun:"created_at,notnull"`
+	ExpiresAt   time.Time `bun:"expires_at,notnull"`   // Pushed back on every use, up to the session's maximum age
+	IdleTimeout int64     `bun:"idle_timeout,notnull"` // Seconds of inactivity before the session expires
+}
+
+// Operator roles; admins can do everything
+const (
+	RoleAdmin       = "admin"
+	RoleProgrammer  = "programmer"   // Movies, screenings, seat maps, calendars, and reservations
+	RoleShopManager = "shop_manager" // Merchandise and orders
+)
+
+// A theater operator who can log in to the admin site
+type Operator struct {
+	ID           uuid.UUID `bun:"type:uuid,pk,default:gen_random_uuid()"`
+	Email        string    `bun:"email,notnull"` // Unique, ignoring case
+	Name         string    `bun:"name,notnull"`
+	Role         string    `bun:"role,notnull"`
+	PasswordHash string    `bun:"password_hash,nullzero" json:"-"` // bcrypt; unset until the invite is accepted
+	// Set while an invite is outstanding; only a hash of the emailed token is stored
+	InviteTokenHash string     `bun:"invite_token_hash,nullzero,unique" json:"-"`
+	InviteExpiresAt *time.Time `bun:"invite_expires_at"`
+	CreatedAt       time.Time  `bun:"created_at,notnull"`
+	DisabledAt      *time.Time `bun:"disabled_at"` // Disabled operators can't log in
+}
+
+// Audit log actions; handlers may also record more specific ones, e.g. "resend"
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// A change an operator made through the API
+type AuditEntry struct {
+	ID         uuid.UUID      `bun:"type:uuid,pk,default:gen_random_uuid()"`
+	ActorID    uuid.UUID      `bun:"type:uuid,nullzero"` // Unset for the API key
+	ActorName  string         `bun:"actor_name,notnull"`
+	Action     string         `bun:"action,notnull"`
+	EntityType string         `bun:"entity_type,notnull"` // e.g. movie, order
+	EntityID   string         `bun:"entity_id,notnull"`
+	Before     map[string]any `bun:"before,type:jsonb"` // Changed fields as they were; nil when created
+	After      map[string]any `bun:"after,type:jsonb"`  // Changed fields as they are now; nil when deleted
+	IP         string         `bun:"ip,notnull"`
+	Date       time.Time      `bun:"date,notnull"`
 }